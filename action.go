@@ -123,14 +123,19 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 
 		// run the action's app level validations
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		var release func()
+		n, _, release, err = h.GetRibosome(z.Name)
 		if err != nil {
 			return
 		}
+		defer release()
 
 		err = n.ValidateAction(a, def, vpkg, prepareSources(sources))
 		if err != nil {
 			Debugf("Ribosome ValidateAction(%T) err:%v\n", a, err)
+			if _, ok := err.(*ExecLimitErr); ok {
+				err = ValidationFailedErr
+			}
 		}
 	}
 	return
@@ -171,6 +176,8 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 		return
 	case KeyEntryType:
 		// if key entry there no extra info to return in the package so do nothing
+	case ManifestEntryType:
+		// nor for a chunk manifest whose chunks are validated on their own
 	case AgentEntryType:
 		// if agent, the package to return is the entry-type chain
 		// so that sys validation can confirm this agent entry in the chain
@@ -191,10 +198,12 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 
 		// get the packaging request from the app
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		var release func()
+		n, _, release, err = h.GetRibosome(z.Name)
 		if err != nil {
 			return
 		}
+		defer release()
 
 		var req PackagingReq
 		req, err = n.ValidatePackagingRequest(a, def)
@@ -556,10 +565,12 @@ func (a *ActionSend) Do(h *Holochain) (response interface{}, err error) {
 func (a *ActionSend) Receive(dht *DHT, msg *Message, retries int) (response interface{}, err error) {
 	t := msg.Body.(AppMsg)
 	var r Ribosome
-	r, _, err = dht.h.MakeRibosome(t.ZomeType)
+	var release func()
+	r, _, release, err = dht.h.GetRibosome(t.ZomeType)
 	if err != nil {
 		return
 	}
+	defer release()
 	rsp := AppMsg{ZomeType: t.ZomeType}
 	rsp.Body, err = r.Receive(peer.IDB58Encode(msg.From), t.Body)
 	if err == nil {
@@ -628,6 +639,10 @@ func (a *ActionGet) Do(h *Holochain) (response interface{}, err error) {
 		}
 		if (mask & GetMaskEntry) != 0 {
 			resp.Entry = *entry.(*GobEntry)
+			// the type is needed to know how to decode binary content
+			if _, ok := resp.Entry.C.([]byte); ok {
+				resp.EntryType = entryType
+			}
 		}
 
 		response = resp
@@ -698,6 +713,10 @@ func (a *ActionGet) Receive(dht *DHT, msg *Message, retries int) (response inter
 					return
 				}
 				resp.Entry = e
+				// the type is needed to know how to decode binary content
+				if _, ok := e.C.([]byte); ok {
+					resp.EntryType = entryType
+				}
 			}
 		}
 	} else {
@@ -777,6 +796,17 @@ func (a *ActionCommit) Args() []Arg {
 func (a *ActionCommit) Do(h *Holochain) (response interface{}, err error) {
 	var d *EntryDef
 	var entryHash Hash
+
+	// large entries of chunked types get committed as chunks plus a manifest
+	_, d, err = h.GetEntryDef(a.entryType)
+	if err != nil {
+		return
+	}
+	if b, ok := a.entry.Content().([]byte); ok && d.DataFormat == DataFormatBytes && d.ChunkSize > 0 && len(b) > d.ChunkSize {
+		response, err = h.commitChunks(d, b)
+		return
+	}
+
 	//	var header *Header
 	d, _, entryHash, err = h.doCommit(a, nil)
 	if err != nil {
@@ -860,12 +890,40 @@ func sysValidateEntry(h *Holochain, def *EntryDef, entry Entry, pkg *Package) (e
 		}
 
 		// TODO check anything in the package
+	case ManifestEntryType:
+		err = h.validateManifest(entry)
+		if err != nil {
+			return
+		}
 	}
 
 	if entry == nil {
 		err = errors.New("nil entry invalid")
 		return
 	}
+
+	// binary formats must be carried as bytes, and cbor must decode
+	var cborJSON string
+	switch def.DataFormat {
+	case DataFormatBytes:
+		b, ok := entry.Content().([]byte)
+		if !ok || (def.ChunkSize > 0 && len(b) > def.ChunkSize) {
+			err = ValidationFailedErr
+			return
+		}
+	case DataFormatCBOR:
+		b, ok := entry.Content().([]byte)
+		if !ok {
+			err = ValidationFailedErr
+			return
+		}
+		cborJSON, err = CBORToJSON(b)
+		if err != nil {
+			err = fmt.Errorf("invalid cbor entry: %v", err)
+			return
+		}
+	}
+
 	// see if there is a schema validator for the entry type and validate it if so
 	if def.validator != nil {
 		var input interface{}
@@ -873,6 +931,10 @@ func sysValidateEntry(h *Holochain, def *EntryDef, entry Entry, pkg *Package) (e
 			if err = json.Unmarshal([]byte(entry.Content().(string)), &input); err != nil {
 				return
 			}
+		} else if def.DataFormat == DataFormatCBOR {
+			if err = json.Unmarshal([]byte(cborJSON), &input); err != nil {
+				return
+			}
 		} else {
 			input = entry
 		}
@@ -1001,7 +1063,7 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message, retries int) (response inter
 		var b []byte
 		b, err = entry.Marshal()
 		if err == nil {
-			err = dht.put(msg, resp.Type, t.H, msg.From, b, status)
+			err = dht.put(msg, resp.Type, t.H, msg.From, b, status, resp.Header.Time)
 		}
 		return err
 	})
@@ -1497,12 +1559,24 @@ func (a *ActionGetLinks) Do(h *Holochain) (response interface{}, err error) {
 						case string:
 							t.Links[i].E = content
 						case []byte:
-							var j []byte
-							j, err = json.Marshal(content)
+							var def *EntryDef
+							_, def, err = h.GetEntryDef(rsp.(GetResp).EntryType)
 							if err != nil {
 								return
 							}
-							t.Links[i].E = string(j)
+							if def.DataFormat == DataFormatBytes || def.DataFormat == DataFormatCBOR {
+								t.Links[i].E, err = def.ContentString(&entry)
+								if err != nil {
+									return
+								}
+							} else {
+								var j []byte
+								j, err = json.Marshal(content)
+								if err != nil {
+									return
+								}
+								t.Links[i].E = string(j)
+							}
 						case AgentEntry:
 							var j []byte
 							j, err = json.Marshal(content)
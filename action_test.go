@@ -131,6 +131,31 @@ func TestSysValidateEntry(t *testing.T) {
 		So(err.Error(), ShouldEqual, "nil entry invalid")
 	})
 
+	Convey("bytes and cbor entries must carry bytes and cbor must decode", t, func() {
+		bytesDef := &EntryDef{Name: "blob", DataFormat: DataFormatBytes}
+		err := sysValidateEntry(h, bytesDef, &GobEntry{C: "not bytes"}, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+		err = sysValidateEntry(h, bytesDef, &GobEntry{C: []byte{1, 2, 3}}, nil)
+		So(err, ShouldBeNil)
+
+		cborDef := &EntryDef{Name: "record", DataFormat: DataFormatCBOR}
+		err = sysValidateEntry(h, cborDef, &GobEntry{C: `{"a":1}`}, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+		err = sysValidateEntry(h, cborDef, &GobEntry{C: []byte{0xbf}}, nil)
+		So(err, ShouldNotBeNil)
+		b, _ := JSONToCBOR(`{"firstName":"Eric"}`)
+		err = sysValidateEntry(h, cborDef, &GobEntry{C: b}, nil)
+		So(err, ShouldBeNil)
+
+		_, profileDef, _ := h.GetEntryDef("profile")
+		cborDef.validator = profileDef.validator
+		err = sysValidateEntry(h, cborDef, &GobEntry{C: b}, nil)
+		So(err, ShouldNotBeNil)
+		b, _ = JSONToCBOR(`{"firstName":"Eric","lastName":"H-B"}`)
+		err = sysValidateEntry(h, cborDef, &GobEntry{C: b}, nil)
+		So(err, ShouldBeNil)
+	})
+
 	Convey("validate on a schema based entry should check entry against the schema", t, func() {
 		profile := `{"firstName":"Eric"}` // missing required lastName
 		_, def, _ := h.GetEntryDef("profile")
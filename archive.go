@@ -0,0 +1,309 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements portable, signed chain archives for backing up and migrating a source chain
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/metacurrency/holochain/hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// ChainArchiveVersion is the version number of the archive format
+	ChainArchiveVersion int = 1
+)
+
+var ErrArchiveSignatureMismatch = errors.New("archive signature doesn't verify")
+var ErrArchiveRedacted = errors.New("can't restore a chain from an archive with redacted private entries")
+
+// ChainArchive holds a signed, versioned export of a source chain along with the
+// agent entry and DNA hash needed to verify and restore it
+type ChainArchive struct {
+	Version  int
+	DNAHash  Hash
+	Agent    AgentEntry
+	Redacted bool   // true if the contents of private entries were redacted
+	Chain    []byte // chain marshaled with Chain.MarshalChain
+	Sig      Signature
+}
+
+// signingBytes returns the archive data that gets signed by the agent
+func (a *ChainArchive) signingBytes() (b []byte, err error) {
+	var buf bytes.Buffer
+	err = binary.Write(&buf, binary.LittleEndian, int64(a.Version))
+	if err != nil {
+		return
+	}
+	err = a.DNAHash.MarshalHash(&buf)
+	if err != nil {
+		return
+	}
+	err = binary.Write(&buf, binary.LittleEndian, a.Redacted)
+	if err != nil {
+		return
+	}
+	// the variable length fields are length prefixed so that bytes can't be
+	// moved from one field to the next without breaking the signature
+	fields := [][]byte{[]byte(a.Agent.Identity), a.Agent.Revocation, a.Agent.PublicKey, a.Chain}
+	for _, field := range fields {
+		err = binary.Write(&buf, binary.LittleEndian, int64(len(field)))
+		if err != nil {
+			return
+		}
+		err = binary.Write(&buf, binary.LittleEndian, field)
+		if err != nil {
+			return
+		}
+	}
+	b = buf.Bytes()
+	return
+}
+
+// Verify checks the archive version and that its signature matches the agent's public key
+func (a *ChainArchive) Verify() (err error) {
+	if a.Version != ChainArchiveVersion {
+		err = fmt.Errorf("unsupported chain archive version: %d", a.Version)
+		return
+	}
+	var pubKey ic.PubKey
+	pubKey, err = ic.UnmarshalPublicKey(a.Agent.PublicKey)
+	if err != nil {
+		return
+	}
+	var b []byte
+	b, err = a.signingBytes()
+	if err != nil {
+		return
+	}
+	var matches bool
+	matches, err = pubKey.Verify(b, a.Sig.S)
+	if err != nil {
+		return
+	}
+	if !matches {
+		err = ErrArchiveSignatureMismatch
+	}
+	return
+}
+
+// UnmarshalChain verifies the archive and returns the chain it holds, validated with Chain.Validate
+func (a *ChainArchive) UnmarshalChain(hashSpec HashSpec) (c *Chain, err error) {
+	if err = a.Verify(); err != nil {
+		return
+	}
+	_, c, err = UnmarshalChain(hashSpec, bytes.NewBuffer(a.Chain))
+	if err != nil {
+		return
+	}
+	if c.Length() < 2 {
+		err = errors.New("archive chain is missing genesis entries")
+		return
+	}
+	if !c.Headers[0].EntryLink.Equal(&a.DNAHash) {
+		err = errors.New("archive DNA hash doesn't match chain")
+		return
+	}
+
+	// the agent entry in the archive must be the latest one in the chain
+	_, agentHeader := c.TopType(AgentEntryType)
+	var e Entry
+	e, _, err = c.GetEntry(agentHeader.EntryLink)
+	if err != nil {
+		return
+	}
+	agent, ok := e.Content().(AgentEntry)
+	if !ok || agent.Identity != a.Agent.Identity || !bytes.Equal(agent.Revocation, a.Agent.Revocation) ||
+		!bytes.Equal(agent.PublicKey, a.Agent.PublicKey) {
+		err = errors.New("archive agent doesn't match chain")
+		return
+	}
+
+	// redacted entries no longer hash to their entry links so only the headers can be checked
+	err = c.Validate(a.Redacted)
+	return
+}
+
+// ExportChain writes a signed archive of the source chain to the writer, redacting
+// the contents of entries whose types are private if so requested
+func (h *Holochain) ExportChain(writer io.Writer, redactPrivate bool) (err error) {
+	if !h.Started() {
+		err = errors.New("chain not yet started")
+		return
+	}
+	var privateTypeNames []string
+	if redactPrivate {
+		for _, def := range h.GetPrivateEntryDefs() {
+			privateTypeNames = append(privateTypeNames, def.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	err = h.chain.MarshalChain(&buf, ChainMarshalFlagsNone, nil, privateTypeNames)
+	if err != nil {
+		return
+	}
+
+	archive := ChainArchive{
+		Version:  ChainArchiveVersion,
+		DNAHash:  h.DNAHash(),
+		Redacted: len(privateTypeNames) > 0,
+		Chain:    buf.Bytes(),
+	}
+	archive.Agent, err = h.agent.AgentEntry(nil)
+	if err != nil {
+		return
+	}
+
+	var b []byte
+	b, err = archive.signingBytes()
+	if err != nil {
+		return
+	}
+	archive.Sig.S, err = h.Sign(b)
+	if err != nil {
+		return
+	}
+
+	b, err = ByteEncoder(&archive)
+	if err != nil {
+		return
+	}
+	_, err = writer.Write(b)
+	return
+}
+
+// LoadChainArchive reads a chain archive from a reader
+func LoadChainArchive(reader io.Reader) (archive *ChainArchive, err error) {
+	var b []byte
+	b, err = ioutil.ReadAll(reader)
+	if err != nil {
+		return
+	}
+	var a ChainArchive
+	err = ByteDecoder(b, &a)
+	if err != nil {
+		return
+	}
+	archive = &a
+	return
+}
+
+// ImportChain restores a source chain from a chain archive into a holochain whose
+// chain has not yet been started.  The archive must be for the same DNA, must have
+// been made by this holochain's agent and must not have redacted entries.
+func (h *Holochain) ImportChain(reader io.Reader) (err error) {
+	if h.Started() {
+		err = mkErr("chain already started")
+		return
+	}
+
+	var archive *ChainArchive
+	archive, err = LoadChainArchive(reader)
+	if err != nil {
+		return
+	}
+	if archive.Redacted {
+		err = ErrArchiveRedacted
+		return
+	}
+
+	var dnaHash Hash
+	dnaHash, err = DNAHashofUngenedChain(h)
+	if err != nil {
+		return
+	}
+	if !dnaHash.Equal(&archive.DNAHash) {
+		err = fmt.Errorf("archive is for DNA %v not %v", archive.DNAHash, dnaHash)
+		return
+	}
+
+	var pk []byte
+	pk, err = ic.MarshalPublicKey(h.agent.PubKey())
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(pk, archive.Agent.PublicKey) {
+		err = errors.New("archive was made by a different agent")
+		return
+	}
+
+	var c *Chain
+	c, err = archive.UnmarshalChain(h.hashSpec)
+	if err != nil {
+		return
+	}
+
+	// the chain is written to a temporary file which only replaces the chain
+	// file once it has been completely written, so that a failed import
+	// doesn't leave a partial chain behind
+	path := filepath.Join(h.DBPath(), StoreFileName)
+	tmpPath := path + ".import"
+	err = writeChainFile(tmpPath, c)
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return
+	}
+	if h.chain.s != nil {
+		h.chain.s.Close()
+	}
+	h.chain, err = NewChainFromFile(h.hashSpec, path)
+	if err != nil {
+		return
+	}
+
+	h.dnaHash = c.Headers[0].EntryLink.Clone()
+	h.agentHash = c.Headers[1].EntryLink.Clone()
+	_, topHeader := c.TopType(AgentEntryType)
+	h.agentTopHash = topHeader.EntryLink.Clone()
+
+	if err = WriteFile([]byte(h.dnaHash.String()), h.rootPath, DNAHashFileName); err != nil {
+		return
+	}
+
+	if err = h.Prepare(); err != nil {
+		return
+	}
+
+	err = h.dht.SetupDHT()
+	return
+}
+
+// writeChainFile writes the headers and entries of a chain to a new file in the
+// format read by NewChainFromFile
+func writeChainFile(path string, c *Chain) (err error) {
+	var f *os.File
+	f, err = os.Create(path)
+	if err != nil {
+		return
+	}
+	for i, header := range c.Headers {
+		err = writePair(f, header, c.Entries[i])
+		if err != nil {
+			f.Close()
+			return
+		}
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return
+	}
+	err = f.Close()
+	return
+}
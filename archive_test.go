@@ -0,0 +1,123 @@
+package holochain
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportChain(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h.NewEntry(time.Now(), "privateData", &GobEntry{C: "my secret"})
+	commit(h, "oddNumbers", "7")
+
+	Convey("it should export a signed archive of the whole chain", t, func() {
+		var buf bytes.Buffer
+		err := h.ExportChain(&buf, false)
+		So(err, ShouldBeNil)
+		archive, err := LoadChainArchive(&buf)
+		So(err, ShouldBeNil)
+		So(archive.Version, ShouldEqual, ChainArchiveVersion)
+		So(archive.DNAHash.String(), ShouldEqual, h.DNAHash().String())
+		So(archive.Redacted, ShouldBeFalse)
+		So(archive.Verify(), ShouldBeNil)
+
+		c, err := archive.UnmarshalChain(h.hashSpec)
+		So(err, ShouldBeNil)
+		So(c.String(), ShouldEqual, h.chain.String())
+	})
+
+	Convey("it should redact private entries when requested", t, func() {
+		var buf bytes.Buffer
+		err := h.ExportChain(&buf, true)
+		So(err, ShouldBeNil)
+		archive, err := LoadChainArchive(&buf)
+		So(err, ShouldBeNil)
+		So(archive.Redacted, ShouldBeTrue)
+
+		c, err := archive.UnmarshalChain(h.hashSpec)
+		So(err, ShouldBeNil)
+		So(c.Length(), ShouldEqual, h.chain.Length())
+		So(c.Entries[2].Content(), ShouldEqual, ChainMarshalPrivateEntryRedacted)
+		So(c.Entries[3].Content(), ShouldEqual, "7")
+	})
+
+	Convey("it should not verify a tampered archive", t, func() {
+		var buf bytes.Buffer
+		err := h.ExportChain(&buf, false)
+		So(err, ShouldBeNil)
+		archive, err := LoadChainArchive(&buf)
+		So(err, ShouldBeNil)
+		archive.Chain[len(archive.Chain)-1] ^= 0xff
+		So(archive.Verify(), ShouldEqual, ErrArchiveSignatureMismatch)
+		_, err = archive.UnmarshalChain(h.hashSpec)
+		So(err, ShouldEqual, ErrArchiveSignatureMismatch)
+	})
+
+	Convey("it should not verify an archive with a tampered agent", t, func() {
+		var buf bytes.Buffer
+		err := h.ExportChain(&buf, false)
+		So(err, ShouldBeNil)
+		archive, err := LoadChainArchive(&buf)
+		So(err, ShouldBeNil)
+		archive.Agent.Identity = "someone else"
+		So(archive.Verify(), ShouldEqual, ErrArchiveSignatureMismatch)
+		archive.Agent.Identity = h.agent.Identity()
+		archive.Agent.Revocation = []byte("revoked")
+		So(archive.Verify(), ShouldEqual, ErrArchiveSignatureMismatch)
+	})
+}
+
+func TestImportChain(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h.NewEntry(time.Now(), "privateData", &GobEntry{C: "my secret"})
+	commit(h, "oddNumbers", "7")
+
+	var full, redacted bytes.Buffer
+	if err := h.ExportChain(&full, false); err != nil {
+		panic(err)
+	}
+	if err := h.ExportChain(&redacted, true); err != nil {
+		panic(err)
+	}
+
+	h2 := setupTestChain("test2", 0, s)
+	h2.Config.Port = h.Config.Port + 1
+	defer h2.Close()
+
+	Convey("it should refuse to restore a redacted archive", t, func() {
+		err := h2.ImportChain(&redacted)
+		So(err, ShouldEqual, ErrArchiveRedacted)
+		So(h2.Started(), ShouldBeFalse)
+	})
+
+	Convey("it should restore the chain from a full archive", t, func() {
+		err := h2.ImportChain(&full)
+		So(err, ShouldBeNil)
+		So(h2.Started(), ShouldBeTrue)
+		So(h2.DNAHash().String(), ShouldEqual, h.DNAHash().String())
+		So(h2.AgentHash().String(), ShouldEqual, h.AgentHash().String())
+		So(h2.chain.String(), ShouldEqual, h.chain.String())
+		So(h2.chain.Validate(false), ShouldBeNil)
+
+		path := filepath.Join(h2.DBPath(), StoreFileName)
+		So(FileExists(path+".import"), ShouldBeFalse)
+		c, err := NewChainFromFile(h2.hashSpec, path)
+		So(err, ShouldBeNil)
+		defer c.s.Close()
+		So(c.String(), ShouldEqual, h.chain.String())
+	})
+
+	Convey("it should refuse to import into a started chain", t, func() {
+		var buf bytes.Buffer
+		h.ExportChain(&buf, false)
+		err := h2.ImportChain(&buf)
+		So(err.Error(), ShouldEqual, "holochain: chain already started")
+	})
+}
@@ -11,17 +11,111 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
+const (
+	BSReqVersion             = 2
+	BootstrapTTL             = 5 * time.Minute        // how long a registration lasts unless it's refreshed
+	BootstrapRefreshInterval = time.Minute            // how often nodes refresh their registration
+	BootstrapCacheTTL        = 24 * time.Hour         // how old cached registrations can be and still be used
+	BootstrapRetries         = 3                      // how many times the list of bootstrap servers is tried
+	BootstrapBackoff         = 500 * time.Millisecond // the wait before trying the servers again, which doubles
+	BootstrapTimeout         = 10 * time.Second       // how long a request to a bootstrap server may take
+)
+
+// bsClient is used for requests to bootstrap servers so that an unresponsive server can't
+// hang the node
+var bsClient = &http.Client{Timeout: BootstrapTimeout}
+
+var ErrNoBootstrapServer = errors.New("no bootstrap server configured")
+
+var ErrBSBadSignature = errors.New("bootstrap request signature doesn't verify")
+var ErrBSKeyMismatch = errors.New("bootstrap request key doesn't match the node id")
+var ErrBSNotLive = errors.New("bootstrap request has expired")
+
+// BootstrapServerList returns the bootstrap servers in the order they are tried
+func (config *Config) BootstrapServerList() (hosts []string) {
+	seen := make(map[string]bool)
+	for _, host := range append([]string{config.BootstrapServer}, config.BootstrapServers...) {
+		host = strings.TrimSpace(host)
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return
+}
+
+// BSReq is a node's registration with the bootstrap server for a holochain.  It's signed
+// with the node's key so that nobody can register a node but the node itself.
 type BSReq struct {
-	Version  int
-	NodeID   string
-	NodeAddr string
+	Version   int
+	NodeID    string
+	NodeAddr  string
+	NodeAddrs []string  // the node's addresses for its other transports, e.g. WebSocket
+	Time      time.Time // when the node made the request
+	PubKey    []byte    // the node's marshaled public key, from which its id is derived
+	Sig       []byte    // the node's signature of the request for the holochain
+}
+
+// signedData returns the data that the node signs, which includes the holochain's id so
+// that a registration can't be replayed for another holochain
+func (r *BSReq) signedData(chainID string) []byte {
+	data := fmt.Sprintf("%s/%s/%s/%d", chainID, r.NodeID, r.NodeAddr, r.Time.UnixNano())
+	if len(r.NodeAddrs) > 0 {
+		// only nodes with more than one transport sign their other addresses, so that the
+		// registrations of nodes with just one still verify the same way
+		data += "/" + strings.Join(r.NodeAddrs, ",")
+	}
+	return []byte(data)
+}
+
+// Sign adds the node's public key and its signature of the request for a holochain
+func (r *BSReq) Sign(privKey ic.PrivKey, chainID string) (err error) {
+	r.PubKey, err = ic.MarshalPublicKey(privKey.GetPublic())
+	if err != nil {
+		return
+	}
+	r.Sig, err = privKey.Sign(r.signedData(chainID))
+	return
+}
+
+// Verify checks that the request was signed for a holochain by the node it registers
+func (r *BSReq) Verify(chainID string) (err error) {
+	var pubKey ic.PubKey
+	pubKey, err = ic.UnmarshalPublicKey(r.PubKey)
+	if err != nil {
+		return
+	}
+	var id peer.ID
+	id, err = peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return
+	}
+	if peer.IDB58Encode(id) != r.NodeID {
+		err = ErrBSKeyMismatch
+		return
+	}
+	var matches bool
+	matches, err = pubKey.Verify(r.signedData(chainID), r.Sig)
+	if err == nil && !matches {
+		err = ErrBSBadSignature
+	}
+	return
+}
+
+// Live returns true if the request was made within ttl of now
+func (r *BSReq) Live(now time.Time, ttl time.Duration) bool {
+	age := now.Sub(r.Time)
+	return age < ttl && age > -ttl
 }
 
 type BSResp struct {
@@ -29,24 +123,116 @@ type BSResp struct {
 	Remote string
 }
 
+// BSpost registers the node with the bootstrap servers, trying them in turn until one
+// accepts the registration.  Bootstrap servers share registrations with their peers so one
+// is enough.
 func (h *Holochain) BSpost() (err error) {
 	if h.node == nil {
 		return errors.New("Node hasn't been initialized yet.")
 	}
 	nodeID := h.nodeIDStr
-	req := BSReq{Version: 1, NodeID: nodeID, NodeAddr: h.node.ExternalAddr().String()}
-	host := h.Config.BootstrapServer
+	req := BSReq{Version: BSReqVersion, NodeID: nodeID, Time: time.Now()}
+	for i, addr := range h.node.ExternalAddr() {
+		if i == 0 {
+			req.NodeAddr = addr.String()
+		} else {
+			req.NodeAddrs = append(req.NodeAddrs, addr.String())
+		}
+	}
 	id := h.DNAHash()
-	url := fmt.Sprintf("http://%s/%s/%s", host, id.String(), nodeID)
+	if err = req.Sign(h.agent.PrivKey(), id.String()); err != nil {
+		return
+	}
 	var b []byte
 	b, err = json.Marshal(req)
-	//var resp *http.Response
-	if err == nil {
-		_, err = http.Post(url, "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return
 	}
+	err = h.bsTry(func(host string) (err error) {
+		url := fmt.Sprintf("http://%s/%s/%s", host, id.String(), nodeID)
+		var resp *http.Response
+		resp, err = bsClient.Post(url, "application/json", bytes.NewBuffer(b))
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			err = fmt.Errorf("bootstrap server refused registration: %s", strings.TrimSpace(string(body)))
+		}
+		return
+	})
 	return
 }
 
+// bsTry calls fn with each of the bootstrap servers in order until it succeeds.  If they
+// all fail it backs off and starts over, up to BootstrapRetries times, and returns the
+// last error.
+func (h *Holochain) bsTry(fn func(host string) error) (err error) {
+	hosts := h.Config.BootstrapServerList()
+	if len(hosts) == 0 {
+		err = ErrNoBootstrapServer
+		return
+	}
+	backoff := BootstrapBackoff
+	for try := 0; try < BootstrapRetries; try++ {
+		if try > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		for _, host := range hosts {
+			err = fn(host)
+			if err == nil {
+				return
+			}
+			h.dht.dlog.Logf("bootstrap server %s failed: %v", host, err)
+		}
+	}
+	return
+}
+
+// BSRefresh keeps the node's bootstrap registration alive by posting it again on an interval
+func (h *Holochain) BSRefresh(interval time.Duration) {
+	h.stopBSRefresh()
+	h.bsRefreshing = Ticker(interval, func() {
+		if err := h.BSpost(); err != nil {
+			h.dht.dlog.Logf("error in BSpost: %s", err.Error())
+		}
+	})
+}
+
+// stopBSRefresh stops refreshing the bootstrap registration
+func (h *Holochain) stopBSRefresh() {
+	if h.bsRefreshing != nil {
+		stop := h.bsRefreshing
+		h.bsRefreshing = nil
+		stop <- true
+	}
+}
+
+// liveBSResponses returns the bootstrap responses whose requests were signed by their
+// nodes for the holochain and aren't older than ttl
+func (h *Holochain) liveBSResponses(nodes []BSResp, now time.Time, ttl time.Duration) (live []BSResp) {
+	chainID := h.DNAHash().String()
+	for _, r := range nodes {
+		err := r.Req.Verify(chainID)
+		if err == nil && !r.Req.Live(now, ttl) {
+			err = ErrBSNotLive
+		}
+		if err != nil {
+			h.dht.dlog.Logf("ignoring bootstrap response for %s: %v", r.Req.NodeID, err)
+			continue
+		}
+		live = append(live, r)
+	}
+	return
+}
+
+// isCircuitAddr returns true if a node's address is a circuit through a relay
+func isCircuitAddr(addr string) bool {
+	return strings.Contains(addr, "/p2p-circuit")
+}
+
 func (h *Holochain) checkBSResponses(nodes []BSResp) (err error) {
 	myNodeID := h.nodeIDStr
 	for _, r := range nodes {
@@ -58,18 +244,31 @@ func (h *Holochain) checkBSResponses(nodes []BSResp) (err error) {
 		if err == nil {
 			//@TODO figure when to use Remote or r.NodeAddr
 			x := strings.Split(r.Remote, ":")
-			y := strings.Split(r.Req.NodeAddr, "/")
-			port := y[len(y)-1]
+			if isCircuitAddr(r.Req.NodeAddr) {
+				// the node is reached through its relay, whose address is in the circuit
+				addr, err = ma.NewMultiaddr(r.Req.NodeAddr)
+			} else {
+				y := strings.Split(r.Req.NodeAddr, "/")
+				port := y[len(y)-1]
 
-			// assume the multi-address is the ip address as the bootstrap server saw it
-			// with port number advertised by the node in it's multi-address
+				// assume the multi-address is the ip address as the bootstrap server saw it
+				// with port number advertised by the node in it's multi-address
 
-			addr, err = ma.NewMultiaddr("/ip4/" + x[0] + "/tcp/" + port)
+				addr, err = ma.NewMultiaddr("/ip4/" + x[0] + "/tcp/" + port)
+			}
 			if err == nil {
+				addrs := []ma.Multiaddr{addr}
+				// the node's other transports are reached at the same ip address
+				for _, a := range r.Req.NodeAddrs {
+					a = strings.Replace(a, "/ip4/0.0.0.0/", "/ip4/"+x[0]+"/", 1)
+					if addr, e := ma.NewMultiaddr(a); e == nil {
+						addrs = append(addrs, addr)
+					}
+				}
 				// don't "discover" ourselves
 				if r.Req.NodeID != myNodeID {
-					h.dht.dlog.Logf("discovered peer: %s (%v)", r.Req.NodeID, addr)
-					err = h.AddPeer(id, []ma.Multiaddr{addr})
+					h.dht.dlog.Logf("discovered peer: %s (%v)", r.Req.NodeID, addrs)
+					err = h.AddPeer(id, addrs)
 				}
 
 			}
@@ -78,30 +277,77 @@ func (h *Holochain) checkBSResponses(nodes []BSResp) (err error) {
 	return
 }
 
+// BSget gets the registrations of the holochain's nodes from the first bootstrap server that
+// answers and adds them as peers.  The registrations are cached so that if no bootstrap
+// server answers the next time, the node can still find the peers it knew.
 func (h *Holochain) BSget() (err error) {
 	if h.node == nil {
 		return errors.New("Node hasn't been initialized yet.")
 	}
-	host := h.Config.BootstrapServer
-	if host == "" {
+	if len(h.Config.BootstrapServerList()) == 0 {
 		return
 	}
 	id := h.DNAHash()
-	url := fmt.Sprintf("http://%s/%s", host, id.String())
-	var resp *http.Response
-	resp, err = http.Get(url)
-	if err == nil {
+	var nodes []BSResp
+	err = h.bsTry(func(host string) (err error) {
+		url := fmt.Sprintf("http://%s/%s", host, id.String())
+		var resp *http.Response
+		resp, err = bsClient.Get(url)
+		if err != nil {
+			return
+		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("bootstrap server returned status: %s", resp.Status)
+			return
+		}
 		var b []byte
 		b, err = ioutil.ReadAll(resp.Body)
 		if err == nil {
-			var nodes []BSResp
 			err = json.Unmarshal(b, &nodes)
-			if err == nil {
-				err = h.checkBSResponses(nodes)
-
-			}
 		}
+		return
+	})
+	if err != nil {
+		h.dht.dlog.Logf("no bootstrap server answered, using cached peers: %v", err)
+		if e := h.bsCached(); e != nil {
+			h.dht.dlog.Logf("error using cached peers: %v", e)
+		}
+		return
+	}
+	live := h.liveBSResponses(nodes, time.Now(), BootstrapTTL)
+	if e := h.saveBSCache(live); e != nil {
+		h.dht.dlog.Logf("error caching peers: %v", e)
+	}
+	err = h.checkBSResponses(live)
+	return
+}
+
+// saveBSCache saves the registrations that were last got from a bootstrap server
+func (h *Holochain) saveBSCache(nodes []BSResp) (err error) {
+	var b []byte
+	b, err = json.Marshal(nodes)
+	if err == nil {
+		err = WriteFile(b, h.DBPath(), BSCacheFileName)
+	}
+	return
+}
+
+// bsCached adds the peers from the registrations that were last got from a bootstrap
+// server, as long as they aren't older than BootstrapCacheTTL
+func (h *Holochain) bsCached() (err error) {
+	if !FileExists(filepath.Join(h.DBPath(), BSCacheFileName)) {
+		return
+	}
+	var b []byte
+	b, err = ReadFile(h.DBPath(), BSCacheFileName)
+	if err != nil {
+		return
+	}
+	var nodes []BSResp
+	if err = json.Unmarshal(b, &nodes); err != nil {
+		return
 	}
+	err = h.checkBSResponses(h.liveBSResponses(nodes, time.Now(), BootstrapCacheTTL))
 	return
 }
@@ -0,0 +1,217 @@
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBSReqSignature(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	chainID := h.DNAHash().String()
+	req := BSReq{Version: BSReqVersion, NodeID: h.nodeIDStr, NodeAddr: "/ip4/127.0.0.1/tcp/1234", Time: time.Now()}
+	err := req.Sign(h.agent.PrivKey(), chainID)
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("a signed request should verify for its holochain", t, func() {
+		So(req.Verify(chainID), ShouldBeNil)
+	})
+
+	Convey("a request should not verify for another holochain or if it was changed", t, func() {
+		So(req.Verify("QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuU2"), ShouldEqual, ErrBSBadSignature)
+		changed := req
+		changed.NodeAddr = "/ip4/10.0.0.1/tcp/1234"
+		So(changed.Verify(chainID), ShouldEqual, ErrBSBadSignature)
+	})
+
+	Convey("a request should sign the addresses of the node's other transports", t, func() {
+		multi := req
+		multi.NodeAddrs = []string{"/ip4/127.0.0.1/tcp/1235/ws"}
+		So(multi.Sign(h.agent.PrivKey(), chainID), ShouldBeNil)
+		So(multi.Verify(chainID), ShouldBeNil)
+		So(string(multi.signedData(chainID)), ShouldNotEqual, string(req.signedData(chainID)))
+		multi.NodeAddrs = []string{"/ip4/10.0.0.1/tcp/1235/ws"}
+		So(multi.Verify(chainID), ShouldEqual, ErrBSBadSignature)
+	})
+
+	Convey("a request should not verify for another node's id", t, func() {
+		other := req
+		other.NodeID = "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2"
+		So(other.Verify(chainID), ShouldEqual, ErrBSKeyMismatch)
+	})
+
+	Convey("requests should only be live within the ttl", t, func() {
+		So(req.Live(req.Time.Add(time.Minute), BootstrapTTL), ShouldBeTrue)
+		So(req.Live(req.Time.Add(BootstrapTTL), BootstrapTTL), ShouldBeFalse)
+		So(req.Live(req.Time.Add(-BootstrapTTL), BootstrapTTL), ShouldBeFalse)
+	})
+
+	Convey("only live and verified responses should be used", t, func() {
+		unsigned := BSReq{Version: BSReqVersion, NodeID: h.nodeIDStr, NodeAddr: req.NodeAddr, Time: req.Time}
+		nodes := []BSResp{{Req: req, Remote: "127.0.0.1:1234"}, {Req: unsigned, Remote: "127.0.0.1:1234"}}
+		So(h.liveBSResponses(nodes, time.Now(), BootstrapTTL), ShouldResemble, []BSResp{nodes[0]})
+		So(len(h.liveBSResponses(nodes, req.Time.Add(BootstrapTTL), BootstrapTTL)), ShouldEqual, 0)
+	})
+}
+
+func TestBootstrapServerList(t *testing.T) {
+	Convey("it should list the bootstrap servers in order without blanks or repeats", t, func() {
+		config := Config{BootstrapServer: "a:1", BootstrapServers: []string{"b:2", "", "a:1", " c:3"}}
+		So(config.BootstrapServerList(), ShouldResemble, []string{"a:1", "b:2", "c:3"})
+		config = Config{}
+		So(config.BootstrapServerList(), ShouldBeNil)
+	})
+}
+
+func TestBSTry(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.Config.BootstrapServer = "a:1"
+	h.Config.BootstrapServers = []string{"b:2"}
+
+	Convey("it should try the servers in order until one succeeds", t, func() {
+		var tried []string
+		err := h.bsTry(func(host string) error {
+			tried = append(tried, host)
+			if host == "b:2" {
+				return nil
+			}
+			return errors.New("down")
+		})
+		So(err, ShouldBeNil)
+		So(tried, ShouldResemble, []string{"a:1", "b:2"})
+	})
+
+	Convey("it should back off and retry when they all fail", t, func() {
+		var tried []string
+		start := time.Now()
+		err := h.bsTry(func(host string) error {
+			tried = append(tried, host)
+			return errors.New("down")
+		})
+		So(err.Error(), ShouldEqual, "down")
+		So(len(tried), ShouldEqual, 2*BootstrapRetries)
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 3*BootstrapBackoff)
+	})
+}
+
+func TestBSTimeout(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	hang := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer server.Close()
+	defer close(hang)
+	h.Config.BootstrapServer = strings.TrimPrefix(server.URL, "http://")
+
+	timeout := bsClient.Timeout
+	bsClient.Timeout = 10 * time.Millisecond
+	defer func() { bsClient.Timeout = timeout }()
+
+	Convey("requests to an unresponsive bootstrap server should time out", t, func() {
+		So(h.BSpost(), ShouldNotBeNil)
+		So(h.BSget(), ShouldNotBeNil)
+	})
+}
+
+func TestBSCache(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	id, key := makePeer("cached peer")
+	req := BSReq{Version: BSReqVersion, NodeID: peer.IDB58Encode(id), NodeAddr: "/ip4/127.0.0.1/tcp/1234", Time: time.Now()}
+	if err := req.Sign(key, h.DNAHash().String()); err != nil {
+		panic(err)
+	}
+
+	Convey("it should add the cached peers", t, func() {
+		So(h.saveBSCache([]BSResp{{Req: req, Remote: "127.0.0.1:1234"}}), ShouldBeNil)
+		So(h.node.routingTable.Find(id), ShouldEqual, peer.ID(""))
+		So(h.bsCached(), ShouldBeNil)
+		So(h.node.routingTable.Find(id), ShouldEqual, id)
+	})
+}
+
+func TestCheckBSResponses(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	id, _ := makePeer("multi transport peer")
+	req := BSReq{Version: BSReqVersion, NodeID: peer.IDB58Encode(id), NodeAddr: "/ip4/0.0.0.0/tcp/1234", NodeAddrs: []string{"/ip4/0.0.0.0/tcp/1235/ws"}, Time: time.Now()}
+
+	Convey("it should add a peer's addresses for each of its transports at the ip the server saw", t, func() {
+		So(h.checkBSResponses([]BSResp{{Req: req, Remote: "10.0.0.5:4567"}}), ShouldBeNil)
+		var addrs []string
+		for _, addr := range h.node.peerstore.Addrs(id) {
+			addrs = append(addrs, addr.String())
+		}
+		So(addrs, ShouldContain, "/ip4/10.0.0.5/tcp/1234")
+		So(addrs, ShouldContain, "/ip4/10.0.0.5/tcp/1235/ws")
+	})
+}
+
+func TestBSRelayedAddr(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	relayed := setupTestChain("relayed", 1, s)
+	prepareTestChain(relayed)
+	defer relayed.Close()
+
+	relayNode, err := makeNode(1250, "relay")
+	if err != nil {
+		panic(err)
+	}
+	defer relayNode.Close()
+	natted, err := makeNode(1251, "natted")
+	if err != nil {
+		panic(err)
+	}
+	relayed.node.Close()
+	relayed.node = natted
+	if err = relayNode.EnableRelay(true); err != nil {
+		panic(err)
+	}
+	if err = natted.EnableRelay(false); err != nil {
+		panic(err)
+	}
+	if err = natted.AddRelay(relayNode.NetAddr.String() + "/ipfs/" + peer.IDB58Encode(relayNode.HashAddr)); err != nil {
+		panic(err)
+	}
+	natted.connectRelays()
+
+	var posted BSReq
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&posted)
+	}))
+	defer server.Close()
+	relayed.Config.BootstrapServer = strings.TrimPrefix(server.URL, "http://")
+
+	Convey("a node's relayed address should be registered and added by other nodes as it is", t, func() {
+		So(relayed.BSpost(), ShouldBeNil)
+		relayedAddr := natted.ExternalAddr()[0].String()
+		So(isCircuitAddr(relayedAddr), ShouldBeTrue)
+		So(posted.NodeAddr, ShouldEqual, relayedAddr)
+
+		So(h.checkBSResponses([]BSResp{{Req: posted, Remote: "10.0.0.5:4567"}}), ShouldBeNil)
+		id, err := peer.IDB58Decode(posted.NodeID)
+		So(err, ShouldBeNil)
+		var addrs []string
+		for _, addr := range h.node.peerstore.Addrs(id) {
+			addrs = append(addrs, addr.String())
+		}
+		So(addrs, ShouldContain, relayedAddr)
+	})
+}
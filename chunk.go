@@ -0,0 +1,154 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements storing large entries as content-addressed chunks plus a manifest
+
+package holochain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	"io"
+)
+
+var ErrChunkMismatch = errors.New("chunk doesn't match manifest")
+
+// ChunkManifest is the content of a ManifestEntryType entry which lists, in order, the
+// hashes of the chunk entries that make up a large entry
+type ChunkManifest struct {
+	EntryType string // the entry type of the chunks
+	Size      int    // total size of the content in bytes
+	Hash      Hash   // hash of the complete content
+	Chunks    []Hash
+}
+
+// chunkCount returns how many chunks of the given size it takes to hold size bytes
+func chunkCount(size int, chunkSize int) int {
+	return (size + chunkSize - 1) / chunkSize
+}
+
+// commitChunks commits content as a series of entries of the given type, each no larger than
+// the type's ChunkSize, and then commits the manifest which lists them.  Each chunk is
+// validated and put to the DHT just like any other entry.
+func (h *Holochain) commitChunks(def *EntryDef, content []byte) (manifestHash Hash, err error) {
+	m := ChunkManifest{EntryType: def.Name, Size: len(content)}
+	err = m.Hash.Sum(h.hashSpec, content)
+	if err != nil {
+		return
+	}
+	for start := 0; start < len(content); start += def.ChunkSize {
+		end := start + def.ChunkSize
+		if end > len(content) {
+			end = len(content)
+		}
+		var r interface{}
+		r, err = NewCommitAction(def.Name, &GobEntry{C: content[start:end]}).Do(h)
+		if err != nil {
+			err = fmt.Errorf("error committing chunk %d of %s entry: %v", len(m.Chunks), def.Name, err)
+			return
+		}
+		m.Chunks = append(m.Chunks, r.(Hash))
+	}
+	var r interface{}
+	r, err = NewCommitAction(ManifestEntryType, &GobEntry{C: m}).Do(h)
+	if err != nil {
+		return
+	}
+	manifestHash = r.(Hash)
+	return
+}
+
+// StreamChunks gets the chunks listed in a manifest, verifies each against its hash
+// in the manifest and writes them in order to the writer
+func (h *Holochain) StreamChunks(m *ChunkManifest, writer io.Writer) (err error) {
+	return h.streamChunks(m, false, writer)
+}
+
+// streamChunks does the work of StreamChunks, getting the chunks from the local
+// chain instead of the DHT if local is set
+func (h *Holochain) streamChunks(m *ChunkManifest, local bool, writer io.Writer) (err error) {
+	var size int
+	for i, hash := range m.Chunks {
+		req := GetReq{H: hash, StatusMask: StatusDefault, GetMask: GetMaskEntry}
+		var r interface{}
+		r, err = NewGetAction(req, &GetOptions{StatusMask: StatusDefault, GetMask: GetMaskEntry, Local: local}).Do(h)
+		if err != nil {
+			err = fmt.Errorf("error getting chunk %d: %v", i, err)
+			return
+		}
+		entry := r.(GetResp).Entry
+		chunk, ok := entry.C.([]byte)
+		if !ok {
+			err = ErrChunkMismatch
+			return
+		}
+		var chunkHash Hash
+		chunkHash, err = entry.Sum(h.hashSpec)
+		if err != nil {
+			return
+		}
+		if !chunkHash.Equal(&hash) {
+			err = ErrChunkMismatch
+			return
+		}
+		_, err = writer.Write(chunk)
+		if err != nil {
+			return
+		}
+		size += len(chunk)
+	}
+	if size != m.Size {
+		err = ErrChunkMismatch
+	}
+	return
+}
+
+// GetChunked reassembles the content of a chunked entry from its manifest, verifying it
+// against the hash of the complete content recorded in the manifest
+func (h *Holochain) GetChunked(m *ChunkManifest) (content []byte, err error) {
+	return h.getChunked(m, false)
+}
+
+// getChunked does the work of GetChunked, getting the chunks from the local chain
+// instead of the DHT if local is set
+func (h *Holochain) getChunked(m *ChunkManifest, local bool) (content []byte, err error) {
+	var buf bytes.Buffer
+	err = h.streamChunks(m, local, &buf)
+	if err != nil {
+		return
+	}
+	var hash Hash
+	err = hash.Sum(h.hashSpec, buf.Bytes())
+	if err != nil {
+		return
+	}
+	if !hash.Equal(&m.Hash) {
+		err = ErrChunkMismatch
+		return
+	}
+	content = buf.Bytes()
+	return
+}
+
+// validateManifest checks that a manifest is for a chunked entry type and that its
+// chunk list is consistent with its size
+func (h *Holochain) validateManifest(entry Entry) (err error) {
+	m, ok := entry.Content().(ChunkManifest)
+	if !ok {
+		err = ValidationFailedErr
+		return
+	}
+	var def *EntryDef
+	_, def, err = h.GetEntryDef(m.EntryType)
+	if err != nil || def.DataFormat != DataFormatBytes || def.ChunkSize <= 0 {
+		err = ValidationFailedErr
+		return
+	}
+	if m.Size <= def.ChunkSize || len(m.Chunks) != chunkCount(m.Size, def.ChunkSize) {
+		err = ValidationFailedErr
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package holochain
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestChunkedEntries(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	zome := &h.nucleus.dna.Zomes[1]
+	zome.Entries = append(zome.Entries, EntryDef{Name: "file", DataFormat: DataFormatBytes, Sharing: Public, ChunkSize: 4})
+	zome.Code += "\nfunction validate(entry_type,entry,header,sources) {return true}"
+	content := []byte("hello world")
+
+	r, err := NewCommitAction("file", &GobEntry{C: content}).Do(h)
+	if err != nil {
+		panic(err)
+	}
+	manifestHash := r.(Hash)
+	if err := h.dht.simHandleChangeReqs(); err != nil {
+		panic(err)
+	}
+
+	Convey("commit should store large entries as chunks plus a manifest", t, func() {
+		e, entryType, err := h.chain.GetEntry(manifestHash)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, ManifestEntryType)
+		m := e.Content().(ChunkManifest)
+		So(m.EntryType, ShouldEqual, "file")
+		So(m.Size, ShouldEqual, len(content))
+		So(len(m.Chunks), ShouldEqual, 3)
+
+		e, entryType, err = h.chain.GetEntry(m.Chunks[2])
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "file")
+		So(e.Content(), ShouldResemble, []byte("rld"))
+	})
+
+	Convey("small entries should not be chunked", t, func() {
+		r, err := NewCommitAction("file", &GobEntry{C: []byte("hi")}).Do(h)
+		So(err, ShouldBeNil)
+		_, entryType, err := h.chain.GetEntry(r.(Hash))
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "file")
+	})
+
+	Convey("only bytes entries should be chunked", t, func() {
+		zome.Entries = append(zome.Entries, EntryDef{Name: "record", DataFormat: DataFormatCBOR, Sharing: Public, ChunkSize: 4})
+		record, err := JSONToCBOR(`{"name":"Eric Harris-Braun"}`)
+		So(err, ShouldBeNil)
+		r, err := NewCommitAction("record", &GobEntry{C: record}).Do(h)
+		So(err, ShouldBeNil)
+		e, entryType, err := h.chain.GetEntry(r.(Hash))
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "record")
+		So(e.Content(), ShouldResemble, record)
+	})
+
+	e, _, _ := h.chain.GetEntry(manifestHash)
+	m := e.Content().(ChunkManifest)
+
+	Convey("it should reassemble and stream the chunks", t, func() {
+		b, err := h.GetChunked(&m)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, content)
+
+		var buf bytes.Buffer
+		err = h.StreamChunks(&m, &buf)
+		So(err, ShouldBeNil)
+		So(buf.Bytes(), ShouldResemble, content)
+	})
+
+	Convey("it should detect chunks that don't match the manifest", t, func() {
+		bad := m
+		bad.Chunks = []Hash{m.Chunks[1], m.Chunks[0], m.Chunks[2]}
+		_, err := h.GetChunked(&bad)
+		So(err, ShouldEqual, ErrChunkMismatch)
+
+		bad = m
+		bad.Size = 10
+		_, err = h.GetChunked(&bad)
+		So(err, ShouldEqual, ErrChunkMismatch)
+	})
+
+	Convey("it should validate chunk sizes and manifests", t, func() {
+		_, def, _ := h.GetEntryDef("file")
+		err := sysValidateEntry(h, def, &GobEntry{C: content}, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+
+		bad := m
+		bad.Chunks = m.Chunks[:2]
+		err = sysValidateEntry(h, ManifestEntryDef, &GobEntry{C: bad}, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+		bad = m
+		bad.EntryType = "oddNumbers"
+		err = sysValidateEntry(h, ManifestEntryDef, &GobEntry{C: bad}, nil)
+		So(err, ShouldEqual, ValidationFailedErr)
+		err = sysValidateEntry(h, ManifestEntryDef, &GobEntry{C: m}, nil)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("ribosome get should return the reassembled entry", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`get("%s");`, manifestHash.String())})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		So(z.lastResult.String(), ShouldEqual, "aGVsbG8gd29ybGQ=")
+	})
+}
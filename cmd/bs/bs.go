@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,10 +9,12 @@ import (
 	"github.com/op/go-logging"
 	"github.com/tidwall/buntdb"
 	"github.com/urfave/cli"
+	"net"
 	"net/http"
 	"os"
 	"os/user"
 	"strings"
+	"time"
 )
 
 const (
@@ -22,6 +25,19 @@ var log = logging.MustGetLogger("main")
 
 var store *buntdb.DB
 
+// ttl is how long registrations last unless the nodes refresh them
+var ttl = holo.BootstrapTTL
+
+// peers are the other bootstrap servers that registrations are shared with
+var peers []string
+
+// client is used for requests to the peer servers so that an unresponsive peer can't hang
+// the server
+var client = &http.Client{Timeout: holo.BootstrapTimeout}
+
+// ForwardedRemoteHeader holds the address of the node when a peer server forwards its registration
+const ForwardedRemoteHeader = "X-Holochain-Bootstrap-Remote"
+
 func setupApp() (app *cli.App) {
 	app = cli.NewApp()
 	app.Name = "bs"
@@ -38,6 +54,16 @@ func setupApp() (app *cli.App) {
 			Value:       DefaultPort,
 			Destination: &port,
 		},
+		cli.DurationFlag{
+			Name:        "ttl",
+			Usage:       "how long node registrations last unless they are refreshed",
+			Value:       holo.BootstrapTTL,
+			Destination: &ttl,
+		},
+		cli.StringSliceFlag{
+			Name:  "peer",
+			Usage: "address (host:port) of another bootstrap server to share registrations with, may be repeated",
+		},
 	}
 
 	app.Before = func(c *cli.Context) error {
@@ -66,6 +92,8 @@ func setupApp() (app *cli.App) {
 	}
 
 	app.Action = func(c *cli.Context) error {
+		peers = c.StringSlice("peer")
+		syncFromPeers()
 		return serve(port)
 	}
 	return
@@ -97,10 +125,11 @@ func h(w http.ResponseWriter, r *http.Request) {
 			nodes := make([]holo.BSResp, 0)
 			//hid := fmt.Sprintf(`{"HID":"%s"}`, chain)
 
+			now := time.Now()
 			tx.Ascend("chain", func(key, value string) bool {
 				var nd Node
 				json.Unmarshal([]byte(value), &nd)
-				if nd.HID == chain {
+				if nd.HID == chain && nd.Req.Live(now, ttl) {
 					log.Infof("Found: %s=>%s", key, value)
 					resp := holo.BSResp{Req: nd.Req, Remote: nd.Remote}
 					nodes = append(nodes, resp)
@@ -130,19 +159,26 @@ func h(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			err = json.NewDecoder(r.Body).Decode(&req)
 			if err == nil {
-				err = store.Update(func(tx *buntdb.Tx) error {
-					var b []byte
-					n := Node{Remote: r.RemoteAddr, Req: req, HID: chain}
-					b, err = json.Marshal(n)
-					if err == nil {
-						_, _, err = tx.Set(node, string(b), nil)
-						if err == nil {
-							log.Infof("Set: %s", string(b))
-							fmt.Fprintf(w, "ok")
-						}
+				err = checkReq(chain, node, &req)
+			}
+			remote := r.RemoteAddr
+			forwarded := r.Header.Get(ForwardedRemoteHeader)
+			if err == nil && forwarded != "" {
+				// only peer servers may say where a registration came from
+				if !fromPeer(r.RemoteAddr) {
+					err = errors.New("forwarded registration from unknown server")
+				}
+				remote = forwarded
+			}
+			if err == nil {
+				n := Node{Remote: remote, Req: req, HID: chain}
+				err = storeNode(&n)
+				if err == nil {
+					fmt.Fprintf(w, "ok")
+					if forwarded == "" {
+						go forward(&n)
 					}
-					return err
-				})
+				}
 			}
 		}
 	}
@@ -154,15 +190,164 @@ func h(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// storeNode stores a registration until it expires, unless a newer one for the node is
+// already stored.  Registrations are per holochain.
+func storeNode(n *Node) (err error) {
+	remaining := ttl - time.Since(n.Req.Time)
+	if remaining <= 0 {
+		return
+	}
+	key := n.HID + "/" + n.Req.NodeID
+	err = store.Update(func(tx *buntdb.Tx) error {
+		if value, e := tx.Get(key); e == nil {
+			var old Node
+			if json.Unmarshal([]byte(value), &old) == nil && old.Req.Time.After(n.Req.Time) {
+				return nil
+			}
+		}
+		b, e := json.Marshal(n)
+		if e != nil {
+			return e
+		}
+		_, _, e = tx.Set(key, string(b), &buntdb.SetOptions{Expires: true, TTL: remaining})
+		if e == nil {
+			log.Infof("Set: %s", string(b))
+		}
+		return e
+	})
+	return
+}
+
+// fromPeer returns true if a request's remote address is one of the peer servers
+func fromPeer(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, peer := range peers {
+		peerHost, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			peerHost = peer
+		}
+		addrs, err := net.LookupHost(peerHost)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if addr == host {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forward sends a registration that a node made with this server on to the peer servers
+func forward(n *Node) {
+	b, err := json.Marshal(n.Req)
+	if err != nil {
+		return
+	}
+	for _, peer := range peers {
+		req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/%s/%s", peer, n.HID, n.Req.NodeID), bytes.NewBuffer(b))
+		if err != nil {
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(ForwardedRemoteHeader, n.Remote)
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Infof("error forwarding to %s: %v", peer, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+// liveNodes returns all the live registrations
+func liveNodes() (nodes []Node, err error) {
+	nodes = make([]Node, 0)
+	now := time.Now()
+	err = store.View(func(tx *buntdb.Tx) error {
+		tx.Ascend("chain", func(key, value string) bool {
+			var n Node
+			if json.Unmarshal([]byte(value), &n) == nil && n.Req.Live(now, ttl) {
+				nodes = append(nodes, n)
+			}
+			return true
+		})
+		return nil
+	})
+	return
+}
+
+// registrations returns the live registrations for peer servers to replicate
+func registrations(w http.ResponseWriter, r *http.Request) {
+	nodes, err := liveNodes()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	json.NewEncoder(w).Encode(nodes)
+}
+
+// syncFromPeers stores the live registrations of the peer servers, so that a server that
+// was down catches up on the registrations it missed
+func syncFromPeers() {
+	for _, peer := range peers {
+		resp, err := client.Get(fmt.Sprintf("http://%s/_registrations", peer))
+		if err != nil {
+			log.Infof("error syncing from %s: %v", peer, err)
+			continue
+		}
+		var nodes []Node
+		err = json.NewDecoder(resp.Body).Decode(&nodes)
+		resp.Body.Close()
+		if err != nil {
+			log.Infof("error syncing from %s: %v", peer, err)
+			continue
+		}
+		for i := range nodes {
+			n := &nodes[i]
+			if err = checkReq(n.HID, n.Req.NodeID, &n.Req); err == nil {
+				err = storeNode(n)
+			}
+			if err != nil {
+				log.Infof("error syncing %s from %s: %v", n.Req.NodeID, peer, err)
+			}
+		}
+	}
+}
+
+// checkReq makes sure that a registration was signed by the node it registers, for the
+// holochain it registers with, and that it isn't stale
+func checkReq(chain string, node string, req *holo.BSReq) (err error) {
+	if req.NodeID != node {
+		err = errors.New("node id doesn't match path")
+		return
+	}
+	if err = req.Verify(chain); err != nil {
+		return
+	}
+	if !req.Live(time.Now(), ttl) {
+		err = holo.ErrBSNotLive
+	}
+	return
+}
+
 func getCompleteConnectionList(response http.ResponseWriter, request *http.Request) {
 	var err error
 	err = store.View(func(tx *buntdb.Tx) error {
 		nodes := make([]holo.BSResp, 0)
 		//hid := fmt.Sprintf(`{"HID":"%s"}`, chain)
 
+		now := time.Now()
 		tx.Ascend("chain", func(key, value string) bool {
 			var node Node
 			json.Unmarshal([]byte(value), &node)
+			if !node.Req.Live(now, ttl) {
+				return true
+			}
 
 			log.Infof("Found: %s=>%s", key, value)
 			resp := holo.BSResp{Req: node.Req, Remote: node.Remote}
@@ -185,6 +370,7 @@ func getCompleteConnectionList(response http.ResponseWriter, request *http.Reque
 func serve(port int) (err error) {
 	http.HandleFunc("/", h)
 	http.HandleFunc("/getCompleteConnectionList", getCompleteConnectionList)
+	http.HandleFunc("/_registrations", registrations)
 
 	log.Infof("starting up on port %d", port)
 	err = http.ListenAndServe(fmt.Sprintf(":%d", port), nil) // set listen port
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	holo "github.com/metacurrency/holochain"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
 	_ "github.com/urfave/cli"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestSetupApp(t *testing.T) {
@@ -12,3 +22,121 @@ func TestSetupApp(t *testing.T) {
 		So(app.Name, ShouldEqual, "bs")
 	})
 }
+
+func TestRegistration(t *testing.T) {
+	var err error
+	store, err = buntdb.Open(":memory:")
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+	store.CreateIndex("chain", "*", buntdb.IndexJSON("HID"))
+
+	priv, _, err := ic.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	id, _ := peer.IDFromPrivateKey(priv)
+	nodeID := peer.IDB58Encode(id)
+	chain := "QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuU2"
+
+	post := func(req holo.BSReq, path string) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("POST", path, bytes.NewBuffer(b)))
+		return w
+	}
+	get := func() (nodes []holo.BSResp) {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest("GET", "/"+chain, nil))
+		json.Unmarshal(w.Body.Bytes(), &nodes)
+		return
+	}
+
+	Convey("it should reject unsigned or stale registrations", t, func() {
+		req := holo.BSReq{Version: holo.BSReqVersion, NodeID: nodeID, NodeAddr: "/ip4/127.0.0.1/tcp/1234", Time: time.Now()}
+		So(post(req, "/"+chain+"/"+nodeID).Code, ShouldEqual, http.StatusBadRequest)
+
+		req.Time = time.Now().Add(-2 * ttl)
+		So(req.Sign(priv, chain), ShouldBeNil)
+		So(post(req, "/"+chain+"/"+nodeID).Code, ShouldEqual, http.StatusBadRequest)
+		So(len(get()), ShouldEqual, 0)
+	})
+
+	Convey("it should reject registrations for another node", t, func() {
+		req := holo.BSReq{Version: holo.BSReqVersion, NodeID: nodeID, NodeAddr: "/ip4/127.0.0.1/tcp/1234", Time: time.Now()}
+		So(req.Sign(priv, chain), ShouldBeNil)
+		So(post(req, "/"+chain+"/QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2").Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("it should return live signed registrations", t, func() {
+		req := holo.BSReq{Version: holo.BSReqVersion, NodeID: nodeID, NodeAddr: "/ip4/127.0.0.1/tcp/1234", Time: time.Now()}
+		So(req.Sign(priv, chain), ShouldBeNil)
+		So(post(req, "/"+chain+"/"+nodeID).Body.String(), ShouldEqual, "ok")
+		nodes := get()
+		So(len(nodes), ShouldEqual, 1)
+		So(nodes[0].Req.NodeID, ShouldEqual, nodeID)
+		So(nodes[0].Req.Verify(chain), ShouldBeNil)
+	})
+}
+
+func TestFederation(t *testing.T) {
+	var err error
+	store, err = buntdb.Open(":memory:")
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+	store.CreateIndex("chain", "*", buntdb.IndexJSON("HID"))
+	peers = []string{"127.0.0.1:3143"}
+	defer func() { peers = nil }()
+
+	priv, _, _ := ic.GenerateEd25519Key(rand.Reader)
+	id, _ := peer.IDFromPrivateKey(priv)
+	nodeID := peer.IDB58Encode(id)
+	chain := "QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuU2"
+	req := holo.BSReq{Version: holo.BSReqVersion, NodeID: nodeID, NodeAddr: "/ip4/10.0.0.5/tcp/1234", Time: time.Now()}
+	if err = req.Sign(priv, chain); err != nil {
+		panic(err)
+	}
+	b, _ := json.Marshal(req)
+
+	forwarded := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/"+chain+"/"+nodeID, bytes.NewBuffer(b))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set(ForwardedRemoteHeader, "10.0.0.5:4321")
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	Convey("it should only accept forwarded registrations from peer servers", t, func() {
+		So(forwarded("192.0.2.1:5555").Code, ShouldEqual, http.StatusBadRequest)
+		So(forwarded("127.0.0.1:5555").Body.String(), ShouldEqual, "ok")
+	})
+
+	Convey("it should keep the node's address from a forwarded registration", t, func() {
+		nodes, err := liveNodes()
+		So(err, ShouldBeNil)
+		So(len(nodes), ShouldEqual, 1)
+		So(nodes[0].Remote, ShouldEqual, "10.0.0.5:4321")
+		So(nodes[0].HID, ShouldEqual, chain)
+	})
+
+	Convey("it should serve its registrations for peers to replicate", t, func() {
+		w := httptest.NewRecorder()
+		registrations(w, httptest.NewRequest("GET", "/_registrations", nil))
+		var nodes []Node
+		So(json.Unmarshal(w.Body.Bytes(), &nodes), ShouldBeNil)
+		So(len(nodes), ShouldEqual, 1)
+		So(nodes[0].Req.Verify(chain), ShouldBeNil)
+	})
+
+	Convey("it should not replace a registration with an older one", t, func() {
+		older := Node{Req: req, Remote: "10.0.0.9:1", HID: chain}
+		older.Req.Time = req.Time.Add(-time.Second)
+		So(storeNode(&older), ShouldBeNil)
+		nodes, _ := liveNodes()
+		So(nodes[0].Remote, ShouldEqual, "10.0.0.5:4321")
+	})
+}
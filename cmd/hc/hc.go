@@ -36,6 +36,7 @@ func setupApp() (app *cli.App) {
 	app.Version = fmt.Sprintf("0.0.6 (holochain %s)", holo.VersionStr)
 
 	var force bool
+	var includePrivate bool
 	var root string
 	var service *holo.Service
 
@@ -309,6 +310,111 @@ func setupApp() (app *cli.App) {
 				return nil
 			},
 		},
+		{
+			Name:  "chain",
+			Usage: "export or import a signed archive of a chain",
+			Subcommands: []cli.Command{
+				{
+					Name:      "export",
+					ArgsUsage: "holochain-name archive-file",
+					Usage:     "export a chain to a signed archive file, redacting private entries",
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:        "includePrivate",
+							Usage:       "include the contents of private entries in the archive",
+							Destination: &includePrivate,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						h, err := getHolochain(c, service, "chain export")
+						if err != nil {
+							return err
+						}
+						if len(c.Args()) != 2 {
+							return errors.New("chain export: missing required archive-file argument")
+						}
+						if !h.Started() {
+							return errors.New("No data to export, chain not yet initialized.")
+						}
+						var buf bytes.Buffer
+						err = h.ExportChain(&buf, !includePrivate)
+						if err != nil {
+							return err
+						}
+						err = holo.WriteFile(buf.Bytes(), c.Args()[1])
+						if err == nil && verbose {
+							fmt.Printf("exported chain %s to %s\n", h.DNAHash(), c.Args()[1])
+						}
+						return err
+					},
+				},
+				{
+					Name:      "import",
+					ArgsUsage: "holochain-name archive-file",
+					Usage:     "restore a cloned or joined chain from a signed archive file",
+					Action: func(c *cli.Context) error {
+						h, err := getHolochain(c, service, "chain import")
+						if err != nil {
+							return err
+						}
+						if len(c.Args()) != 2 {
+							return errors.New("chain import: missing required archive-file argument")
+						}
+						f, err := os.Open(c.Args()[1])
+						if err != nil {
+							return err
+						}
+						defer f.Close()
+						err = h.ImportChain(f)
+						if err == nil && verbose {
+							fmt.Printf("imported chain %s from %s\n", h.DNAHash(), c.Args()[1])
+						}
+						return err
+					},
+				},
+			},
+		},
+		{
+			Name:      "migrate",
+			ArgsUsage: "old-holochain-name new-holochain-name",
+			Usage:     "migrate chain entries to a holochain whose DNA is based on the old one",
+			Action: func(c *cli.Context) error {
+				old, err := getHolochain(c, service, "migrate")
+				if err != nil {
+					return err
+				}
+				if len(c.Args()) != 2 {
+					return errors.New("migrate: missing required new-holochain-name argument")
+				}
+				if !old.Started() {
+					return errors.New("No data to migrate, chain not yet initialized.")
+				}
+				name := c.Args()[1]
+				h, err := service.Load(name)
+				if err != nil {
+					return err
+				}
+				if !h.Started() {
+					err = genChain(service, name)
+					if err != nil {
+						return err
+					}
+					h, err = service.Load(name)
+					if err != nil {
+						return err
+					}
+				}
+				err = h.Activate()
+				if err != nil {
+					return err
+				}
+				count, err := h.Migrate(old)
+				if err == nil && verbose {
+					fmt.Printf("migrated %d entries from %s to %s\n", count, old.DNAHash(), h.DNAHash())
+				}
+				return err
+			},
+		},
 		{
 			Name:      "dht",
 			ArgsUsage: "holochain-name",
@@ -323,6 +429,12 @@ func setupApp() (app *cli.App) {
 					return errors.New("No data to dump, chain not yet initialized.")
 				}
 				fmt.Printf("%v", h.DHT())
+				health, err := h.RoutingHealth()
+				if err != nil {
+					fmt.Printf("Routing table: %v\n", err)
+				} else {
+					fmt.Printf("%v", health)
+				}
 				return nil
 			},
 		},
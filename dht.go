@@ -43,6 +43,9 @@ type DHTConfig struct {
 	// DataEncryption : What are the options for encrypting data at rest in the dht.db that don't break db functionality? Is there really a point to trying to do this?
 
 	// MaxEntrySize : Sets the maximum allowable size of entries for this holochain
+
+	// DeletedRetention : (integer) Time period in seconds that deleted and modified entries are kept in the DHT before garbage collection drops them. Zero means they are kept forever.
+	DeletedRetention int
 }
 
 type gossipWithReq struct {
@@ -56,6 +59,7 @@ type DHT struct {
 	retryQueue chan *retry
 	retrying   chan bool
 	gossiping  chan bool
+	collecting chan bool
 	glog       *Logger // the gossip logger
 	dlog       *Logger // the dht logger
 	gossips    map[peer.ID]bool
@@ -278,7 +282,7 @@ func (dht *DHT) putKey(agent Agent) (err error) {
 	if err != nil {
 		return
 	}
-	if err = dht.put(dht.h.node.NewMessage(PUT_REQUEST, PutReq{H: keyHash}), KeyEntryType, keyHash, nodeID, pubKey, StatusLive); err != nil {
+	if err = dht.put(dht.h.node.NewMessage(PUT_REQUEST, PutReq{H: keyHash}), KeyEntryType, keyHash, nodeID, pubKey, StatusLive, time.Now()); err != nil {
 		return
 	}
 	return
@@ -289,7 +293,7 @@ func (dht *DHT) SetupDHT() (err error) {
 	x := ""
 	// put the holochain id so it always exists for linking
 	dna := dht.h.DNAHash()
-	err = dht.put(nil, DNAEntryType, dna, dht.h.nodeID, []byte(x), StatusLive)
+	err = dht.put(nil, DNAEntryType, dna, dht.h.nodeID, []byte(x), StatusLive, time.Now())
 	if err != nil {
 		return
 	}
@@ -315,16 +319,20 @@ func (dht *DHT) SetupDHT() (err error) {
 	if err != nil {
 		return
 	}
-	if err = dht.put(dht.h.node.NewMessage(PUT_REQUEST, PutReq{H: a}), AgentEntryType, a, dht.h.nodeID, b, StatusLive); err != nil {
+	if err = dht.put(dht.h.node.NewMessage(PUT_REQUEST, PutReq{H: a}), AgentEntryType, a, dht.h.nodeID, b, StatusLive, time.Now()); err != nil {
 		return
 	}
 
 	return
 }
 
-// put stores a value to the DHT store
+// put stores a value to the DHT store along with the time it was created, from which
+// its TTL is measured.  A creation time in the future is taken to be now.
 // N.B. This call assumes that the value has already been validated
-func (dht *DHT) put(m *Message, entryType string, key Hash, src peer.ID, value []byte, status int) (err error) {
+func (dht *DHT) put(m *Message, entryType string, key Hash, src peer.ID, value []byte, status int, created time.Time) (err error) {
+	if now := time.Now(); created.After(now) {
+		created = now
+	}
 	k := key.String()
 	dht.dlog.Logf("put %s=>%s", k, string(value))
 	err = dht.db.Update(func(tx *buntdb.Tx) error {
@@ -348,6 +356,10 @@ func (dht *DHT) put(m *Message, entryType string, key Hash, src peer.ID, value [
 		if err != nil {
 			return err
 		}
+		_, _, err = tx.Set("time:"+k, gcTime(created), nil)
+		if err != nil {
+			return err
+		}
 		return err
 	})
 	return
@@ -372,6 +384,10 @@ func _setStatus(tx *buntdb.Tx, m *Message, key string, status int) (err error) {
 	if err != nil {
 		return
 	}
+	_, _, err = tx.Set("changed:"+key, gcTime(time.Now()), nil)
+	if err != nil {
+		return
+	}
 	return
 }
 
@@ -856,6 +872,12 @@ func (dht *DHT) Close() {
 		dht.retrying = nil
 		stop <- true
 	}
+	if dht.collecting != nil {
+		Debug("Stopping garbage collection")
+		stop := dht.collecting
+		dht.collecting = nil
+		stop <- true
+	}
 	close(dht.retryQueue)
 	close(dht.gchan)
 }
@@ -85,7 +85,7 @@ func TestPutGetModDel(t *testing.T) {
 	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
 	var idx int
 	Convey("It should store and retrieve", t, func() {
-		err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "someType", hash, id, []byte("some value"), StatusLive)
+		err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: hash}), "someType", hash, id, []byte("some value"), StatusLive, time.Now())
 		So(err, ShouldBeNil)
 		idx, _ = dht.GetIdx()
 
@@ -187,7 +187,7 @@ func TestLinking(t *testing.T) {
 	})
 
 	var id peer.ID
-	err = dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: base}), "someType", base, id, []byte("some value"), StatusLive)
+	err = dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: base}), "someType", base, id, []byte("some value"), StatusLive, time.Now())
 	if err != nil {
 		panic(err)
 	}
@@ -796,10 +796,10 @@ func TestDHTRetry(t *testing.T) {
 		h.NewEntry(time.Now(), "profile", &e)
 		h.NewEntry(time.Now(), "profile", &e2)
 		m = h.node.NewMessage(PUT_REQUEST, PutReq{H: hash})
-		err = h.dht.put(m, "profile", hash, h.nodeID, []byte(d1), StatusLive)
+		err = h.dht.put(m, "profile", hash, h.nodeID, []byte(d1), StatusLive, time.Now())
 		So(err, ShouldBeNil)
 		m = h.node.NewMessage(PUT_REQUEST, PutReq{H: hash2})
-		err = h.dht.put(m, "profile", hash2, h.nodeID, []byte(d2), StatusLive)
+		err = h.dht.put(m, "profile", hash2, h.nodeID, []byte(d2), StatusLive, time.Now())
 		So(err, ShouldBeNil)
 
 		_, _, _, status, _ := h.dht.get(hash, StatusAny, GetMaskAll)
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	golog "log"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -62,6 +63,21 @@ func getDialableListenAddrs(ph host.Host) ([]*net.TCPAddr, error) {
 	return out, nil
 }
 
+// getOtherTransportAddrs returns the host's addresses for transports other than plain TCP,
+// such as WebSocket, which are advertised in the TXT record
+func getOtherTransportAddrs(ph host.Host) (out []string) {
+	for _, addr := range ph.Addrs() {
+		if _, err := manet.ToNetAddr(addr); err == nil {
+			continue
+		}
+		if strings.Contains(addr.String(), "/p2p-circuit") {
+			continue
+		}
+		out = append(out, addr.String())
+	}
+	return
+}
+
 func NewMdnsService(ctx context.Context, peerhost host.Host, interval time.Duration, serviceTag string) (Service, error) {
 
 	// TODO: dont let mdns use logging...
@@ -82,7 +98,7 @@ func NewMdnsService(ctx context.Context, peerhost host.Host, interval time.Durat
 
 	myid := peerhost.ID().Pretty()
 
-	info := []string{myid}
+	info := append([]string{myid}, getOtherTransportAddrs(peerhost)...)
 	if serviceTag == "" {
 		serviceTag = ServiceTag
 	}
@@ -150,7 +166,9 @@ func (m *mdnsService) pollForEntries(ctx context.Context) {
 
 func (m *mdnsService) handleEntry(e *mdns.ServiceEntry) {
 	log.Debugf("Handling MDNS entry: %s:%d %s", e.AddrV4, e.Port, e.Info)
-	mpeer, err := peer.IDB58Decode(e.Info)
+	// the TXT record holds the peer ID followed by any addresses for other transports
+	info := strings.Split(e.Info, "|")
+	mpeer, err := peer.IDB58Decode(info[0])
 	if err != nil {
 		log.Warning("Error parsing peer ID from mdns entry: ", err)
 		return
@@ -174,6 +192,14 @@ func (m *mdnsService) handleEntry(e *mdns.ServiceEntry) {
 		ID:    mpeer,
 		Addrs: []ma.Multiaddr{maddr},
 	}
+	for _, s := range info[1:] {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			log.Warning("Error parsing transport multiaddr from mdns entry: ", err)
+			continue
+		}
+		pi.Addrs = append(pi.Addrs, addr)
+	}
 
 	m.lk.Lock()
 	for _, n := range m.notifees {
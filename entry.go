@@ -7,11 +7,15 @@
 package holochain
 
 import (
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"github.com/lestrrat/go-jsval"
 	. "github.com/metacurrency/holochain/hash"
+	"github.com/ugorji/go/codec"
 	"io"
+	"reflect"
 	"strings"
 )
 
@@ -21,20 +25,24 @@ const (
 
 	// System defined entry types
 
-	DNAEntryType   = SysEntryTypePrefix + "dna"
-	AgentEntryType = SysEntryTypePrefix + "agent"
-	KeyEntryType   = VirtualEntryTypePrefix + "key" // virtual entry type, not actually on the chain
+	DNAEntryType      = SysEntryTypePrefix + "dna"
+	AgentEntryType    = SysEntryTypePrefix + "agent"
+	ManifestEntryType = SysEntryTypePrefix + "manifest"
+	KeyEntryType      = VirtualEntryTypePrefix + "key" // virtual entry type, not actually on the chain
 
 	// Entry type formats
 
-	DataFormatLinks    = "links"
-	DataFormatJSON     = "json"
-	DataFormatString   = "string"
-	DataFormatRawJS    = "js"
-	DataFormatRawZygo  = "zygo"
-	DataFormatSysDNA   = "_DNA"
-	DataFormatSysAgent = "_agent"
-	DataFormatSysKey   = "_key"
+	DataFormatLinks       = "links"
+	DataFormatJSON        = "json"
+	DataFormatString      = "string"
+	DataFormatRawJS       = "js"
+	DataFormatRawZygo     = "zygo"
+	DataFormatBytes       = "bytes" // raw binary data carried natively as []byte
+	DataFormatCBOR        = "cbor"  // structured data carried as CBOR encoded []byte
+	DataFormatSysDNA      = "_DNA"
+	DataFormatSysAgent    = "_agent"
+	DataFormatSysKey      = "_key"
+	DataFormatSysManifest = "_manifest"
 
 	// Entry sharing types
 
@@ -71,16 +79,20 @@ type DelEntry struct {
 
 // EntryDef struct holds an entry definition
 type EntryDef struct {
-	Name       string
-	DataFormat string
-	Sharing    string
-	Schema     string
-	validator  SchemaValidator
+	Name          string
+	DataFormat    string
+	Sharing       string
+	Schema        string
+	SchemaVersion int // incremented when the schema changes, see Holochain.Migrate
+	ChunkSize     int // if set, larger bytes entries are committed as chunks of at most this size
+	TTL           int // if set, seconds after their creation that entries of this type are dropped from the DHT
+	validator     SchemaValidator
 }
 
 var DNAEntryDef = &EntryDef{Name: DNAEntryType, DataFormat: DataFormatSysDNA}
 var AgentEntryDef = &EntryDef{Name: AgentEntryType, DataFormat: DataFormatSysAgent}
 var KeyEntryDef = &EntryDef{Name: KeyEntryType, DataFormat: DataFormatSysKey}
+var ManifestEntryDef = &EntryDef{Name: ManifestEntryType, DataFormat: DataFormatSysManifest, Sharing: Public}
 
 // Entry describes serialization and deserialziation of entry data
 type Entry interface {
@@ -105,6 +117,12 @@ type JSONEntry struct {
 	C interface{}
 }
 
+var cborHandle = func() *codec.CborHandle {
+	h := &codec.CborHandle{}
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return h
+}()
+
 // IsSysEntry returns true if the entry type is system defined
 func (def *EntryDef) IsSysEntry() bool {
 	return strings.HasPrefix(def.Name, SysEntryTypePrefix)
@@ -224,3 +242,74 @@ func (d *EntryDef) BuildJSONSchemaValidatorFromString(schema string) (err error)
 	d.validator = validator
 	return
 }
+
+// EncodeCBOR encodes a value as CBOR
+func EncodeCBOR(v interface{}) (b []byte, err error) {
+	err = codec.NewEncoderBytes(&b, cborHandle).Encode(v)
+	return
+}
+
+// DecodeCBOR decodes CBOR data into a value
+func DecodeCBOR(b []byte, v interface{}) (err error) {
+	err = codec.NewDecoderBytes(b, cborHandle).Decode(v)
+	return
+}
+
+// CBORToJSON converts CBOR encoded data to JSON
+func CBORToJSON(b []byte) (j string, err error) {
+	var v interface{}
+	if err = DecodeCBOR(b, &v); err != nil {
+		return
+	}
+	var jb []byte
+	jb, err = json.Marshal(v)
+	if err == nil {
+		j = string(jb)
+	}
+	return
+}
+
+// JSONToCBOR converts JSON to CBOR encoded data
+func JSONToCBOR(j string) (b []byte, err error) {
+	var v interface{}
+	if err = json.Unmarshal([]byte(j), &v); err != nil {
+		return
+	}
+	b, err = EncodeCBOR(v)
+	return
+}
+
+// ContentString returns the content of an entry of this type as the string passed
+// to ribosomes, i.e. bytes entries are base64 encoded and cbor entries become JSON
+func (def *EntryDef) ContentString(entry Entry) (s string, err error) {
+	switch content := entry.Content().(type) {
+	case string:
+		s = content
+	case []byte:
+		switch def.DataFormat {
+		case DataFormatBytes:
+			s = base64.StdEncoding.EncodeToString(content)
+		case DataFormatCBOR:
+			s, err = CBORToJSON(content)
+		default:
+			err = fmt.Errorf("bad type in entry content: %T:%v", content, content)
+		}
+	default:
+		err = fmt.Errorf("bad type in entry content: %T:%v", content, content)
+	}
+	return
+}
+
+// ContentFromString is the inverse of ContentString, returning the entry content
+// for a string received from a ribosome
+func (def *EntryDef) ContentFromString(s string) (content interface{}, err error) {
+	switch def.DataFormat {
+	case DataFormatBytes:
+		content, err = base64.StdEncoding.DecodeString(s)
+	case DataFormatCBOR:
+		content, err = JSONToCBOR(s)
+	default:
+		content = s
+	}
+	return
+}
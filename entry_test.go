@@ -113,3 +113,53 @@ func TestMarshalEntry(t *testing.T) {
 		So(fmt.Sprintf("%v", ne), ShouldEqual, fmt.Sprintf("%v", &e))
 	})
 }
+
+func TestCBOR(t *testing.T) {
+	Convey("it should round-trip between JSON and CBOR", t, func() {
+		b, err := JSONToCBOR(`{"name":"Eric","tags":["a","b"]}`)
+		So(err, ShouldBeNil)
+		j, err := CBORToJSON(b)
+		So(err, ShouldBeNil)
+		So(j, ShouldEqual, `{"name":"Eric","tags":["a","b"]}`)
+	})
+
+	Convey("it should fail on bad CBOR", t, func() {
+		_, err := CBORToJSON([]byte{0xbf})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestEntryDefContentString(t *testing.T) {
+	Convey("bytes entries should be base64 encoded", t, func() {
+		def := EntryDef{Name: "blob", DataFormat: DataFormatBytes}
+		s, err := def.ContentString(&GobEntry{C: []byte("hello")})
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, "aGVsbG8=")
+		c, err := def.ContentFromString(s)
+		So(err, ShouldBeNil)
+		So(c, ShouldResemble, []byte("hello"))
+		_, err = def.ContentFromString("not base64!")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("cbor entries should be converted to JSON", t, func() {
+		def := EntryDef{Name: "record", DataFormat: DataFormatCBOR}
+		c, err := def.ContentFromString(`{"a":"b"}`)
+		So(err, ShouldBeNil)
+		s, err := def.ContentString(&GobEntry{C: c})
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, `{"a":"b"}`)
+	})
+
+	Convey("other entries should be passed through", t, func() {
+		def := EntryDef{Name: "profile", DataFormat: DataFormatJSON}
+		s, err := def.ContentString(&GobEntry{C: `{"a":"b"}`})
+		So(err, ShouldBeNil)
+		So(s, ShouldEqual, `{"a":"b"}`)
+		c, err := def.ContentFromString(s)
+		So(err, ShouldBeNil)
+		So(c, ShouldEqual, `{"a":"b"}`)
+		_, err = def.ContentString(&GobEntry{C: 1})
+		So(err, ShouldNotBeNil)
+	})
+}
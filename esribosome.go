@@ -0,0 +1,619 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// ESRibosome implements a modern (ES2015+) javascript use of the Ribosome interface
+//
+// Zome code may use arrow functions, let/const, classes, template strings, promises and
+// async functions.  The host API is the same as that of the js ribosome except that the
+// functions which may have to go to the network (get, getLinks, send, call and bridge)
+// return promises.  Their actions run on other goroutines while the VM runs an event loop
+// that settles the promises, and every zome function, validation function and callback may
+// itself return a promise which is awaited.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dop251/goja"
+	. "github.com/metacurrency/holochain/hash"
+	"strings"
+	"time"
+)
+
+const (
+	ESRibosomeType = "es"
+)
+
+var ErrESPromiseNeverSettles = errors.New("promise can never be settled")
+
+// esAsyncFns are the host functions that return promises
+var esAsyncFns = map[string]bool{"get": true, "getLinks": true, "send": true, "call": true, "bridge": true}
+
+// ESRibosome holds data needed for the ES2015+ Javascript VM
+type ESRibosome struct {
+	validationContext
+	h           *Holochain
+	zome        *Zome
+	vm          *goja.Runtime
+	parseJSON   goja.Callable
+	stringify   goja.Callable
+	pending     int           // the number of host actions whose promises are unsettled
+	settled     chan func()   // the settling of host action promises, run on the VM's goroutine
+	dropped     chan struct{} // closed when the VM stops waiting on its host actions
+	interrupted chan struct{} // closed when the time limit is reached
+	lastResult  goja.Value
+}
+
+// esPrograms caches compiled zome code so that new VMs don't have to parse it again
+var esPrograms = newCodeCache()
+
+// esCompile returns the compiled program for some zome code
+func esCompile(code string) (program *goja.Program, err error) {
+	var compiled interface{}
+	compiled, err = esPrograms.get(code, func() (interface{}, error) {
+		return goja.Compile("", code, false)
+	})
+	if err == nil {
+		program = compiled.(*goja.Program)
+	}
+	return
+}
+
+// Type returns the string value under which this ribosome is registered
+func (r *ESRibosome) Type() string { return ESRibosomeType }
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (r *ESRibosome) ChainGenesis() (err error) {
+	err = r.boolFn("genesis")
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (r *ESRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	err = r.boolFn("bridgeGenesis", r.vm.ToValue(side), r.vm.ToValue(dnaHash.String()), r.vm.ToValue(data))
+	return
+}
+
+func (r *ESRibosome) boolFn(fnName string, args ...goja.Value) (err error) {
+	var v goja.Value
+	v, err = r.call(fnName, args...)
+	if err != nil {
+		err = execErr(fnName, err)
+		return
+	}
+	b, ok := v.Export().(bool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+	} else if !b {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (r *ESRibosome) Receive(from string, msg string) (response string, err error) {
+	fnName := "receive"
+	var m, v goja.Value
+	m, err = r.parse(msg)
+	if err == nil {
+		v, err = r.call(fnName, r.vm.ToValue(from), m)
+	}
+	if err == nil {
+		v, err = r.stringify(goja.Undefined(), v)
+	}
+	if err != nil {
+		err = execErr(fnName, err)
+		return
+	}
+	response = v.String()
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (r *ESRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	r.startValidation(action)
+	defer func() {
+		err = r.endValidation(err)
+		if err != nil {
+			req = nil
+		}
+	}()
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	var v goja.Value
+	v, err = r.call(fnName, r.vm.ToValue(def.Name))
+	if err != nil {
+		err = execErr(fnName, err)
+		return
+	}
+	if goja.IsNull(v) {
+		return
+	}
+	m, ok := v.Export().(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("%s should return null or object, got: %v", fnName, v)
+		return
+	}
+	req = m
+	return
+}
+
+// ValidateAction builds the correct validation function based on the action an calls it
+func (r *ESRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	r.startValidation(action)
+	defer func() { err = r.endValidation(err) }()
+	fnName := "validate" + strings.Title(action.Name())
+	var args []interface{}
+	args, err = prepareJSONValidateArgs(action, def)
+	if err != nil {
+		return
+	}
+	pkgObj := make(map[string]interface{})
+	if pkg != nil && pkg.Chain != nil {
+		pkgObj["Chain"] = pkg.Chain
+	}
+	args = append(append([]interface{}{def.Name}, args...), pkgObj, sources)
+	_, isDel := action.(*ActionDel)
+	_, isLink := action.(*ActionLink)
+	if def.DataFormat == DataFormatRawJS && !isDel && !isLink {
+		// raw javascript entries are evaluated rather than passed as strings
+		var e goja.Value
+		e, err = r.run("(" + args[1].(string) + ")")
+		if err != nil {
+			return
+		}
+		args[1] = e.Export()
+	}
+	values := make([]goja.Value, len(args))
+	for i, arg := range args {
+		values[i], err = r.toJS(arg)
+		if err != nil {
+			return
+		}
+	}
+	Debugf("%s: %s", fnName, def.Name)
+	var v goja.Value
+	v, err = r.call(fnName, values...)
+	if err != nil {
+		err = execErr(fnName, err)
+		return
+	}
+	b, ok := v.Export().(bool)
+	if !ok {
+		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+	} else if !b {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// Call calls the javascript function that was registered with expose, awaiting its result
+// if it returns a promise
+func (r *ESRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	p, ok := params.(string)
+	if !ok {
+		err = fmt.Errorf("expecting string params, got: %T", params)
+		return
+	}
+	Debugf("ES Call: %s(%s)", fn.Name, p)
+	var v goja.Value
+	switch fn.CallingType {
+	case STRING_CALLING:
+		v, err = r.call(fn.Name, r.vm.ToValue(p))
+	case JSON_CALLING:
+		if p == "" {
+			v, err = r.call(fn.Name)
+		} else {
+			var arg goja.Value
+			arg, err = r.parse(p)
+			if err != nil {
+				return
+			}
+			v, err = r.call(fn.Name, arg)
+		}
+		if err == nil && !esIsError(v) {
+			v, err = r.stringify(goja.Undefined(), v)
+		}
+	default:
+		err = errors.New("params type not implemented")
+		return
+	}
+	if err == nil {
+		if esIsError(v) {
+			err = errors.New(v.ToObject(r.vm).Get("message").String())
+		} else {
+			result = v.String()
+		}
+	}
+	return
+}
+
+// Run executes javascript code
+func (r *ESRibosome) Run(code string) (result interface{}, err error) {
+	var v goja.Value
+	v, err = r.limited(func() (v goja.Value, err error) {
+		v, err = r.vm.RunString(code)
+		if err != nil {
+			return
+		}
+		v, err = r.await(v)
+		return
+	})
+	if err != nil {
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("ES exec error: " + err.Error())
+		}
+		return
+	}
+	r.lastResult = v
+	result = v
+	return
+}
+
+// RunAsyncSendResponse calls the callback function with the response of an asynchronous send
+func (r *ESRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	Debugf("Calling %s(%s,%s)\n", callback, response.Body, callbackID)
+	var body, v goja.Value
+	body, err = r.parse(response.Body)
+	if err != nil {
+		return
+	}
+	v, err = r.call(callback, body, r.vm.ToValue(callbackID))
+	if err != nil {
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("ES exec error: " + err.Error())
+		}
+		return
+	}
+	r.lastResult = v
+	result = v
+	return
+}
+
+// Reset builds a new VM from the cached zome program, as goja VMs can't be copied
+func (r *ESRibosome) Reset() (err error) {
+	r.lastResult = nil
+	err = r.load()
+	return
+}
+
+// esIsError reports whether a value is a javascript Error object
+func esIsError(v goja.Value) bool {
+	o, ok := v.(*goja.Object)
+	return ok && o.ClassName() == "Error"
+}
+
+// mkErr makes the HolochainError object that host functions return or reject with
+func (r *ESRibosome) mkErr(err error) goja.Value {
+	o, e := r.vm.New(r.vm.Get("Error"), r.vm.ToValue(err.Error()))
+	if e != nil {
+		return r.vm.NewGoError(err)
+	}
+	o.Set("name", "HolochainError")
+	return o
+}
+
+// parse converts JSON text into a javascript value
+func (r *ESRibosome) parse(j string) (goja.Value, error) {
+	return r.parseJSON(goja.Undefined(), r.vm.ToValue(j))
+}
+
+// toJS converts a Go value into a javascript value by way of JSON
+func (r *ESRibosome) toJS(v interface{}) (value goja.Value, err error) {
+	var j []byte
+	j, err = json.Marshal(v)
+	if err != nil {
+		return
+	}
+	value, err = r.parse(string(j))
+	return
+}
+
+// hostArgs converts the arguments of a host function call into the decoded JSON values
+// the host functions take
+func (r *ESRibosome) hostArgs(call goja.FunctionCall) (args []interface{}, err error) {
+	a := call.Arguments
+	// trailing undefined arguments are just left out optional ones
+	for len(a) > 0 && goja.IsUndefined(a[len(a)-1]) {
+		a = a[:len(a)-1]
+	}
+	var j goja.Value
+	j, err = r.stringify(goja.Undefined(), r.vm.NewArray(esValues(a)...))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(j.String()), &args)
+	return
+}
+
+func esValues(values []goja.Value) []interface{} {
+	items := make([]interface{}, len(values))
+	for i, v := range values {
+		items[i] = v
+	}
+	return items
+}
+
+// hostFn wraps a host API function that completes before returning to the VM
+func (r *ESRibosome) hostFn(name string, fn jsonHostFn) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		args, err := r.hostArgs(call)
+		if err != nil {
+			return r.mkErr(err)
+		}
+		result, err := fn(args)
+		if err != nil {
+			return r.mkErr(err)
+		}
+		if name == "updateAgent" {
+			// the agent's hashes and maybe its identity have changed
+			if _, err = r.vm.RunString(jsAppVars(r.h)); err != nil {
+				return r.mkErr(err)
+			}
+		}
+		v, err := r.toJS(result)
+		if err != nil {
+			return r.mkErr(err)
+		}
+		return v
+	}
+}
+
+// restrictedFn wraps a host API function so that it fails during validation if it is
+// nondeterministic, before any promise is made
+func (r *ESRibosome) restrictedFn(name string, fn func(goja.FunctionCall) goja.Value) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		if err := r.checkCall(name); err != nil {
+			return r.mkErr(err)
+		}
+		return fn(call)
+	}
+}
+
+// asyncHostFn wraps a host API function so that its action runs on another goroutine and a
+// promise of its result is returned to the VM
+func (r *ESRibosome) asyncHostFn(fn jsonHostFn) func(goja.FunctionCall) goja.Value {
+	return func(call goja.FunctionCall) goja.Value {
+		promise, resolve, reject := r.vm.NewPromise()
+		args, err := r.hostArgs(call)
+		if err != nil {
+			reject(r.mkErr(err))
+			return r.vm.ToValue(promise)
+		}
+		r.pending++
+		settled, dropped := r.settled, r.dropped
+		go func() {
+			result, err := fn(args)
+			settle := func() {
+				var v goja.Value
+				if err == nil {
+					v, err = r.toJS(result)
+				}
+				if err != nil {
+					reject(r.mkErr(err))
+				} else {
+					resolve(v)
+				}
+			}
+			select {
+			case settled <- settle:
+			case <-dropped:
+			}
+		}()
+		return r.vm.ToValue(promise)
+	}
+}
+
+// await runs the event loop until all host actions have settled and returns the value, or
+// the result of the promise, that javascript code returned
+func (r *ESRibosome) await(v goja.Value) (result goja.Value, err error) {
+	for r.pending > 0 {
+		select {
+		case settle := <-r.settled:
+			r.pending--
+			// calling into the VM runs the promise jobs that settling queues
+			var run goja.Callable
+			run, _ = goja.AssertFunction(r.vm.ToValue(func(goja.FunctionCall) goja.Value {
+				settle()
+				return goja.Undefined()
+			}))
+			if _, err = run(goja.Undefined()); err != nil {
+				return
+			}
+		case <-r.interrupted:
+			err = &ExecLimitErr{Limit: "time", Value: execLimits(r.h).Timeout}
+			return
+		}
+	}
+	result = v
+	if o, ok := v.(*goja.Object); ok {
+		if p, ok := o.Export().(*goja.Promise); ok {
+			switch p.State() {
+			case goja.PromiseStateFulfilled:
+				result = p.Result()
+			case goja.PromiseStateRejected:
+				rejection := p.Result()
+				if esIsError(rejection) {
+					err = errors.New(rejection.ToObject(r.vm).Get("message").String())
+				} else {
+					err = fmt.Errorf("promise rejected with: %v", rejection)
+				}
+			default:
+				err = ErrESPromiseNeverSettles
+			}
+		}
+	}
+	return
+}
+
+// dropPending stops waiting on unsettled host actions, their promises are never settled
+func (r *ESRibosome) dropPending() {
+	if r.dropped != nil {
+		close(r.dropped)
+	}
+	r.pending = 0
+	r.settled = make(chan func())
+	r.dropped = make(chan struct{})
+}
+
+// limited runs fn within the ribosome's execution limits
+func (r *ESRibosome) limited(fn func() (goja.Value, error)) (v goja.Value, err error) {
+	limits := execLimits(r.h)
+	if limits.Timeout > 0 {
+		interrupted := make(chan struct{})
+		r.interrupted = interrupted
+		timer := time.AfterFunc(time.Duration(limits.Timeout)*time.Millisecond, func() {
+			r.vm.Interrupt(&ExecLimitErr{Limit: "time", Value: limits.Timeout})
+			close(interrupted)
+		})
+		defer func() {
+			timer.Stop()
+			r.vm.ClearInterrupt()
+			r.interrupted = nil
+		}()
+	}
+	v, err = fn()
+	switch err.(type) {
+	case *goja.InterruptedError:
+		err = &ExecLimitErr{Limit: "time", Value: limits.Timeout}
+	case *goja.StackOverflowError:
+		err = &ExecLimitErr{Limit: "stack depth", Value: limits.StackDepth}
+	}
+	if err != nil && r.pending > 0 {
+		r.dropPending()
+	}
+	return
+}
+
+// call calls the named javascript function and awaits its result
+func (r *ESRibosome) call(fnName string, args ...goja.Value) (goja.Value, error) {
+	return r.limited(func() (v goja.Value, err error) {
+		fn, ok := goja.AssertFunction(r.vm.Get(fnName))
+		if !ok {
+			err = fmt.Errorf("%s is not a function", fnName)
+			return
+		}
+		v, err = fn(goja.Undefined(), args...)
+		if err != nil {
+			return
+		}
+		v, err = r.await(v)
+		return
+	})
+}
+
+// run executes javascript code
+func (r *ESRibosome) run(code string) (goja.Value, error) {
+	return r.limited(func() (goja.Value, error) {
+		return r.vm.RunString(code)
+	})
+}
+
+// setDeterminism replaces Date and Math.random, see JSDeterminism.  The originals are taken
+// from the VM before any other code has run.
+func (r *ESRibosome) setDeterminism() (err error) {
+	date := r.vm.Get("Date")
+	random := r.vm.Get("Math").ToObject(r.vm).Get("random")
+	var v goja.Value
+	if v, err = r.vm.RunString(JSDeterminism); err != nil {
+		return
+	}
+	fn, _ := goja.AssertFunction(v)
+	_, err = fn(goja.Undefined(), r.vm.GlobalObject(), date, random, r.vm.ToValue(func(call goja.FunctionCall) goja.Value {
+		return r.vm.ToValue(r.jsDeterministic(call.Argument(0).String()))
+	}))
+	return
+}
+
+// load builds the VM with the host API and runs the zome code in it
+func (r *ESRibosome) load() (err error) {
+	r.vm = goja.New()
+	r.dropPending()
+	if limits := execLimits(r.h); limits.StackDepth > 0 {
+		r.vm.SetMaxCallStackSize(limits.StackDepth)
+	}
+	j := r.vm.Get("JSON").ToObject(r.vm)
+	r.parseJSON, _ = goja.AssertFunction(j.Get("parse"))
+	r.stringify, _ = goja.AssertFunction(j.Get("stringify"))
+	if err = r.setDeterminism(); err != nil {
+		return
+	}
+
+	if r.h != nil {
+		for name, fn := range jsonHostFns(r.h, r.zome) {
+			if esAsyncFns[name] {
+				err = r.vm.Set(name, r.restrictedFn(name, r.asyncHostFn(fn)))
+			} else {
+				err = r.vm.Set(name, r.restrictedFn(name, r.hostFn(name, fn)))
+			}
+			if err != nil {
+				return
+			}
+		}
+		err = r.vm.Set("hcModule", func(call goja.FunctionCall) goja.Value {
+			lib, err := zomeModule(r.h, call.Argument(0).String(), ESRibosomeType)
+			if err != nil {
+				return r.mkErr(err)
+			}
+			return r.vm.ToValue(map[string]string{"Name": lib.Name, "Code": lib.Code})
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = r.vm.RunString(JSLibrary + JSRequire + jsAppVars(r.h))
+	if err != nil {
+		return
+	}
+	if lib := zomeLibraryCode(r.h, ESRibosomeType); lib != "" {
+		if _, err = r.runProgram(lib); err != nil {
+			if _, ok := err.(*ExecLimitErr); !ok {
+				err = errors.New("ES library error: " + err.Error())
+			}
+			return
+		}
+	}
+	r.lastResult, err = r.runProgram(r.zome.Code)
+	if err != nil {
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("ES exec error: " + err.Error())
+		}
+	}
+	return
+}
+
+// runProgram runs code that has been compiled and cached
+func (r *ESRibosome) runProgram(code string) (v goja.Value, err error) {
+	var program *goja.Program
+	program, err = esCompile(code)
+	if err != nil {
+		return
+	}
+	v, err = r.limited(func() (v goja.Value, err error) {
+		v, err = r.vm.RunProgram(program)
+		if err != nil {
+			return
+		}
+		v, err = r.await(v)
+		return
+	})
+	return
+}
+
+// NewESRibosome factory function to build an ES2015+ javascript execution environment for a zome
+func NewESRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	r := ESRibosome{
+		h:    h,
+		zome: zome,
+	}
+	err = r.load()
+	if err != nil {
+		return
+	}
+	n = &r
+	return
+}
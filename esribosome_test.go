@@ -0,0 +1,150 @@
+package holochain
+
+import (
+	"github.com/dop251/goja"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestNewESRibosome(t *testing.T) {
+	Convey("new should create a ribosome that runs ES2015 code", t, func() {
+		v, err := NewESRibosome(nil, &Zome{RibosomeType: ESRibosomeType, Code: `
+class Doubler { double(x) { return x * 2 } }
+const d = new Doubler();
+let f = (x) => d.double(x);
+f(21)`})
+		So(err, ShouldBeNil)
+		z := v.(*ESRibosome)
+		So(z.lastResult.ToInteger(), ShouldEqual, 42)
+	})
+	Convey("new should fail to create ribosome when code is bad", t, func() {
+		v, err := NewESRibosome(nil, &Zome{RibosomeType: ESRibosomeType, Code: "\n1+ )"})
+		So(v, ShouldBeNil)
+		So(err.Error(), ShouldStartWith, "ES exec error:")
+	})
+	Convey("it should have the App and HC structures", t, func() {
+		d, _, h := PrepareTestChain("test")
+		defer CleanupTestChain(h, d)
+
+		v, err := NewESRibosome(h, &Zome{RibosomeType: ESRibosomeType})
+		So(err, ShouldBeNil)
+		r, err := v.Run("`${App.Name}:${HC.Version}`")
+		So(err, ShouldBeNil)
+		So(r.(goja.Value).String(), ShouldEqual, h.Name()+":"+VersionStr)
+	})
+	Convey("the code file name should have the es extension", t, func() {
+		z := Zome{Name: "myZome", RibosomeType: ESRibosomeType}
+		So(z.CodeFileName(), ShouldEqual, "myZome.es")
+	})
+}
+
+func TestESPromises(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	zome := &Zome{Name: "esZome", RibosomeType: ESRibosomeType, Code: `
+function genesis() { return true }
+const addOdd = async (x) => {
+  const hash = commit("oddNumbers", x);
+  return await get(hash, {Local: true});
+};
+async function getBad() { return await get("not a hash") }
+function notAsync() { return get(App.DNA.Hash, {Local: true}) instanceof Promise ? "promise" : "value" }
+const validateCommit = (type, entry, header, pkg, sources) => Promise.resolve(entry % 2 == 1);
+let count = 0;
+function inc() { count++; return count }
+`}
+	v, err := NewESRibosome(h, zome)
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*ESRibosome)
+
+	Convey("async host functions should return promises", t, func() {
+		result, err := z.Call(&FunctionDef{Name: "notAsync", CallingType: STRING_CALLING}, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "promise")
+	})
+
+	Convey("exposed functions may be async", t, func() {
+		result, err := z.Call(&FunctionDef{Name: "addOdd", CallingType: STRING_CALLING}, "3")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "3")
+	})
+
+	Convey("host errors should reject the promise", t, func() {
+		_, err := z.Call(&FunctionDef{Name: "getBad", CallingType: STRING_CALLING}, "")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("validation functions may return promises", t, func() {
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "3"})
+		a.header = &Header{}
+		So(z.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldBeNil)
+		a = NewCommitAction("oddNumbers", &GobEntry{C: "4"})
+		a.header = &Header{}
+		So(z.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldEqual, ValidationFailedErr)
+	})
+
+	Convey("reset should start over from the zome code", t, func() {
+		result, err := z.Call(&FunctionDef{Name: "inc", CallingType: STRING_CALLING}, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "1")
+		So(z.Reset(), ShouldBeNil)
+		result, err = z.Call(&FunctionDef{Name: "inc", CallingType: STRING_CALLING}, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "1")
+	})
+
+	Convey("it should enforce the time limit", t, func() {
+		h.Config.ExecLimits.Timeout = 100
+		defer func() { h.Config.ExecLimits.Timeout = DefaultExecTimeout }()
+		_, err := z.Run("for(;;){}")
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "time", Value: 100})
+	})
+}
+
+func TestESDeterministicValidation(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewESRibosome(h, &Zome{RibosomeType: ESRibosomeType, Code: `
+const random = Math.random;
+const validateCommit = async (name, entry) => {
+  if (entry == "get") { await get(App.DNA.Hash) }
+  if (entry == "exit") { try { hcDeterminism.exit() } catch (e) {} try { Math.random() } catch (e) {} }
+  if (entry == "captured") { try { random() } catch (e) {} }
+  if (entry == "replaced") { Math.random = () => 0.5; try { Math.random() } catch (e) {} }
+  return Date.now() == 1000 && new (new Date(0).constructor)().getTime() == 1000
+};
+const restored = () => Date.now() > 1000 && Math.random() < 1;
+`})
+	if err != nil {
+		panic(err)
+	}
+	def := &EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+	hdr := mkTestHeader("evenNumbers")
+
+	Convey("validation should get the header's time and fail if it reaches the network", t, func() {
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		a.header = &hdr
+		So(v.ValidateAction(a, def, nil, nil), ShouldBeNil)
+		a = NewCommitAction("evenNumbers", &GobEntry{C: "get"})
+		a.header = &hdr
+		So(v.ValidateAction(a, def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "get"})
+		result, err := v.Call(&FunctionDef{Name: "restored", CallingType: STRING_CALLING}, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "true")
+	})
+
+	Convey("app code should not be able to get around the replaced Math.random", t, func() {
+		for _, entry := range []string{"exit", "captured", "replaced"} {
+			a := NewCommitAction("evenNumbers", &GobEntry{C: entry})
+			a.header = &hdr
+			So(v.ValidateAction(a, def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "Math.random"})
+		}
+		_, err := v.Run(`Object.defineProperty(Math, "random", {value: () => 0.5})`)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -290,25 +290,40 @@ function validateLink(linkEntryType,baseHash,links,pkg,sources){
     }
     return true;
 }
+// findReplaced returns the entry that a mod replaces if it is on the modifier's own chain,
+// which validateModPkg asks for in the validation package.  get can't be used here because
+// nodes validating the mod might not all get the same result.
+function findReplaced(entry_type,replaces,pkg) {
+    if (pkg.Chain == undefined || pkg.Chain.Entries == undefined) {return undefined;}
+    var headers = pkg.Chain.Headers;
+    var entries = pkg.Chain.Entries;
+    for (var i=1;i<entries.length;i++) {
+        if (headers[i].Type == entry_type && makeHash(entry_type,entries[i].C) == replaces) {
+            return entries[i].C;
+        }
+    }
+    return undefined;
+}
 function validateMod(entry_type,entry,header,replaces,pkg,sources) {
     debug("validate mod: "+entry_type+" header:"+JSON.stringify(header)+" replaces:"+JSON.stringify(replaces));
-    if (entry_type == "handle") {
-        // check that the source is the same as the creator
-        // TODO we could also check that the previous link in the type-chain is the replaces hash.
-        var orig_sources = get(replaces,{GetMask:HC.GetMask.Sources});
-        if (isErr(orig_sources) || orig_sources == undefined || orig_sources.length !=1 || orig_sources[0] != sources[0]) {return false;}
-
-    } else if (entry_type == "post") {
+    if (entry_type == "handle" || entry_type == "post") {
         // there must actually be a message
-        if (entry.message == "") return false;
-        var orig = get(replaces,{GetMask:HC.GetMask.Sources+HC.GetMask.Entry});
+        if (entry_type == "post" && entry.message == "") return false;
 
         // check that source is same as creator
-        if (orig.Sources.length !=1 || orig.Sources[0] != sources[0]) {return false;}
+        // TODO we could also check that the previous link in the type-chain is the replaces hash.
+        var orig = findReplaced(entry_type,replaces,pkg);
+        if (orig == undefined) {
+            // when committing there is no package, but the system validation has already
+            // checked that the original is on our own chain
+            return sources[0] == App.Key.Hash;
+        }
 
-        var orig_message = JSON.parse(orig.Entry).message;
-        // message must actually be different
-        return orig_message != entry.message;
+        if (entry_type == "post") {
+            var orig_message = JSON.parse(orig).message;
+            // message must actually be different
+            return orig_message != entry.message;
+        }
     }
     return true;
 }
@@ -324,6 +339,12 @@ function validateDel(entry_type,hash,pkg,sources) {
 // ===============================================================================
 
 function validatePutPkg(entry_type) {return null;}
-function validateModPkg(entry_type) { return null;}
+function validateModPkg(entry_type) {
+    if (entry_type != "handle" && entry_type != "post") {return null;}
+    // send the chain so that validators can check the original was made by the modifier
+    var req = {};
+    req[HC.PkgReq.Chain]=HC.PkgReq.ChainOpt.Full;
+    return req;
+}
 function validateDelPkg(entry_type) { return null;}
 function validateLinkPkg(entry_type) { return null;}
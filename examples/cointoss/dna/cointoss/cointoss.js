@@ -322,14 +322,30 @@ function validateLink(linkEntryType,baseHash,links,pkg,sources){
     }
     return true;
 }
+// findReplaced returns the entry that a mod replaces if it is on the modifier's own chain,
+// which validateModPkg asks for in the validation package.  get can't be used here because
+// nodes validating the mod might not all get the same result.
+function findReplaced(entry_type,replaces,pkg) {
+    if (pkg.Chain == undefined || pkg.Chain.Entries == undefined) {return undefined;}
+    var headers = pkg.Chain.Headers;
+    var entries = pkg.Chain.Entries;
+    for (var i=1;i<entries.length;i++) {
+        if (headers[i].Type == entry_type && makeHash(entry_type,entries[i].C) == replaces) {
+            return entries[i].C;
+        }
+    }
+    return undefined;
+}
 function validateMod(entry_type,entry,header,replaces,pkg,sources) {
     debug("validate mod: "+entry_type+" header:"+JSON.stringify(header)+" replaces:"+JSON.stringify(replaces));
     if (entry_type == "handle") {
         // check that the source is the same as the creator
         // TODO we could also check that the previous link in the type-chain is the replaces hash.
-        var orig_sources = get(replaces,{GetMask:HC.GetMask.Sources});
-        if (isErr(orig_sources) || orig_sources == undefined || orig_sources.length !=1 || orig_sources[0] != sources[0]) {return false;}
-
+        if (findReplaced(entry_type,replaces,pkg) == undefined) {
+            // when committing there is no package, but the system validation has already
+            // checked that the original is on our own chain
+            return sources[0] == App.Key.Hash;
+        }
     }
     return true;
 }
@@ -345,6 +361,12 @@ function validateDel(entry_type,hash,pkg,sources) {
 // ===============================================================================
 
 function validatePutPkg(entry_type) {return null;}
-function validateModPkg(entry_type) { return null;}
+function validateModPkg(entry_type) {
+    if (entry_type != "handle") {return null;}
+    // send the chain so that validators can check the original was made by the modifier
+    var req = {};
+    req[HC.PkgReq.Chain]=HC.PkgReq.ChainOpt.Full;
+    return req;
+}
 function validateDelPkg(entry_type) { return null;}
 function validateLinkPkg(entry_type) { return null;}
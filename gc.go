@@ -0,0 +1,158 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements garbage collection of expired and long deleted data from the DHT
+
+package holochain
+
+import (
+	"fmt"
+	"github.com/tidwall/buntdb"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultGCInterval = time.Minute * 10
+)
+
+// gcExpired returns true if a time stored at the key is more than age seconds ago
+func gcExpired(tx *buntdb.Tx, key string, age int, now int64) bool {
+	val, err := tx.Get(key)
+	if err != nil {
+		return false
+	}
+	t, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return false
+	}
+	return t+int64(age) <= now
+}
+
+// gcMessageHash returns the hash whose data a gossiped message changed
+func gcMessageHash(m *Message) (k string, ok bool) {
+	switch t := m.Body.(type) {
+	case PutReq:
+		k, ok = t.H.String(), true
+	case DelReq:
+		k, ok = t.H.String(), true
+	case ModReq:
+		k, ok = t.H.String(), true
+	case LinkReq:
+		k, ok = t.Base.String(), true
+	}
+	return
+}
+
+// GC drops entries whose entry type's TTL has passed, and entries that have been deleted
+// or modified for longer than DHTConfig.DeletedRetention, along with their links.
+// The messages in the gossip index that stored the dropped data are then emptied, but
+// the indexes themselves and the message fingerprints are kept so that peers who are
+// behind still converge with us and don't gossip the dropped data back.
+// Returns the number of entries dropped.
+func (dht *DHT) GC() (count int, err error) {
+	now := time.Now().Unix()
+	retention := dht.config.DeletedRetention
+	ttls := make(map[string]int)
+
+	var keys []string
+	err = dht.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, value string) bool {
+			if !strings.HasPrefix(key, "type:") {
+				return true
+			}
+			k := key[len("type:"):]
+			ttl, ok := ttls[value]
+			if !ok {
+				_, def, e := dht.h.GetEntryDef(value)
+				if e == nil {
+					ttl = def.TTL
+				}
+				ttls[value] = ttl
+			}
+			if ttl > 0 && gcExpired(tx, "time:"+k, ttl, now) {
+				keys = append(keys, k)
+				return true
+			}
+			if retention > 0 {
+				status, _ := tx.Get("status:" + k)
+				if (status == StatusDeletedVal || status == StatusModifiedVal) && gcExpired(tx, "changed:"+k, retention, now) {
+					keys = append(keys, k)
+				}
+			}
+			return true
+		})
+	})
+	if err != nil || len(keys) == 0 {
+		return
+	}
+
+	err = dht.db.Update(func(tx *buntdb.Tx) error {
+		for _, k := range keys {
+			for _, prefix := range []string{"entry:", "type:", "src:", "status:", "replacedBy:", "time:", "changed:"} {
+				_, e := tx.Delete(prefix + k)
+				if e != nil && e != buntdb.ErrNotFound {
+					return e
+				}
+			}
+			var links []string
+			tx.Ascend("link", func(key, value string) bool {
+				if strings.HasPrefix(key, "link:"+k+":") {
+					links = append(links, key)
+				}
+				return true
+			})
+			for _, l := range links {
+				if _, e := tx.Delete(l); e != nil {
+					return e
+				}
+			}
+			dht.dlog.Logf("GC dropped %s", k)
+			count++
+		}
+
+		// compact the gossip index by emptying the messages for data we no longer hold
+		var idxs []string
+		tx.Ascend("idx", func(key, value string) bool {
+			if value == "" {
+				return true
+			}
+			var m Message
+			if ByteDecoder([]byte(value), &m) != nil {
+				return true
+			}
+			if k, ok := gcMessageHash(&m); ok {
+				if _, e := tx.Get("status:" + k); e == buntdb.ErrNotFound {
+					idxs = append(idxs, key)
+				}
+			}
+			return true
+		})
+		for _, idx := range idxs {
+			if _, _, e := tx.Set(idx, "", nil); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// CollectGarbage runs the DHT garbage collection every interval
+func (dht *DHT) CollectGarbage(interval time.Duration) {
+	dht.collecting = Ticker(interval, func() {
+		count, err := dht.GC()
+		if err != nil {
+			dht.dlog.Logf("GC error: %v", err)
+		} else if count > 0 {
+			dht.dlog.Logf("GC dropped %d entries", count)
+		}
+	})
+}
+
+// gcTime returns the value stored with the time of a put or status change
+func gcTime(t time.Time) string {
+	return fmt.Sprintf("%d", t.Unix())
+}
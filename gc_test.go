@@ -0,0 +1,111 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"testing"
+	"time"
+)
+
+// backdate moves a stored gc time back by the given number of seconds
+func backdate(dht *DHT, key string, seconds int) {
+	err := dht.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(key, fmt.Sprintf("%d", time.Now().Unix()-int64(seconds)), nil)
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+
+	hash := commit(h, "oddNumbers", "7")
+	if err := dht.simHandleChangeReqs(); err != nil {
+		panic(err)
+	}
+	putIdx, _ := dht.GetIdx()
+	msg, _ := dht.GetIdxMessage(putIdx)
+	f, _ := msg.Fingerprint()
+
+	Convey("it should keep entries without a TTL", t, func() {
+		backdate(dht, "time:"+hash.String(), 1000)
+		count, err := dht.GC()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+		So(dht.exists(hash, StatusAny), ShouldBeNil)
+	})
+
+	Convey("it should drop entries whose TTL has passed", t, func() {
+		h.nucleus.dna.Zomes[1].Entries[0].TTL = 60
+		backdate(dht, "time:"+hash.String(), 30)
+		count, err := dht.GC()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+
+		backdate(dht, "time:"+hash.String(), 61)
+		count, err = dht.GC()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+		So(dht.exists(hash, StatusAny), ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("it should compact the gossip index without losing indexes or fingerprints", t, func() {
+		idx, _ := dht.GetIdx()
+		So(idx, ShouldEqual, putIdx)
+		puts, err := dht.GetPuts(putIdx)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, 1)
+		So(puts[0].M.Body, ShouldBeNil)
+		exists, err := dht.HaveFingerprint(f)
+		So(err, ShouldBeNil)
+		So(exists, ShouldBeTrue)
+	})
+
+	Convey("it should drop entries deleted longer than the retention time", t, func() {
+		delHash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: delHash}), "someType", delHash, h.nodeID, []byte("some value"), StatusLive, time.Now())
+		So(err, ShouldBeNil)
+		err = dht.del(h.node.NewMessage(DEL_REQUEST, DelReq{H: delHash}), delHash)
+		So(err, ShouldBeNil)
+
+		count, err := dht.GC()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 0)
+
+		dht.config.DeletedRetention = 60
+		backdate(dht, "changed:"+delHash.String(), 61)
+		count, err = dht.GC()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+		So(dht.exists(delHash, StatusAny), ShouldEqual, ErrHashNotFound)
+	})
+
+	Convey("it should measure TTLs from when entries were created", t, func() {
+		oldHash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		created := time.Now().Add(-time.Second * 61)
+		err := dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: oldHash}), "oddNumbers", oldHash, h.nodeID, []byte("9"), StatusLive, created)
+		So(err, ShouldBeNil)
+		futureHash, _ := NewHash("QmUfY4WeqD3UUfczjdkoFQGEgCAVNf7rgFfjdeTbr7JF1C")
+		created = time.Now().Add(time.Hour)
+		err = dht.put(h.node.NewMessage(PUT_REQUEST, PutReq{H: futureHash}), "oddNumbers", futureHash, h.nodeID, []byte("11"), StatusLive, created)
+		So(err, ShouldBeNil)
+
+		count, err := dht.GC()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+		So(dht.exists(oldHash, StatusAny), ShouldEqual, ErrHashNotFound)
+
+		// a creation time in the future can't keep an entry past its TTL
+		So(dht.exists(futureHash, StatusAny), ShouldBeNil)
+		dht.db.View(func(tx *buntdb.Tx) error {
+			So(gcExpired(tx, "time:"+futureHash.String(), 0, time.Now().Unix()), ShouldBeTrue)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,489 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// GoRibosome implements a native Go use of the Ribosome interface for zomes that are
+// compiled into the binary.  The zome's code file just holds the name under which its
+// GoZome was registered with RegisterGoZome.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"strings"
+	"sync"
+)
+
+const (
+	GoRibosomeType = "go"
+)
+
+var ErrGoZomeNotRegistered = errors.New("go zome not registered")
+
+// GoZomeFunction is the Go implementation of an exposed zome function.  It receives the
+// parameters of the call as given, i.e. a string for STRING_CALLING and JSON text for
+// JSON_CALLING, and returns the result in the same form.
+type GoZomeFunction func(api *GoAPI, params string) (result string, err error)
+
+// GoCallback is the Go implementation of the callback for an asynchronous send
+type GoCallback func(api *GoAPI, response string, callbackID string) (result interface{}, err error)
+
+// GoValidation holds what a Go zome's validation callback is given about the action being
+// validated.  Only the fields that apply to the action are set.
+type GoValidation struct {
+	Action    string // the action's name, i.e. commit, put, mod, del or link
+	EntryType string
+	Entry     Entry   // for commit, put and mod
+	Header    *Header // for commit, put and mod
+	Replaces  Hash    // for mod
+	Hash      Hash    // the entry being deleted for del
+	Base      Hash    // for link
+	Links     []Link  // for link
+	Package   *ValidationPackage
+	Sources   []string
+}
+
+// GoZome holds the Go implementations of a zome's functions and callbacks.  Any of the
+// callbacks may be nil, in which case genesis succeeds, validation passes, no validation
+// package is requested and received messages are echoed back.  The validation callbacks
+// can't use the nondeterministic GoAPI functions, and should take the current time from
+// the header being validated rather than from the time package.
+type GoZome struct {
+	Genesis                  func(api *GoAPI) error
+	BridgeGenesis            func(api *GoAPI, side int, dnaHash Hash, data string) error
+	Validate                 func(api *GoAPI, v *GoValidation) (valid bool, err error)
+	ValidatePackagingRequest func(api *GoAPI, action string, def *EntryDef) (req PackagingReq, err error)
+	Receive                  func(api *GoAPI, from string, msg string) (response string, err error)
+	Functions                map[string]GoZomeFunction
+	Callbacks                map[string]GoCallback
+}
+
+var goZomes = struct {
+	sync.RWMutex
+	m map[string]*GoZome
+}{m: make(map[string]*GoZome)}
+
+// RegisterGoZome makes a Go zome available under a name to zomes of the go ribosome type
+// whose code file holds that name.  It's meant to be called from init functions.
+func RegisterGoZome(name string, zome *GoZome) {
+	goZomes.Lock()
+	defer goZomes.Unlock()
+	goZomes.m[name] = zome
+}
+
+// GetGoZome returns the Go zome registered under a name
+func GetGoZome(name string) (zome *GoZome, err error) {
+	goZomes.RLock()
+	defer goZomes.RUnlock()
+	zome, ok := goZomes.m[name]
+	if !ok {
+		err = ErrGoZomeNotRegistered
+	}
+	return
+}
+
+// GoRibosome holds data needed to run a Go zome
+type GoRibosome struct {
+	validationContext
+	h          *Holochain
+	zome       *Zome
+	goZome     *GoZome
+	api        *GoAPI
+	lastResult interface{}
+}
+
+// NewGoRibosome factory function to build a ribosome for a registered Go zome
+func NewGoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	name := strings.TrimSpace(zome.Code)
+	if name == "" {
+		name = zome.Name
+	}
+	var goZome *GoZome
+	goZome, err = GetGoZome(name)
+	if err != nil {
+		err = fmt.Errorf("%v: %s", err, name)
+		return
+	}
+	r := GoRibosome{
+		h:      h,
+		zome:   zome,
+		goZome: goZome,
+	}
+	r.api = &GoAPI{h: h, zome: zome, validation: &r.validationContext}
+	n = &r
+	return
+}
+
+// Type returns the string value under which this ribosome is registered
+func (r *GoRibosome) Type() string { return GoRibosomeType }
+
+// Reset does nothing as Go zomes keep no state in the ribosome
+func (r *GoRibosome) Reset() (err error) {
+	r.lastResult = nil
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (r *GoRibosome) ChainGenesis() (err error) {
+	if r.goZome.Genesis != nil {
+		err = r.goZome.Genesis(r.api)
+	}
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (r *GoRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	if r.goZome.BridgeGenesis != nil {
+		err = r.goZome.BridgeGenesis(r.api, side, dnaHash, data)
+	}
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (r *GoRibosome) Receive(from string, msg string) (response string, err error) {
+	if r.goZome.Receive == nil {
+		response = msg
+		return
+	}
+	response, err = r.goZome.Receive(r.api, from, msg)
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (r *GoRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	if r.goZome.ValidatePackagingRequest != nil {
+		r.startValidation(action)
+		req, err = r.goZome.ValidatePackagingRequest(r.api, action.Name(), def)
+		if err = r.endValidation(err); err != nil {
+			req = nil
+		}
+	}
+	return
+}
+
+// ValidateAction builds the validation data for the action and calls the zome's validation
+func (r *GoRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	if r.goZome.Validate == nil {
+		return
+	}
+	v := GoValidation{Action: action.Name(), EntryType: def.Name, Package: pkg, Sources: sources}
+	switch t := action.(type) {
+	case *ActionPut:
+		v.Entry, v.Header = t.entry, t.header
+	case *ActionCommit:
+		v.Entry, v.Header = t.entry, t.header
+	case *ActionMod:
+		v.Entry, v.Header, v.Replaces = t.entry, t.header, t.replaces
+	case *ActionDel:
+		v.Hash = t.entry.Hash
+	case *ActionLink:
+		v.Base, v.Links = t.validationBase, t.links
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+		return
+	}
+	var valid bool
+	r.startValidation(action)
+	valid, err = r.goZome.Validate(r.api, &v)
+	err = r.endValidation(err)
+	if err == nil && !valid {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// Call calls the Go function that was registered for the exposed function
+func (r *GoRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	f, ok := r.goZome.Functions[fn.Name]
+	if !ok {
+		err = fmt.Errorf("go zome has no function: %s", fn.Name)
+		return
+	}
+	p, ok := params.(string)
+	if !ok {
+		err = fmt.Errorf("expecting string params, got: %T", params)
+		return
+	}
+	result, err = f(r.api, p)
+	return
+}
+
+// Run calls the function named by code without parameters
+func (r *GoRibosome) Run(code string) (result interface{}, err error) {
+	result, err = r.Call(&FunctionDef{Name: code, CallingType: STRING_CALLING}, "")
+	if err == nil {
+		r.lastResult = result
+	}
+	return
+}
+
+// RunAsyncSendResponse calls the callback with the response of an asynchronous send
+func (r *GoRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	cb, ok := r.goZome.Callbacks[callback]
+	if !ok {
+		err = fmt.Errorf("go zome has no callback: %s", callback)
+		return
+	}
+	result, err = cb(r.api, response.Body, callbackID)
+	return
+}
+
+// GoAPI is the typed Go version of the host functions available to zome code
+type GoAPI struct {
+	h          *Holochain
+	zome       *Zome
+	validation *validationContext // restricts the API while the zome's validation runs
+}
+
+// entryContent converts a Go value into the content of an entry of the given type.
+// String formats take strings, bytes takes []byte, and JSON and cbor take either
+// their encoded form or a value to encode.
+func (api *GoAPI) entryContent(entryType string, entry interface{}) (content interface{}, err error) {
+	var def *EntryDef
+	_, def, err = api.h.GetEntryDef(entryType)
+	if err != nil {
+		return
+	}
+	switch def.DataFormat {
+	case DataFormatRawJS:
+		fallthrough
+	case DataFormatRawZygo:
+		fallthrough
+	case DataFormatString:
+		if _, ok := entry.(string); !ok {
+			err = fmt.Errorf("%s entries must be strings, got: %T", entryType, entry)
+			return
+		}
+		content = entry
+	case DataFormatBytes:
+		if _, ok := entry.([]byte); !ok {
+			err = fmt.Errorf("%s entries must be []byte, got: %T", entryType, entry)
+			return
+		}
+		content = entry
+	case DataFormatCBOR:
+		if b, ok := entry.([]byte); ok {
+			content = b
+		} else {
+			content, err = EncodeCBOR(entry)
+		}
+	case DataFormatLinks:
+		fallthrough
+	case DataFormatJSON:
+		if s, ok := entry.(string); ok {
+			content = s
+		} else {
+			var j []byte
+			j, err = json.Marshal(entry)
+			content = string(j)
+		}
+	default:
+		err = errors.New("data format not implemented: " + def.DataFormat)
+	}
+	return
+}
+
+// hashResponse returns the hash an action responded with
+func hashResponse(r interface{}, err error) (hash Hash, e error) {
+	e = err
+	if e == nil && r != nil {
+		hash = r.(Hash)
+	}
+	return
+}
+
+// Property returns the value of a DNA property
+func (api *GoAPI) Property(prop string) (value string, err error) {
+	var r interface{}
+	r, err = NewPropertyAction(prop).Do(api.h)
+	if err == nil {
+		value = r.(string)
+	}
+	return
+}
+
+// Debug sends a message to the app's debug log
+func (api *GoAPI) Debug(msg string) {
+	NewDebugAction(msg).Do(api.h)
+}
+
+// MakeHash returns the hash an entry would have if it were committed
+func (api *GoAPI) MakeHash(entryType string, entry interface{}) (hash Hash, err error) {
+	var content interface{}
+	content, err = api.entryContent(entryType, entry)
+	if err != nil {
+		return
+	}
+	return hashResponse(NewMakeHashAction(&GobEntry{C: content}).Do(api.h))
+}
+
+// Commit commits an entry to the chain and puts it to the DHT
+func (api *GoAPI) Commit(entryType string, entry interface{}) (hash Hash, err error) {
+	if err = api.validation.checkCall("commit"); err != nil {
+		return
+	}
+	var content interface{}
+	content, err = api.entryContent(entryType, entry)
+	if err != nil {
+		return
+	}
+	return hashResponse(NewCommitAction(entryType, &GobEntry{C: content}).Do(api.h))
+}
+
+// Update commits an entry which replaces an earlier one
+func (api *GoAPI) Update(entryType string, entry interface{}, replaces Hash) (hash Hash, err error) {
+	if err = api.validation.checkCall("update"); err != nil {
+		return
+	}
+	var content interface{}
+	content, err = api.entryContent(entryType, entry)
+	if err != nil {
+		return
+	}
+	return hashResponse(NewModAction(entryType, &GobEntry{C: content}, replaces).Do(api.h))
+}
+
+// UpdateAgent changes the agent's identity and/or revokes its key
+func (api *GoAPI) UpdateAgent(options ModAgentOptions) (hash Hash, err error) {
+	if err = api.validation.checkCall("updateAgent"); err != nil {
+		return
+	}
+	a := NewModAgentAction(AgentIdentity(options.Identity))
+	a.Revocation = options.Revocation
+	return hashResponse(a.Do(api.h))
+}
+
+// Remove marks an entry as deleted
+func (api *GoAPI) Remove(hash Hash, message string) (delHash Hash, err error) {
+	if err = api.validation.checkCall("remove"); err != nil {
+		return
+	}
+	var header *Header
+	header, err = api.h.chain.GetEntryHeader(hash)
+	if err != nil {
+		return
+	}
+	return hashResponse(NewDelAction(header.Type, DelEntry{Hash: hash, Message: message}).Do(api.h))
+}
+
+// Get retrieves an entry from the DHT, or from the chain if options.Local is set
+func (api *GoAPI) Get(hash Hash, options *GetOptions) (resp GetResp, err error) {
+	if err = api.validation.checkCall("get"); err != nil {
+		return
+	}
+	if options == nil {
+		options = &GetOptions{StatusMask: StatusDefault}
+	}
+	req := GetReq{H: hash, StatusMask: options.StatusMask, GetMask: options.GetMask}
+	var r interface{}
+	r, err = NewGetAction(req, options).Do(api.h)
+	if err == nil {
+		resp = r.(GetResp)
+	}
+	return
+}
+
+// GetLinks retrieves the links on a base with the given tag
+func (api *GoAPI) GetLinks(base Hash, tag string, options *GetLinksOptions) (links []TaggedHash, err error) {
+	if err = api.validation.checkCall("getLinks"); err != nil {
+		return
+	}
+	if options == nil {
+		options = &GetLinksOptions{StatusMask: StatusLive}
+	}
+	var r interface{}
+	r, err = NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, options).Do(api.h)
+	if err == nil {
+		links = r.(*LinkQueryResp).Links
+	}
+	return
+}
+
+// Query searches the local chain
+func (api *GoAPI) Query(options *QueryOptions) (results []QueryResult, err error) {
+	if err = api.validation.checkCall("query"); err != nil {
+		return
+	}
+	var r interface{}
+	r, err = NewQueryAction(options).Do(api.h)
+	if err == nil {
+		results = r.([]QueryResult)
+	}
+	return
+}
+
+// Send sends a message, encoded as JSON, to the zome's receive function on another node.
+// If options has a Callback its Function names one of the zome's Callbacks.
+func (api *GoAPI) Send(to peer.ID, msg interface{}, options *SendOptions) (response interface{}, err error) {
+	if err = api.validation.checkCall("send"); err != nil {
+		return
+	}
+	var j []byte
+	j, err = json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	a := NewSendAction(to, AppMsg{ZomeType: api.zome.Name, Body: string(j)})
+	a.options = options
+	if options != nil && options.Callback != nil {
+		options.Callback.zomeType = api.zome.Name
+	}
+	response, err = a.Do(api.h)
+	return
+}
+
+// Call calls an exposed function of a zome in this app
+func (api *GoAPI) Call(zome string, function string, args interface{}) (result interface{}, err error) {
+	if err = api.validation.checkCall("call"); err != nil {
+		return
+	}
+	result, err = NewCallAction(zome, function, args).Do(api.h)
+	return
+}
+
+// Bridge calls a bridged function of another app
+func (api *GoAPI) Bridge(app Hash, zome string, function string, args string) (result interface{}, err error) {
+	if err = api.validation.checkCall("bridge"); err != nil {
+		return
+	}
+	a := NewBridgeAction(zome, function, args)
+	a.token, a.url, err = api.h.GetBridgeToken(app)
+	if err != nil {
+		return
+	}
+	result, err = a.Do(api.h)
+	return
+}
+
+// GetBridges returns the app's bridges
+func (api *GoAPI) GetBridges() (bridges []Bridge, err error) {
+	if err = api.validation.checkCall("getBridges"); err != nil {
+		return
+	}
+	bridges, err = api.h.GetBridges()
+	return
+}
+
+// Sign signs a document with the agent's private key
+func (api *GoAPI) Sign(doc []byte) (signature []byte, err error) {
+	if err = api.validation.checkCall("sign"); err != nil {
+		return
+	}
+	var r interface{}
+	r, err = NewSignAction(doc).Do(api.h)
+	if err == nil && r != nil {
+		signature = r.([]byte)
+	}
+	return
+}
+
+// VerifySignature checks a signature of some data against a public key
+func (api *GoAPI) VerifySignature(signature string, data string, pubKey string) (valid bool, err error) {
+	valid, err = NewVerifySignatureAction(signature, data, pubKey).Do(api.h)
+	return
+}
@@ -0,0 +1,191 @@
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	b58 "github.com/jbenet/go-base58"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func init() {
+	RegisterGoZome("goTestZome", &GoZome{
+		Genesis: func(api *GoAPI) error {
+			api.Debug("go genesis")
+			return nil
+		},
+		Validate: func(api *GoAPI, v *GoValidation) (bool, error) {
+			if v.Action == "commit" && v.Entry.Content() == "bogus" {
+				return false, nil
+			}
+			if v.Action == "commit" && v.Entry.Content() == "lookup" {
+				api.Get(v.Header.EntryLink, nil)
+			}
+			return true, nil
+		},
+		Receive: func(api *GoAPI, from string, msg string) (string, error) {
+			return fmt.Sprintf(`{"from":"%s","msg":%s}`, from, msg), nil
+		},
+		Functions: map[string]GoZomeFunction{
+			"addOdd": func(api *GoAPI, params string) (string, error) {
+				hash, err := api.Commit("oddNumbers", params)
+				if err != nil {
+					return "", err
+				}
+				return hash.String(), nil
+			},
+			"fail": func(api *GoAPI, params string) (string, error) {
+				return "", errors.New("failed: " + params)
+			},
+		},
+		Callbacks: map[string]GoCallback{
+			"got": func(api *GoAPI, response string, callbackID string) (interface{}, error) {
+				return callbackID + ":" + response, nil
+			},
+		},
+	})
+}
+
+func TestNewGoRibosome(t *testing.T) {
+	Convey("new should create a ribosome for a registered go zome", t, func() {
+		v, err := NewGoRibosome(nil, &Zome{RibosomeType: GoRibosomeType, Code: "goTestZome\n"})
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, GoRibosomeType)
+	})
+	Convey("new should fall back to the zome name", t, func() {
+		_, err := NewGoRibosome(nil, &Zome{Name: "goTestZome", RibosomeType: GoRibosomeType})
+		So(err, ShouldBeNil)
+	})
+	Convey("new should fail for unregistered go zomes", t, func() {
+		v, err := NewGoRibosome(nil, &Zome{RibosomeType: GoRibosomeType, Code: "noSuchZome"})
+		So(v, ShouldBeNil)
+		So(err.Error(), ShouldEqual, "go zome not registered: noSuchZome")
+	})
+	Convey("the code file name should have the gozome extension", t, func() {
+		z := Zome{Name: "myZome", RibosomeType: GoRibosomeType}
+		So(z.CodeFileName(), ShouldEqual, "myZome.gozome")
+	})
+}
+
+func TestGoRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewGoRibosome(h, &Zome{Name: "goZome", RibosomeType: GoRibosomeType, Code: "goTestZome"})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should run genesis", t, func() {
+		So(v.ChainGenesis(), ShouldBeNil)
+		So(v.BridgeGenesis(BridgeFrom, h.dnaHash, ""), ShouldBeNil)
+	})
+
+	Convey("it should call registered functions", t, func() {
+		r, err := v.Call(&FunctionDef{Name: "addOdd", CallingType: STRING_CALLING}, "3")
+		So(err, ShouldBeNil)
+		hash, err := NewHash(r.(string))
+		So(err, ShouldBeNil)
+		e, entryType, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "oddNumbers")
+		So(e.Content(), ShouldEqual, "3")
+
+		_, err = v.Call(&FunctionDef{Name: "fail", CallingType: STRING_CALLING}, "x")
+		So(err.Error(), ShouldEqual, "failed: x")
+
+		_, err = v.Call(&FunctionDef{Name: "missing", CallingType: STRING_CALLING}, "x")
+		So(err.Error(), ShouldEqual, "go zome has no function: missing")
+	})
+
+	Convey("it should validate actions", t, func() {
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "3"})
+		a.header = &Header{}
+		So(v.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldBeNil)
+		a = NewCommitAction("oddNumbers", &GobEntry{C: "bogus"})
+		a.header = &Header{}
+		So(v.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldEqual, ValidationFailedErr)
+	})
+
+	Convey("validation should fail if it uses nondeterministic functions", t, func() {
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "lookup"})
+		a.header = &Header{}
+		So(v.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldResemble, &NondeterministicCallErr{Fn: "get"})
+	})
+
+	Convey("it should receive messages and run callbacks", t, func() {
+		r, err := v.Receive("fakehash", `"hi"`)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, `{"from":"fakehash","msg":"hi"}`)
+
+		result, err := v.RunAsyncSendResponse(AppMsg{Body: "pong"}, "got", "123")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "123:pong")
+	})
+}
+
+func TestGoAPI(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	api := &GoAPI{h: h, zome: &h.nucleus.dna.Zomes[1]}
+
+	Convey("it should get properties", t, func() {
+		p, err := api.Property("description")
+		So(err, ShouldBeNil)
+		So(p, ShouldEqual, "a bogus test holochain")
+	})
+
+	Convey("it should commit and get entries", t, func() {
+		hash, err := api.Commit("profile", map[string]interface{}{"firstName": "Zippy", "lastName": "Pinhead"})
+		So(err, ShouldBeNil)
+		made, err := api.MakeHash("profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		So(err, ShouldBeNil)
+		So(made.String(), ShouldEqual, hash.String())
+
+		h.dht.simHandleChangeReqs()
+		resp, err := api.Get(hash, &GetOptions{StatusMask: StatusDefault, GetMask: GetMaskEntry})
+		So(err, ShouldBeNil)
+		So(resp.Entry.Content(), ShouldEqual, `{"firstName":"Zippy","lastName":"Pinhead"}`)
+
+		_, err = api.Commit("oddNumbers", 3)
+		So(err.Error(), ShouldEqual, "oddNumbers entries must be strings, got: int")
+	})
+
+	Convey("it should update and remove entries", t, func() {
+		hash, err := api.Commit("oddNumbers", "5")
+		So(err, ShouldBeNil)
+		newHash, err := api.Update("oddNumbers", "7", hash)
+		So(err, ShouldBeNil)
+		_, err = api.Remove(newHash, "expired")
+		So(err, ShouldBeNil)
+	})
+
+	Convey("it should sign and verify", t, func() {
+		sig, err := api.Sign([]byte("3"))
+		So(err, ShouldBeNil)
+		pubKeyBytes, err := ic.MarshalPublicKey(h.agent.PrivKey().GetPublic())
+		So(err, ShouldBeNil)
+		valid, err := api.VerifySignature(b58.Encode(sig), "3", b58.Encode(pubKeyBytes))
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+	})
+
+	Convey("it should query the chain", t, func() {
+		results, err := api.Query(&QueryOptions{Constrain: QueryConstrain{EntryTypes: []string{"oddNumbers"}}, Return: QueryReturn{Entries: true}})
+		So(err, ShouldBeNil)
+		So(len(results), ShouldEqual, 2)
+	})
+
+	Convey("it should make hashes the way the other ribosomes do", t, func() {
+		hash, err := api.MakeHash("oddNumbers", "3")
+		So(err, ShouldBeNil)
+		e := GobEntry{C: "3"}
+		expected, _ := e.Sum(h.hashSpec)
+		So(hash.Equal(&expected), ShouldBeTrue)
+	})
+}
@@ -434,6 +434,11 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 				dht.glog.Logf("WHOA! idx=%d  p.idx:%d p.M: %v", idx, p.idx, p.M)
 			}
 			*/
+			if p.M.Body == nil {
+				// the put's message was emptied when its data got garbage collected
+				dht.glog.Logf("PUT--%d was garbage collected", idx)
+				continue
+			}
 			f, e := p.M.Fingerprint()
 			if e == nil {
 				// dht.sources[p.M.From] = true
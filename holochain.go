@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -51,13 +52,22 @@ type Loggers struct {
 
 // Config holds the non-DNA configuration for a holo-chain, from config file or environment variables
 type Config struct {
-	Port            int
-	EnableMDNS      bool
-	PeerModeAuthor  bool
-	PeerModeDHTNode bool
-	EnableNATUPnP   bool
-	BootstrapServer string
-	Loggers         Loggers
+	Port             int
+	EnableMDNS       bool
+	PeerModeAuthor   bool
+	PeerModeDHTNode  bool
+	EnableNATUPnP    bool
+	BootstrapServer  string
+	BootstrapServers []string // more bootstrap servers, tried in order if BootstrapServer fails
+	Loggers          Loggers
+	ExecLimits       ExecLimits
+	RibosomePoolSize int // number of idle ribosome instances to keep for each zome
+	MaxMessageSize   int // largest message in bytes sent to or accepted from other nodes
+	MaxPeerRequests  int // number of requests in flight with a peer over each protocol
+	RateLimits       RateLimits
+	EnableRelay      bool     // relay connections to nodes that can't be reached directly
+	RelayServers     []string // relays this node can be reached through if it isn't publicly reachable
+	ListenAddrs      []string // more addresses to listen on, for WebSocket (e.g. /ip4/0.0.0.0/tcp/6284/ws)
 }
 
 // Progenitor holds data on the creator of the DNA
@@ -88,6 +98,16 @@ type Holochain struct {
 	gossipProtocol   *Protocol
 	actionProtocol   *Protocol
 	asyncSends       chan error
+	ribosomes        ribosomePools
+	scheduleDB       *buntdb.DB
+	scheduling       chan bool
+	scheduleLk       sync.Mutex // held while scheduled functions run and while the scheduler starts or stops
+	bsRefreshing     chan bool
+	peerDB           *buntdb.DB
+	savingPeers      chan bool
+	peerLk           sync.Mutex // held while the peer database is used and while remembering peers starts or stops
+	relayRefreshing  chan bool
+	tableRefreshing  chan bool
 }
 
 func (h *Holochain) Nucleus() (n *Nucleus) {
@@ -174,6 +194,7 @@ func InitializeHolochain() {
 		gob.Register(FindNodeReq{})
 		gob.Register(CloserPeersResp{})
 		gob.Register(PeerInfo{})
+		gob.Register(ChunkManifest{})
 
 		RegisterBultinRibosomes()
 
@@ -266,8 +287,25 @@ func (h *Holochain) createNode() (err error) {
 	} else {
 		ip = "0.0.0.0"
 	}
-	listenaddr := fmt.Sprintf("/ip4/%s/tcp/%d", ip, h.Config.Port)
-	h.node, err = NewNode(listenaddr, h.dnaHash.String(), h.Agent().(*LibP2PAgent), h.Config.EnableNATUPnP)
+	h.node, err = NewNode(h.Config.listenAddrs(ip), h.dnaHash.String(), h.Agent().(*LibP2PAgent), h.Config.EnableNATUPnP)
+	if err == nil && h.Config.MaxMessageSize > 0 {
+		h.node.MaxMessageSize = h.Config.MaxMessageSize
+	}
+	if err == nil && h.Config.MaxPeerRequests > 0 {
+		h.node.MaxPeerRequests = h.Config.MaxPeerRequests
+	}
+	if err == nil {
+		err = h.node.SetRateLimits(h.Config.RateLimits)
+	}
+	if err == nil {
+		err = h.node.EnableRelay(h.Config.EnableRelay)
+	}
+	for _, addr := range h.Config.RelayServers {
+		if err != nil {
+			break
+		}
+		err = h.node.AddRelay(addr)
+	}
 	return
 }
 
@@ -315,16 +353,24 @@ func (h *Holochain) Activate() (err error) {
 			return
 		}
 	}
-	if h.Config.BootstrapServer != "" {
+	if e := h.RememberPeers(PeerStoreSaveInterval); e != nil {
+		h.dht.dlog.Logf("error loading remembered peers: %s", e.Error())
+	}
+	// connect to relays before registering with bootstrap servers so that the relayed
+	// address gets registered
+	h.RelayRefresh(RelayRefreshInterval)
+	if len(h.Config.BootstrapServerList()) > 0 {
 		e := h.BSpost()
 		if e != nil {
 			h.dht.dlog.Logf("error in BSpost: %s", e.Error())
 		}
+		h.BSRefresh(BootstrapRefreshInterval)
 		e = h.BSget()
 		if e != nil {
 			h.dht.dlog.Logf("error in BSget: %s", e.Error())
 		}
 	}
+	h.RoutingRefresh(RoutingRefreshInterval)
 	if h.Config.PeerModeDHTNode {
 		if err = h.dht.Start(); err != nil {
 			return
@@ -573,6 +619,9 @@ func (h *Holochain) GetEntryDef(t string) (zome *Zome, d *EntryDef, err error) {
 	} else if t == KeyEntryType {
 		d = KeyEntryDef
 		return
+	} else if t == ManifestEntryType {
+		d = ManifestEntryDef
+		return
 	}
 	for _, z := range h.nucleus.dna.Zomes {
 		d, err = z.GetEntryDef(t)
@@ -594,10 +643,11 @@ func (h *Holochain) GetPrivateEntryDefs() (privateDefs []EntryDef) {
 
 // Call executes an exposed function
 func (h *Holochain) Call(zomeType string, function string, arguments interface{}, exposureContext string) (result interface{}, err error) {
-	n, z, err := h.MakeRibosome(zomeType)
+	n, z, release, err := h.GetRibosome(zomeType)
 	if err != nil {
 		return
 	}
+	defer release()
 	fn, err := z.GetFunctionDef(function)
 	if err != nil {
 		return
@@ -606,7 +656,17 @@ func (h *Holochain) Call(zomeType string, function string, arguments interface{}
 		err = errors.New("function not available")
 		return
 	}
+	if err = fn.ValidateInput(arguments); err != nil {
+		return
+	}
 	result, err = n.Call(fn, arguments)
+	if err != nil {
+		return
+	}
+	err = fn.ValidateOutput(result)
+	if err != nil {
+		result = nil
+	}
 	return
 }
 
@@ -647,6 +707,11 @@ func (h *Holochain) GetZome(zName string) (z *Zome, err error) {
 
 // Close releases the resources associated with a holochain
 func (h *Holochain) Close() {
+	h.stopSchedule()
+	h.stopBSRefresh()
+	h.stopRoutingRefresh()
+	h.stopRememberingPeers()
+	h.stopRelayRefresh()
 	if h.chain.s != nil {
 		h.chain.s.Close()
 	}
@@ -673,6 +738,12 @@ func (h *Holochain) Reset() (err error) {
 		h.node.Close()
 	}
 
+	h.stopSchedule()
+	h.stopBSRefresh()
+	h.stopRoutingRefresh()
+	h.stopRememberingPeers()
+	h.stopRelayRefresh()
+
 	err = os.RemoveAll(h.DBPath())
 	if err != nil {
 		return
@@ -767,6 +838,8 @@ func (h *Holochain) StartBackgroundTasks(gossipInterval time.Duration) {
 	go h.HandleAsyncSends()
 	go h.DHT().Gossip(gossipInterval)
 	go h.DHT().Retry(DefaultRetryInterval)
+	go h.DHT().CollectGarbage(DefaultGCInterval)
+	h.Schedule(DefaultScheduleInterval)
 }
 
 // Send builds a message and either delivers it locally or over the network via node.Send
@@ -922,7 +995,10 @@ func (h *Holochain) Query(options *QueryOptions) (results []QueryResult, err err
 					return
 				}
 			} else {
-				content = h.chain.Entries[i].Content().(string)
+				content, err = def.ContentString(h.chain.Entries[i])
+				if err != nil {
+					return
+				}
 			}
 
 			if !skip && options.Constrain.Equals != "" {
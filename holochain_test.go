@@ -477,6 +477,28 @@ func TestCall(t *testing.T) {
 		_, err := h.Call("zySampleZome", "testStrFn1", "arg1 arg2", PUBLIC_EXPOSURE)
 		So(err.Error(), ShouldEqual, "function not available")
 	})
+	Convey("it should validate arguments and results against the function's schemas", t, func() {
+		zome, _ := h.GetZome("jsSampleZome")
+		var fn *FunctionDef
+		for i := range zome.Functions {
+			if zome.Functions[i].Name == "testJsonFn1" {
+				fn = &zome.Functions[i]
+			}
+		}
+		fn.InputSchema = `{"type":"object","properties":{"input":{"type":"number"}},"required":["input"]}`
+		fn.OutputSchema = `{"type":"object","properties":{"output":{"type":"number"}},"required":["output"]}`
+		result, err := h.Call("jsSampleZome", "testJsonFn1", `{"input":2}`, ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, `{"input":2,"output":4}`)
+
+		_, err = h.Call("jsSampleZome", "testJsonFn1", `{"input":"two"}`, ZOME_EXPOSURE)
+		So(err.Error(), ShouldStartWith, "invalid input for testJsonFn1:")
+
+		fn.OutputSchema = `{"type":"object","properties":{"output":{"type":"string"}},"required":["output"]}`
+		result, err = h.Call("jsSampleZome", "testJsonFn1", `{"input":2}`, ZOME_EXPOSURE)
+		So(result, ShouldBeNil)
+		So(err.Error(), ShouldStartWith, "invalid output for testJsonFn1:")
+	})
 }
 
 func TestCommit(t *testing.T) {
@@ -698,7 +720,7 @@ func TestGetEntryDef(t *testing.T) {
 		zome, def, err := h.GetEntryDef("evenNumbers")
 		So(err, ShouldBeNil)
 		So(zome.Name, ShouldEqual, "zySampleZome")
-		So(fmt.Sprintf("%v", def), ShouldEqual, "&{evenNumbers zygo public  <nil>}")
+		So(fmt.Sprintf("%v", def), ShouldEqual, "&{evenNumbers zygo public  0 0 0 <nil>}")
 	})
 	Convey("it should get sys entry definitions", t, func() {
 		zome, def, err := h.GetEntryDef(DNAEntryType)
@@ -6,6 +6,7 @@
 package holochain
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	. "github.com/metacurrency/holochain/hash"
 	"github.com/robertkrimen/otto"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,35 +24,52 @@ const (
 
 // JSRibosome holds data needed for the Javascript VM
 type JSRibosome struct {
+	validationContext
 	h          *Holochain
 	zome       *Zome
 	vm         *otto.Otto
+	pristine   *otto.Otto // a copy of the vm as it was just after the zome code was loaded
 	lastResult *otto.Value
 }
 
+// jsScripts caches compiled zome code so that new VMs don't have to parse it again
+var jsScripts = newCodeCache()
+
+// jsCompile returns the compiled script for some zome code
+func jsCompile(vm *otto.Otto, code string) (script *otto.Script, err error) {
+	var compiled interface{}
+	compiled, err = jsScripts.get(code, func() (interface{}, error) {
+		return vm.Compile("", code)
+	})
+	if err == nil {
+		script = compiled.(*otto.Script)
+	}
+	return
+}
+
 // Type returns the string value under which this ribosome is registered
 func (jsr *JSRibosome) Type() string { return JSRibosomeType }
 
 // ChainGenesis runs the application genesis function
 // this function gets called after the genesis entries are added to the chain
 func (jsr *JSRibosome) ChainGenesis() (err error) {
-	err = jsr.boolFn("genesis", "")
+	err = jsr.boolFn("genesis")
 	return
 }
 
 // BridgeGenesis runs the bridging genesis function
 // this function gets called on both sides of the bridging
 func (jsr *JSRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
-	err = jsr.boolFn("bridgeGenesis", fmt.Sprintf(`%d,"%s","%s"`, side, dnaHash.String(), jsSanitizeString(data)))
+	err = jsr.boolFn("bridgeGenesis", side, dnaHash.String(), data)
 	return
 }
 
-func (jsr *JSRibosome) boolFn(fnName string, args string) (err error) {
+func (jsr *JSRibosome) boolFn(fnName string, args ...interface{}) (err error) {
 	var v otto.Value
-	v, err = jsr.vm.Run(fnName + "(" + args + ")")
+	v, err = jsr.call(fnName, args...)
 
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execErr(fnName, err)
 		return
 	}
 	if v.IsBoolean() {
@@ -77,9 +96,9 @@ func (jsr *JSRibosome) Receive(from string, msg string) (response string, err er
 	code = fmt.Sprintf(`JSON.stringify(%s("%s",JSON.parse("%s")))`, fnName, from, jsSanitizeString(msg))
 	Debug(code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(code)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execErr(fnName, err)
 		return
 	}
 	response, err = v.ToString()
@@ -88,14 +107,21 @@ func (jsr *JSRibosome) Receive(from string, msg string) (response string, err er
 
 // ValidatePackagingRequest calls the app for a validation packaging request for an action
 func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	jsr.startValidation(action)
+	defer func() {
+		err = jsr.endValidation(err)
+		if err != nil {
+			req = nil
+		}
+	}()
 	var code string
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
 	code = fmt.Sprintf(`%s("%s")`, fnName, def.Name)
 	Debug(code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(code)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execErr(fnName, err)
 		return
 	}
 	if v.IsObject() {
@@ -114,12 +140,20 @@ func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 }
 
 func prepareJSEntryArgs(def *EntryDef, entry Entry, header *Header) (args string, err error) {
-	entryStr := entry.Content().(string)
+	var entryStr string
+	entryStr, err = def.ContentString(entry)
+	if err != nil {
+		return
+	}
 	switch def.DataFormat {
 	case DataFormatRawJS:
 		args = entryStr
+	case DataFormatBytes:
+		fallthrough
 	case DataFormatString:
 		args = "\"" + jsSanitizeString(entryStr) + "\""
+	case DataFormatCBOR:
+		fallthrough
 	case DataFormatLinks:
 		fallthrough
 	case DataFormatJSON:
@@ -196,6 +230,8 @@ func buildJSValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 
 // ValidateAction builds the correct validation function based on the action an calls it
 func (jsr *JSRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	jsr.startValidation(action)
+	defer func() { err = jsr.endValidation(err) }()
 	var code string
 	code, err = buildJSValidateAction(action, def, pkg, sources)
 	if err != nil {
@@ -211,66 +247,77 @@ func mkJSSources(sources []string) (srcs string) {
 	return
 }
 
-func (jsr *JSRibosome) prepareJSValidateEntryArgs(def *EntryDef, entry Entry, sources []string) (e string, srcs string, err error) {
-	c := entry.Content().(string)
+// entryValue converts an entry's content into the javascript value passed to app functions
+func (jsr *JSRibosome) entryValue(def *EntryDef, entry Entry) (v otto.Value, err error) {
+	var c string
+	c, err = def.ContentString(entry)
+	if err != nil {
+		return
+	}
 	switch def.DataFormat {
 	case DataFormatRawJS:
-		e = c
+		v, err = jsr.run("(" + c + ")")
+	case DataFormatBytes:
+		fallthrough
 	case DataFormatString:
-		e = "\"" + jsSanitizeString(c) + "\""
+		v, err = jsr.vm.ToValue(c)
+	case DataFormatCBOR:
+		fallthrough
 	case DataFormatLinks:
 		fallthrough
 	case DataFormatJSON:
-		e = fmt.Sprintf(`JSON.parse("%s")`, jsSanitizeString(c))
+		v, err = jsr.parse(c)
 	default:
 		err = errors.New("data format not implemented: " + def.DataFormat)
-		return
 	}
-	srcs = mkJSSources(sources)
 	return
 }
 
 func (jsr *JSRibosome) runValidate(fnName string, code string) (err error) {
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(code)
+	err = jsr.validateResult(fnName, v, err)
+	return
+}
+
+// validateResult converts the value returned by a validation function into a validation error
+func (jsr *JSRibosome) validateResult(fnName string, v otto.Value, err error) error {
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
-		return
+		return execErr(fnName, err)
 	}
-	if v.IsBoolean() {
-		if v.IsBoolean() {
-			var b bool
-			b, err = v.ToBoolean()
-			if err != nil {
-				return
-			}
-			if !b {
-				err = ValidationFailedErr
-			}
-		}
-	} else {
-		err = fmt.Errorf("%s should return boolean, got: %v", fnName, v)
+	if !v.IsBoolean() {
+		return fmt.Errorf("%s should return boolean, got: %v", fnName, v)
 	}
-	return
+	b, err := v.ToBoolean()
+	if err != nil {
+		return err
+	}
+	if !b {
+		return ValidationFailedErr
+	}
+	return nil
 }
 
 func (jsr *JSRibosome) validateEntry(fnName string, def *EntryDef, entry Entry, header *Header, sources []string) (err error) {
-
-	e, srcs, err := jsr.prepareJSValidateEntryArgs(def, entry, sources)
+	e, err := jsr.entryValue(def, entry)
 	if err != nil {
 		return
 	}
-
-	hdr := fmt.Sprintf(
-		`{"EntryLink":"%s","Type":"%s","Time":"%s"}`,
-		header.EntryLink.String(),
-		header.Type,
-		header.Time.UTC().Format(time.RFC3339),
-	)
-
-	code := fmt.Sprintf(`%s("%s",%s,%s,%s)`, fnName, def.Name, e, hdr, srcs)
-	Debugf("%s: %s", fnName, code)
-	err = jsr.runValidate(fnName, code)
+	hdr, err := jsr.toJS(map[string]string{
+		"EntryLink": header.EntryLink.String(),
+		"Type":      header.Type,
+		"Time":      header.Time.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return
+	}
+	srcs, err := jsr.toJS(sources)
+	if err != nil {
+		return
+	}
+	Debugf("%s: %s", fnName, def.Name)
+	v, err := jsr.call(fnName, def.Name, e, hdr, srcs)
+	err = jsr.validateResult(fnName, v, err)
 	return
 }
 
@@ -302,6 +349,52 @@ const (
 		`};`
 )
 
+// JSDeterminism replaces Date and Math.random so that validation functions give the same
+// results on every node.  It evaluates to a function which is called from Go with the global
+// object, the original Date and Math.random, and a function that returns what they should do:
+// nothing outside validation, the time in the header being validated, or the error for a
+// nondeterministic call.  The replacements can't be overwritten or redefined by app code,
+// and Date.prototype.constructor is replaced too so the original Date can't be reached.
+// Both javascript ribosomes use it.
+const JSDeterminism = `(function(global,D,random,deterministic){` +
+	`function check(name){var v=deterministic(name);if(typeof v==="string"){throw new Error(v)}return v}` +
+	`function time(){var t=check("Date");return t==null?D.now():t}` +
+	`function FixedDate(a,b,c,d,e,f,g){if(!(this instanceof FixedDate)){return new D(time()).toString()}` +
+	`switch(arguments.length){case 0:return new D(time());case 1:return new D(a);case 2:return new D(a,b);` +
+	`case 3:return new D(a,b,c);case 4:return new D(a,b,c,d);case 5:return new D(a,b,c,d,e);` +
+	`case 6:return new D(a,b,c,d,e,f);default:return new D(a,b,c,d,e,f,g)}}` +
+	`FixedDate.prototype=D.prototype;FixedDate.UTC=D.UTC;FixedDate.parse=D.parse;FixedDate.now=time;` +
+	`function fixedRandom(){check("Math.random");return random()}` +
+	`function fix(o,name,v){Object.defineProperty(o,name,{value:v,writable:false,enumerable:false,configurable:false})}` +
+	`fix(D.prototype,"constructor",FixedDate);fix(global,"Date",Object.freeze(FixedDate));fix(global.Math,"random",fixedRandom)})`
+
+// jsDeterministic returns what the builtins replaced by JSDeterminism should do.  Outside
+// validation the result is nil and they behave as usual, during validation Date gets the
+// time in the header being validated in milliseconds, and anything else is a
+// nondeterministic call.
+func (c *validationContext) jsDeterministic(name string) (result interface{}) {
+	if !c.validating {
+		return
+	}
+	if name == "Date" && c.time != nil {
+		result = c.time.UnixNano() / int64(time.Millisecond)
+		return
+	}
+	result = c.nondeterministic(name).Error()
+	return
+}
+
+// setHostFn adds a host API function to the VM, failing calls to it during validation if it
+// is nondeterministic
+func (jsr *JSRibosome) setHostFn(name string, fn func(otto.FunctionCall) otto.Value) error {
+	return jsr.vm.Set(name, func(call otto.FunctionCall) otto.Value {
+		if err := jsr.checkCall(name); err != nil {
+			return mkOttoErr(jsr, err.Error())
+		}
+		return fn(call)
+	})
+}
+
 // jsSanatizeString makes sure all quotes are quoted and returns are removed
 func jsSanitizeString(s string) string {
 	s = strings.Replace(s, `\`, "%%%slash%%%", -1)
@@ -313,26 +406,36 @@ func jsSanitizeString(s string) string {
 	return s
 }
 
-// Call calls the zygo function that was registered with expose
+// Call calls the javascript function that was registered with expose
 func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
-	var code string
+	p, ok := params.(string)
+	if !ok {
+		err = fmt.Errorf("expecting string params, got: %T", params)
+		return
+	}
+	Debugf("JS Call: %s(%s)", fn.Name, p)
+	var v otto.Value
 	switch fn.CallingType {
 	case STRING_CALLING:
-		code = fmt.Sprintf(`%s("%s");`, fn.Name, jsSanitizeString(params.(string)))
+		v, err = jsr.call(fn.Name, p)
 	case JSON_CALLING:
-		if params.(string) == "" {
-			code = fmt.Sprintf(`JSON.stringify(%s());`, fn.Name)
+		if p == "" {
+			v, err = jsr.call(fn.Name)
 		} else {
-			p := jsSanitizeString(params.(string))
-			code = fmt.Sprintf(`JSON.stringify(%s(JSON.parse("%s")));`, fn.Name, p)
+			var arg otto.Value
+			arg, err = jsr.parse(p)
+			if err != nil {
+				return
+			}
+			v, err = jsr.call(fn.Name, arg)
+		}
+		if err == nil {
+			v, err = jsr.vm.Call("JSON.stringify", nil, v)
 		}
 	default:
 		err = errors.New("params type not implemented")
 		return
 	}
-	Debugf("JS Call: %s", code)
-	var v otto.Value
-	v, err = jsr.vm.Run(code)
 	if err == nil {
 		if v.IsObject() && v.Class() == "Error" {
 			Debugf("JS Error:\n%v", v)
@@ -434,6 +537,8 @@ func jsProcessArgs(jsr *JSRibosome, args []Arg, oArgs []otto.Value) (err error)
 				fallthrough
 			case DataFormatRawZygo:
 				fallthrough
+			case DataFormatBytes:
+				fallthrough
 			case DataFormatString:
 				if !arg.IsString() {
 					return argErr("string", i+1, args[i])
@@ -442,6 +547,8 @@ func jsProcessArgs(jsr *JSRibosome, args []Arg, oArgs []otto.Value) (err error)
 				if err != nil {
 					return err
 				}
+			case DataFormatCBOR:
+				fallthrough
 			case DataFormatLinks:
 				if !arg.IsObject() {
 					return argErr("object", i+1, args[i])
@@ -461,7 +568,10 @@ func jsProcessArgs(jsr *JSRibosome, args []Arg, oArgs []otto.Value) (err error)
 				return err
 			}
 
-			args[i].value = entry
+			args[i].value, err = def.ContentFromString(entry)
+			if err != nil {
+				return err
+			}
 		case MapArg:
 			if arg.IsObject() {
 				m, err := arg.Export()
@@ -518,8 +628,11 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		zome: zome,
 		vm:   otto.New(),
 	}
+	if limits := execLimits(h); limits.StackDepth > 0 {
+		jsr.vm.SetStackDepthLimit(limits.StackDepth)
+	}
 
-	err = jsr.vm.Set("property", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("property", func(call otto.FunctionCall) otto.Value {
 		a := &ActionProperty{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -541,7 +654,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("debug", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("debug", func(call otto.FunctionCall) otto.Value {
 		a := &ActionDebug{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -553,7 +666,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return otto.UndefinedValue()
 	})
 
-	err = jsr.vm.Set("makeHash", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("makeHash", func(call otto.FunctionCall) otto.Value {
 		a := &ActionMakeHash{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -561,7 +674,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return mkOttoErr(&jsr, err.Error())
 		}
 		a.entryType = args[0].value.(string)
-		a.entry = &GobEntry{C: args[1].value.(string)}
+		a.entry = &GobEntry{C: args[1].value}
 		var r interface{}
 		r, err = a.Do(h)
 		if err != nil {
@@ -576,7 +689,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	})
 
 	//===========================================================================
-	err = jsr.vm.Set("getBridges", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("getBridges", func(call otto.FunctionCall) otto.Value {
 		a := &ActionGetBridges{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -606,7 +719,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	})
 
 	//===========================================================================
-	err = jsr.vm.Set("sign", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("sign", func(call otto.FunctionCall) otto.Value {
 		a := &ActionSign{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -628,7 +741,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return result
 	})
 
-	err = jsr.vm.Set("verifySignature", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("verifySignature", func(call otto.FunctionCall) otto.Value {
 
 		a := &ActionVerifySignature{}
 		args := a.Args()
@@ -655,7 +768,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 
 	//============================================================================
 
-	err = jsr.vm.Set("send", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("send", func(call otto.FunctionCall) otto.Value {
 		a := &ActionSend{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -715,7 +828,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return result
 	})
 
-	err = jsr.vm.Set("call", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("call", func(call otto.FunctionCall) otto.Value {
 		a := &ActionCall{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -755,7 +868,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return result
 	})
 
-	err = jsr.vm.Set("bridge", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("bridge", func(call otto.FunctionCall) otto.Value {
 		a := &ActionBridge{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -786,7 +899,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return result
 	})
 
-	err = jsr.vm.Set("commit", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("commit", func(call otto.FunctionCall) otto.Value {
 		var a Action = &ActionCommit{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -795,9 +908,8 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		}
 
 		entryType := args[0].value.(string)
-		entryStr := args[1].value.(string)
 		var r interface{}
-		entry := GobEntry{C: entryStr}
+		entry := GobEntry{C: args[1].value}
 		r, err = NewCommitAction(entryType, &entry).Do(h)
 		if err != nil {
 			return mkOttoErr(&jsr, err.Error())
@@ -814,7 +926,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("query", func(call otto.FunctionCall) otto.Value {
+	err = jsr.setHostFn("query", func(call otto.FunctionCall) otto.Value {
 		a := &ActionQuery{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -884,6 +996,14 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 					entryCode = r.(string)
 				case DataFormatString:
 					entryCode = fmt.Sprintf(`"%s"`, jsSanitizeString(r.(string)))
+				case DataFormatBytes:
+					entryCode = fmt.Sprintf(`"%s"`, base64.StdEncoding.EncodeToString(r.([]byte)))
+				case DataFormatCBOR:
+					j, err := CBORToJSON(r.([]byte))
+					if err != nil {
+						return mkOttoErr(&jsr, err.Error())
+					}
+					entryCode = fmt.Sprintf(`JSON.parse("%s")`, jsSanitizeString(j))
 				case DataFormatLinks:
 					fallthrough
 				case DataFormatJSON:
@@ -928,7 +1048,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return results
 	})
 
-	err = jsr.vm.Set("get", func(call otto.FunctionCall) (result otto.Value) {
+	err = jsr.setHostFn("get", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionGet{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -972,11 +1092,16 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		}
 		if err == nil {
 			getResp := r.(GetResp)
+			var content interface{}
+			content, err = getRespContent(h, getResp)
+			if err != nil {
+				return mkOttoErr(&jsr, err.Error())
+			}
 			var singleValueReturn bool
 			if mask&GetMaskEntry != 0 {
 				if GetMaskEntry == mask {
 					singleValueReturn = true
-					result, err = jsr.vm.ToValue(getResp.Entry.Content())
+					result, err = jsr.vm.ToValue(content)
 				}
 			}
 			if mask&GetMaskEntryType != 0 {
@@ -994,7 +1119,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			if err == nil && !singleValueReturn {
 				respObj := make(map[string]interface{})
 				if mask&GetMaskEntry != 0 {
-					respObj["Entry"] = getResp.Entry.Content()
+					respObj["Entry"] = content
 				}
 				if mask&GetMaskEntryType != 0 {
 					respObj["EntryType"] = getResp.EntryType
@@ -1016,7 +1141,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("update", func(call otto.FunctionCall) (result otto.Value) {
+	err = jsr.setHostFn("update", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionMod{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -1024,10 +1149,9 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return mkOttoErr(&jsr, err.Error())
 		}
 		entryType := args[0].value.(string)
-		entryStr := args[1].value.(string)
 		replaces := args[2].value.(Hash)
 
-		entry := GobEntry{C: entryStr}
+		entry := GobEntry{C: args[1].value}
 		resp, err := NewModAction(entryType, &entry, replaces).Do(h)
 		if err != nil {
 			return mkOttoErr(&jsr, err.Error())
@@ -1045,7 +1169,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("updateAgent", func(call otto.FunctionCall) (result otto.Value) {
+	err = jsr.setHostFn("updateAgent", func(call otto.FunctionCall) (result otto.Value) {
 		a := &ActionModAgent{}
 		//		var a Action = &ActionModAgent{}
 		args := a.Args()
@@ -1102,7 +1226,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("remove", func(call otto.FunctionCall) (result otto.Value) {
+	err = jsr.setHostFn("remove", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionDel{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -1134,7 +1258,7 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	err = jsr.vm.Set("getLinks", func(call otto.FunctionCall) (result otto.Value) {
+	err = jsr.setHostFn("getLinks", func(call otto.FunctionCall) (result otto.Value) {
 		var a Action = &ActionGetLinks{}
 		args := a.Args()
 		err := jsProcessArgs(&jsr, args, call.ArgumentList)
@@ -1194,12 +1318,16 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 						entry = th.E
 					case DataFormatRawZygo:
 						fallthrough
+					case DataFormatBytes:
+						fallthrough
 					case DataFormatString:
 						entry = `"` + jsSanitizeString(th.E) + `"`
 					case DataFormatSysKey:
 						entry = fmt.Sprintf("%v", th.E)
 					case DataFormatSysAgent:
 						fallthrough
+					case DataFormatCBOR:
+						fallthrough
 					case DataFormatLinks:
 						fallthrough
 					case DataFormatJSON:
@@ -1237,23 +1365,198 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		return nil, err
 	}
 
-	l := JSLibrary
-	if h != nil {
-		l += fmt.Sprintf(`var App = {Name:"%s",DNA:{Hash:"%s"},Agent:{Hash:"%s",TopHash:"%s",String:"%s"},Key:{Hash:"%s"}};`, h.Name(), h.dnaHash, h.agentHash, h.agentTopHash, jsSanitizeString(string(h.Agent().Identity())), h.nodeIDStr)
+	err = jsr.vm.Set("hcModule", func(call otto.FunctionCall) otto.Value {
+		name, _ := call.Argument(0).ToString()
+		lib, err := zomeModule(h, name, JSRibosomeType)
+		if err != nil {
+			return mkOttoErr(&jsr, err.Error())
+		}
+		result, _ := jsr.vm.ToValue(map[string]string{"Name": lib.Name, "Code": lib.Code})
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = jsr.setDeterminism()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = jsr.vm.Run(JSLibrary + JSRequire + jsAppVars(h))
+	if err != nil {
+		return
 	}
-	_, err = jsr.Run(l + zome.Code)
+	if lib := zomeLibraryCode(h, JSRibosomeType); lib != "" {
+		_, err = jsr.limited(func() (otto.Value, error) {
+			return jsr.vm.Run(lib)
+		})
+		if err != nil {
+			if _, ok := err.(*ExecLimitErr); !ok {
+				err = errors.New("JS library error: " + err.Error())
+			}
+			return
+		}
+	}
+	var script *otto.Script
+	script, err = jsCompile(jsr.vm, zome.Code)
 	if err != nil {
+		err = errors.New("JS exec error: " + err.Error())
+		return
+	}
+	v, err := jsr.limited(func() (otto.Value, error) {
+		return jsr.vm.Run(script)
+	})
+	if err != nil {
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("JS exec error: " + err.Error())
+		}
 		return
 	}
+	jsr.lastResult = &v
+	jsr.pristine = jsr.vm.Copy()
 	n = &jsr
 	return
 }
 
+// setDeterminism replaces Date and Math.random, see JSDeterminism.  The originals are taken
+// from the VM before any other code has run.
+func (jsr *JSRibosome) setDeterminism() (err error) {
+	var date, math, random, global, fn otto.Value
+	if date, err = jsr.vm.Get("Date"); err != nil {
+		return
+	}
+	if math, err = jsr.vm.Get("Math"); err != nil {
+		return
+	}
+	if random, err = math.Object().Get("random"); err != nil {
+		return
+	}
+	if global, err = jsr.vm.Run("this"); err != nil {
+		return
+	}
+	if fn, err = jsr.vm.Run(JSDeterminism); err != nil {
+		return
+	}
+	_, err = fn.Call(otto.NullValue(), global, date, random, func(call otto.FunctionCall) otto.Value {
+		result, _ := jsr.vm.ToValue(jsr.jsDeterministic(call.Argument(0).String()))
+		return result
+	})
+	return
+}
+
+// jsAppVars returns the code that sets up the App object
+func jsAppVars(h *Holochain) string {
+	if h == nil {
+		return ""
+	}
+	return fmt.Sprintf(`var App = {Name:"%s",DNA:{Hash:"%s"},Agent:{Hash:"%s",TopHash:"%s",String:"%s"},Key:{Hash:"%s"}};`, h.Name(), h.dnaHash, h.agentHash, h.agentTopHash, jsSanitizeString(string(h.Agent().Identity())), h.nodeIDStr)
+}
+
+// Reset returns the VM to the state it was in just after the zome code was loaded.  The
+// host functions find the VM through jsr.vm so they work on the new copy, and the App
+// object is set up again in case the agent changed.
+func (jsr *JSRibosome) Reset() (err error) {
+	jsr.vm = jsr.pristine.Copy()
+	if limits := execLimits(jsr.h); limits.StackDepth > 0 {
+		jsr.vm.SetStackDepthLimit(limits.StackDepth)
+	}
+	jsr.lastResult = nil
+	_, err = jsr.vm.Run(jsAppVars(jsr.h))
+	return
+}
+
+// limited runs fn within the ribosome's execution limits.  otto runs whatever function is
+// waiting on its Interrupt channel before it evaluates each statement and expression, so a
+// function which puts itself back on the channel gets to count every step and to check
+// whether the call has run out of time.
+func (jsr *JSRibosome) limited(fn func() (otto.Value, error)) (v otto.Value, err error) {
+	limits := execLimits(jsr.h)
+	if limits.Timeout > 0 || limits.Steps > 0 {
+		var expired int32
+		steps := limits.Steps
+		interrupt := make(chan func(), 1)
+		var step func()
+		step = func() {
+			if atomic.LoadInt32(&expired) == 1 {
+				panic(&ExecLimitErr{Limit: "time", Value: limits.Timeout})
+			}
+			if limits.Steps > 0 {
+				if steps <= 0 {
+					panic(&ExecLimitErr{Limit: "steps", Value: limits.Steps})
+				}
+				steps--
+			}
+			interrupt <- step
+		}
+		interrupt <- step
+		outer := jsr.vm.Interrupt
+		jsr.vm.Interrupt = interrupt
+		var timer *time.Timer
+		if limits.Timeout > 0 {
+			timer = time.AfterFunc(time.Duration(limits.Timeout)*time.Millisecond, func() {
+				atomic.StoreInt32(&expired, 1)
+			})
+		}
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+			jsr.vm.Interrupt = outer
+			if caught := recover(); caught != nil {
+				e, ok := caught.(*ExecLimitErr)
+				if !ok {
+					panic(caught)
+				}
+				v, err = otto.Value{}, e
+			}
+		}()
+	}
+	v, err = fn()
+	if err != nil && limits.StackDepth > 0 && strings.Contains(err.Error(), "Maximum call stack size exceeded") {
+		err = &ExecLimitErr{Limit: "stack depth", Value: limits.StackDepth}
+	}
+	return
+}
+
+// run executes javascript code
+func (jsr *JSRibosome) run(code string) (otto.Value, error) {
+	return jsr.limited(func() (otto.Value, error) {
+		return jsr.vm.Run(code)
+	})
+}
+
+// call calls the named javascript function, passing it Go values which otto converts, or
+// otto values such as those made by parse and toJS
+func (jsr *JSRibosome) call(fnName string, args ...interface{}) (otto.Value, error) {
+	return jsr.limited(func() (otto.Value, error) {
+		return jsr.vm.Call(fnName, nil, args...)
+	})
+}
+
+// parse converts JSON text into a javascript value
+func (jsr *JSRibosome) parse(j string) (otto.Value, error) {
+	return jsr.vm.Call("JSON.parse", nil, j)
+}
+
+// toJS converts a Go value into a javascript value by way of JSON
+func (jsr *JSRibosome) toJS(v interface{}) (value otto.Value, err error) {
+	var j []byte
+	j, err = json.Marshal(v)
+	if err != nil {
+		return
+	}
+	value, err = jsr.parse(string(j))
+	return
+}
+
 // Run executes javascript code
 func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
-	v, err := jsr.vm.Run(code)
+	v, err := jsr.run(code)
 	if err != nil {
-		err = errors.New("JS exec error: " + err.Error())
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("JS exec error: " + err.Error())
+		}
 		return
 	}
 	jsr.lastResult = &v
@@ -1261,11 +1564,23 @@ func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
 	return
 }
 
+// RunAsyncSendResponse calls the callback function with the response of an asynchronous send
 func (jsr *JSRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
-
-	code := fmt.Sprintf(`%s(JSON.parse("%s"),"%s")`, callback, jsSanitizeString(response.Body), jsSanitizeString(callbackID))
-	Debugf("Calling %s\n", code)
-	result, err = jsr.Run(code)
-
+	Debugf("Calling %s(%s,%s)\n", callback, response.Body, callbackID)
+	var body otto.Value
+	body, err = jsr.parse(response.Body)
+	if err != nil {
+		return
+	}
+	var v otto.Value
+	v, err = jsr.call(callback, body, callbackID)
+	if err != nil {
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("JS exec error: " + err.Error())
+		}
+		return
+	}
+	jsr.lastResult = &v
+	result = &v
 	return
 }
@@ -1159,3 +1159,218 @@ func TestJSProcessArgs(t *testing.T) {
 
 	})
 }
+
+func TestJSBinaryEntries(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	zome := &h.nucleus.dna.Zomes[1]
+	zome.Entries = append(zome.Entries,
+		EntryDef{Name: "blob", DataFormat: DataFormatBytes, Sharing: Public},
+		EntryDef{Name: "record", DataFormat: DataFormatCBOR, Sharing: Public},
+	)
+	zome.Code += "\nfunction validate(entry_type,entry,header,sources) {return true}"
+
+	Convey("it should commit and get bytes entries as base64 strings", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `commit("blob","aGVsbG8=");`})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		hash, err := NewHash(z.lastResult.String())
+		So(err, ShouldBeNil)
+
+		e, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldResemble, []byte("hello"))
+
+		if err := h.dht.simHandleChangeReqs(); err != nil {
+			panic(err)
+		}
+		v, err = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`get("%s");`, hash.String())})
+		So(err, ShouldBeNil)
+		z = v.(*JSRibosome)
+		So(z.lastResult.String(), ShouldEqual, "aGVsbG8=")
+	})
+
+	Convey("it should commit and get cbor entries as JSON", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `commit("record",{name:"Eric"});`})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		hash, err := NewHash(z.lastResult.String())
+		So(err, ShouldBeNil)
+
+		e, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		b, _ := JSONToCBOR(`{"name":"Eric"}`)
+		So(e.Content(), ShouldResemble, b)
+
+		if err := h.dht.simHandleChangeReqs(); err != nil {
+			panic(err)
+		}
+		v, err = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: fmt.Sprintf(`get("%s");`, hash.String())})
+		So(err, ShouldBeNil)
+		z = v.(*JSRibosome)
+		So(z.lastResult.String(), ShouldEqual, `{"name":"Eric"}`)
+	})
+}
+
+func TestJSExecLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.Config.ExecLimits = ExecLimits{Timeout: 100, StackDepth: 50}
+
+	Convey("it should interrupt code that runs too long", t, func() {
+		_, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `while(true){}`})
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "time", Value: 100})
+	})
+
+	Convey("it should stop code that recurses too deeply", t, func() {
+		_, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function f(){return f()};f()`})
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "stack depth", Value: 50})
+	})
+
+	Convey("it should interrupt exposed functions that run too long", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function spin(){while(true){}}`})
+		So(err, ShouldBeNil)
+		_, err = v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "time", Value: 100})
+	})
+
+	Convey("it should stop code that takes too many steps", t, func() {
+		h.Config.ExecLimits = ExecLimits{Steps: 10000}
+		defer func() { h.Config.ExecLimits = ExecLimits{Timeout: 100, StackDepth: 50} }()
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `function spin(){while(true){}}`})
+		So(err, ShouldBeNil)
+		_, err = v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "steps", Value: 10000})
+	})
+
+	Convey("validation that runs too long should reject the entry", t, func() {
+		zome := &h.nucleus.dna.Zomes[1]
+		zome.Code += "\nfunction validateCommit(entry_type,entry,header,pkg,sources) {while(true){}}"
+		_, err := NewCommitAction("oddNumbers", &GobEntry{C: "7"}).Do(h)
+		So(err, ShouldEqual, ValidationFailedErr)
+	})
+}
+
+func TestJSDeterministicValidation(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `
+function validateCommit(name, entry, header, pkg, sources) {
+  switch (entry) {
+  case "date": return Date.now() == 1000 && new Date().getTime() == 1000 && new Date(0).getTime() == 0 && new Date() instanceof Date && new (new Date(0).constructor)().getTime() == 1000;
+  case "random": try { Math.random() } catch (e) {} return true;
+  case "get": get(App.DNA.Hash); return true;
+  case "exit": try { hcDeterminism.exit() } catch (e) {} try { Math.random() } catch (e) {} return true;
+  case "captured": try { random() } catch (e) {} return true;
+  case "replaced": Math.random = function() { return 0.5 }; try { Math.random() } catch (e) {} return true;
+  }
+  return true;
+}
+var random = Math.random;
+function validateCommitPkg(name) { Date.now(); return null }
+function restored() { return Date.now() > 1000 && Math.random() < 1 }
+`})
+	if err != nil {
+		panic(err)
+	}
+	def := &EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+	hdr := mkTestHeader("evenNumbers")
+	commit := func(entry string) *ActionCommit {
+		a := NewCommitAction("evenNumbers", &GobEntry{C: entry})
+		a.header = &hdr
+		return a
+	}
+
+	Convey("the current time should be the time in the header being validated", t, func() {
+		So(v.ValidateAction(commit("date"), def, nil, nil), ShouldBeNil)
+	})
+	Convey("Math.random should fail validation even if the app catches the error", t, func() {
+		err := v.ValidateAction(commit("random"), def, nil, nil)
+		So(err, ShouldResemble, &NondeterministicCallErr{Fn: "Math.random"})
+		So(err.Error(), ShouldEqual, "Math.random is not allowed during validation because its result can differ between nodes")
+	})
+	Convey("host functions that reach the network should fail validation", t, func() {
+		So(v.ValidateAction(commit("get"), def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "get"})
+	})
+	Convey("app code should not be able to get around the replaced Date and Math.random", t, func() {
+		So(v.ValidateAction(commit("exit"), def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "Math.random"})
+		So(v.ValidateAction(commit("captured"), def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "Math.random"})
+		So(v.ValidateAction(commit("replaced"), def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "Math.random"})
+		_, err := v.Run(`Object.defineProperty(Math, "random", {value: function() { return 0.5 }})`)
+		So(err, ShouldNotBeNil)
+		So(v.(*JSRibosome).Reset(), ShouldBeNil)
+		So(v.ValidateAction(commit("captured"), def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "Math.random"})
+	})
+	Convey("the current time should not be available without a header", t, func() {
+		_, err := v.ValidatePackagingRequest(commit("x"), def)
+		So(err, ShouldResemble, &NondeterministicCallErr{Fn: "Date"})
+	})
+	Convey("Date and Math.random should be restored after validation", t, func() {
+		result, err := v.Call(&FunctionDef{Name: "restored", CallingType: STRING_CALLING}, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "true")
+		So(v.ValidateAction(commit("other"), def, nil, nil), ShouldBeNil)
+	})
+}
+
+// trickyPayload is a string that breaks code built by splicing values into source text
+const trickyPayload = "it's \"quoted\" \\ back\\slash\nnew line\t tab \r cr \"); throw 1; (\" ü €"
+
+func TestJSArgumentMarshalling(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `var saved;
+function echo(x) {return x}
+function echoJSON(x) {return x}
+function bridgeGenesis(side,dna,data) {saved=[side,dna,data];return true}
+function validateThing(name,entry,header,sources) {saved=[name,entry,header.Type,sources];return true}
+function asyncResponse(response,id) {saved=[response,id];return true}`})
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*JSRibosome)
+	savedJSON := func() string {
+		_, err := z.Run("JSON.stringify(saved)")
+		So(err, ShouldBeNil)
+		return z.lastResult.String()
+	}
+	payloadJSON, _ := json.Marshal(trickyPayload)
+
+	Convey("string calling should round-trip tricky payloads", t, func() {
+		r, err := v.Call(&FunctionDef{Name: "echo", CallingType: STRING_CALLING}, trickyPayload)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, trickyPayload)
+	})
+
+	Convey("json calling should round-trip tricky payloads", t, func() {
+		params := `{"s":` + string(payloadJSON) + `}`
+		r, err := v.Call(&FunctionDef{Name: "echoJSON", CallingType: JSON_CALLING}, params)
+		So(err, ShouldBeNil)
+		var m map[string]string
+		So(json.Unmarshal([]byte(r.(string)), &m), ShouldBeNil)
+		So(m["s"], ShouldEqual, trickyPayload)
+	})
+
+	Convey("bridge genesis should receive tricky data", t, func() {
+		err := v.BridgeGenesis(BridgeTo, h.dnaHash, trickyPayload)
+		So(err, ShouldBeNil)
+		So(savedJSON(), ShouldEqual, fmt.Sprintf(`[%d,"%s",%s]`, BridgeTo, h.dnaHash.String(), payloadJSON))
+	})
+
+	Convey("validate entry should receive tricky entries", t, func() {
+		def := &EntryDef{Name: "thing", DataFormat: DataFormatString}
+		err := z.validateEntry("validateThing", def, &GobEntry{C: trickyPayload}, &Header{Type: "thing"}, []string{"src"})
+		So(err, ShouldBeNil)
+		So(savedJSON(), ShouldEqual, fmt.Sprintf(`["thing",%s,"thing",["src"]]`, payloadJSON))
+	})
+
+	Convey("async send responses should receive tricky bodies", t, func() {
+		body := `{"s":` + string(payloadJSON) + `}`
+		_, err := v.RunAsyncSendResponse(AppMsg{Body: body}, "asyncResponse", trickyPayload)
+		So(err, ShouldBeNil)
+		So(savedJSON(), ShouldEqual, fmt.Sprintf(`[%s,%s]`, body, payloadJSON))
+	})
+}
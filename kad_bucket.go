@@ -11,6 +11,7 @@ package holochain
 import (
 	"container/list"
 	"sync"
+	"time"
 
 	peer "github.com/libp2p/go-libp2p-peer"
 )
@@ -19,11 +20,20 @@ import (
 type Bucket struct {
 	lk   sync.RWMutex
 	list *list.List
+
+	// peers seen while the bucket was full, most recently seen at the front, that can
+	// replace peers that leave it
+	replacements *list.List
+
+	// when a peer in the bucket was last seen, or a lookup last refreshed it
+	refreshed time.Time
 }
 
 func newBucket() *Bucket {
 	b := new(Bucket)
 	b.list = list.New()
+	b.replacements = list.New()
+	b.refreshed = time.Now()
 	return b
 }
 
@@ -83,6 +93,85 @@ func (b *Bucket) PopBack() peer.ID {
 	return last.Value.(peer.ID)
 }
 
+// Back returns the least recently seen peer in the bucket, or "" if it is empty
+func (b *Bucket) Back() peer.ID {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	last := b.list.Back()
+	if last == nil {
+		return ""
+	}
+	return last.Value.(peer.ID)
+}
+
+// AddReplacement caches a peer to replace one that leaves the bucket, keeping at most max
+// of the most recently seen
+func (b *Bucket) AddReplacement(p peer.ID, max int) {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	removeFromList(b.replacements, p)
+	b.replacements.PushFront(p)
+	for b.replacements.Len() > max {
+		b.replacements.Remove(b.replacements.Back())
+	}
+}
+
+// RemoveReplacement removes a peer from the replacement cache
+func (b *Bucket) RemoveReplacement(p peer.ID) {
+	b.lk.Lock()
+	removeFromList(b.replacements, p)
+	b.lk.Unlock()
+}
+
+// PopReplacement removes and returns the most recently seen replacement, or "" if there
+// are none
+func (b *Bucket) PopReplacement() peer.ID {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	first := b.replacements.Front()
+	if first == nil {
+		return ""
+	}
+	b.replacements.Remove(first)
+	return first.Value.(peer.ID)
+}
+
+// Replacements returns the peers cached to replace ones that leave the bucket
+func (b *Bucket) Replacements() []peer.ID {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	ps := make([]peer.ID, 0, b.replacements.Len())
+	for e := b.replacements.Front(); e != nil; e = e.Next() {
+		ps = append(ps, e.Value.(peer.ID))
+	}
+	return ps
+}
+
+// Touch records that a peer in the bucket was seen or a lookup refreshed it
+func (b *Bucket) Touch(now time.Time) {
+	b.lk.Lock()
+	if now.After(b.refreshed) {
+		b.refreshed = now
+	}
+	b.lk.Unlock()
+}
+
+// Refreshed returns when a peer in the bucket was last seen or a lookup last refreshed it
+func (b *Bucket) Refreshed() time.Time {
+	b.lk.RLock()
+	defer b.lk.RUnlock()
+	return b.refreshed
+}
+
+func removeFromList(l *list.List, id peer.ID) {
+	for e := l.Front(); e != nil; e = e.Next() {
+		if e.Value.(peer.ID) == id {
+			l.Remove(e)
+			return
+		}
+	}
+}
+
 func (b *Bucket) Len() int {
 	b.lk.RLock()
 	defer b.lk.RUnlock()
@@ -96,10 +185,16 @@ func (b *Bucket) Split(cpl int, target peer.ID) *Bucket {
 	b.lk.Lock()
 	defer b.lk.Unlock()
 
-	out := list.New()
 	newbuck := newBucket()
-	newbuck.list = out
-	e := b.list.Front()
+	newbuck.list = splitList(b.list, cpl, target)
+	newbuck.replacements = splitList(b.replacements, cpl, target)
+	return newbuck
+}
+
+// splitList moves the peers with CPL greater than cpl from a list to a new one
+func splitList(l *list.List, cpl int, target peer.ID) *list.List {
+	out := list.New()
+	e := l.Front()
 	for e != nil {
 		peerID := e.Value.(peer.ID)
 		peerCPL := commonPrefixLen(peerID, target)
@@ -107,10 +202,10 @@ func (b *Bucket) Split(cpl int, target peer.ID) *Bucket {
 			cur := e
 			out.PushBack(e.Value)
 			e = e.Next()
-			b.list.Remove(cur)
+			l.Remove(cur)
 			continue
 		}
 		e = e.Next()
 	}
-	return newbuck
+	return out
 }
@@ -0,0 +1,170 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements routing table maintenance as in the Kademlia paper: buckets that haven't been
+// heard from get refreshed with a lookup of a random ID in their range, and the least
+// recently seen peers get pinged and replaced from the buckets' replacement caches if they
+// don't answer, so the table doesn't rot after it fills at startup
+
+package holochain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	RoutingRefreshInterval = 10 * time.Minute // how often the routing table is maintained
+	RoutingBucketStaleAge  = time.Hour        // how long a bucket can go unheard from before it is refreshed
+	RoutingRefreshTimeout  = 30 * time.Second // how long a bucket's refresh lookup may take
+	RoutingPingTimeout     = 10 * time.Second // how long a peer has to answer a liveness ping
+)
+
+var ErrNoRoutingHealth = errors.New("no routing table health has been saved yet")
+
+// pingPeer checks that a peer still answers, by asking it to find itself
+func (node *Node) pingPeer(ctx context.Context, p peer.ID) (err error) {
+	_, err = node.findPeerSingle(ctx, p, HashFromPeerID(p))
+	return
+}
+
+// refreshBuckets looks up a random ID in the range of each bucket that has gone stale, so
+// that the table learns of peers in parts of the keyspace it hasn't heard from lately,
+// returning how many buckets were refreshed
+func (node *Node) refreshBuckets(now time.Time, maxAge time.Duration) (refreshed int) {
+	rt := node.routingTable
+	for _, i := range rt.StaleBuckets(maxAge, now) {
+		target, err := rt.RandomIDInBucket(i)
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(node.ctx, RoutingRefreshTimeout)
+		peers, err := node.GetClosestPeers(ctx, HashFromPeerID(target))
+		if err == nil {
+			for range peers {
+			}
+		}
+		cancel()
+		if err == ErrEmptyRoutingTable {
+			return
+		}
+		if err != nil {
+			Debugf("routing: couldn't refresh bucket %d: %v", i, err)
+			continue
+		}
+		rt.MarkRefreshed(i, now)
+		refreshed++
+	}
+	return
+}
+
+// pingLeastRecentlySeen pings the least recently seen peer of each bucket, evicting those
+// that don't answer in favour of the bucket's cached replacements, returning how many
+// were evicted
+func (node *Node) pingLeastRecentlySeen() (evicted int) {
+	rt := node.routingTable
+	peers := rt.LeastRecentlySeen()
+	for _, p := range peers {
+		ctx, cancel := context.WithTimeout(node.ctx, RoutingPingTimeout)
+		err := node.pingPeer(ctx, p)
+		cancel()
+		if err != nil {
+			Debugf("routing: evicting %v which didn't answer a ping: %v", p, err)
+			rt.Evict(p)
+			evicted++
+		} else {
+			rt.Update(p)
+		}
+	}
+	rt.CountPings(len(peers))
+	return
+}
+
+// RoutingRefresh maintains the routing table on an interval
+func (h *Holochain) RoutingRefresh(interval time.Duration) {
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	h.stopRefreshingTable()
+	var stop chan bool
+	stop = Ticker(interval, func() {
+		now := time.Now()
+		refreshed := h.node.refreshBuckets(now, RoutingBucketStaleAge)
+		evicted := h.node.pingLeastRecentlySeen()
+		h.peerLk.Lock()
+		defer h.peerLk.Unlock()
+		// the refresh may have been stopped while this tick was maintaining the table
+		if h.tableRefreshing != stop {
+			return
+		}
+		health := h.node.routingTable.Health(time.Now())
+		h.dht.dlog.Logf("routing: refreshed %d stale buckets and evicted %d unresponsive peers, %d peers in %d buckets", refreshed, evicted, health.Size, len(health.Buckets))
+		if err := h.saveRoutingHealth(health); err != nil {
+			h.dht.dlog.Logf("error saving routing table health: %v", err)
+		}
+	})
+	h.tableRefreshing = stop
+}
+
+// stopRefreshingTable stops the routing table maintenance ticker, the caller must hold peerLk
+func (h *Holochain) stopRefreshingTable() {
+	if h.tableRefreshing != nil {
+		stop := h.tableRefreshing
+		h.tableRefreshing = nil
+		stop <- true
+	}
+}
+
+// stopRoutingRefresh stops maintaining the routing table, waiting for a tick that is saving
+// the table's health to finish first so it can't write the report afterwards
+func (h *Holochain) stopRoutingRefresh() {
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	h.stopRefreshingTable()
+}
+
+// saveRoutingHealth writes the routing table health report to a file of its own, so it can
+// be shown by a process other than the running node without opening the node's databases.
+// It is written to a temporary file which replaces the report so that a reader never sees
+// half of it.  The caller must hold peerLk.
+func (h *Holochain) saveRoutingHealth(health RoutingTableHealth) (err error) {
+	var b []byte
+	if b, err = json.Marshal(health); err != nil {
+		return
+	}
+	path := filepath.Join(h.DBPath(), TableHealthFileName)
+	os.Remove(path + ".tmp")
+	if err = WriteFile(b, path+".tmp"); err != nil {
+		return
+	}
+	err = os.Rename(path+".tmp", path)
+	return
+}
+
+// RoutingHealth reports the state of the routing table: the live table's if the node is
+// maintaining it, otherwise the last report the running node saved
+func (h *Holochain) RoutingHealth() (health RoutingTableHealth, err error) {
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	if h.tableRefreshing != nil {
+		health = h.node.routingTable.Health(time.Now())
+		return
+	}
+	path := filepath.Join(h.DBPath(), TableHealthFileName)
+	if !FileExists(path) {
+		err = ErrNoRoutingHealth
+		return
+	}
+	var b []byte
+	if b, err = ReadFile(path); err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &health)
+	return
+}
@@ -0,0 +1,75 @@
+package holochain
+
+import (
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoutingRefresh(t *testing.T) {
+	mt := setupMultiNodeTesting(2)
+	defer mt.cleanupMultiNodeTesting()
+	h := mt.nodes[0]
+	other := mt.nodes[1].node.HashAddr
+
+	unreachable, _ := makePeer("unreachable")
+	addr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1")
+	if err := h.AddPeer(unreachable, []ma.Multiaddr{addr}); err != nil {
+		panic(err)
+	}
+	connect(t, mt.ctx, h, mt.nodes[1])
+
+	Convey("it should evict peers that don't answer a ping", t, func() {
+		So(h.node.routingTable.LeastRecentlySeen(), ShouldResemble, []peer.ID{unreachable})
+		So(h.node.pingLeastRecentlySeen(), ShouldEqual, 1)
+		So(h.node.routingTable.Find(unreachable), ShouldEqual, peer.ID(""))
+		So(h.node.pingLeastRecentlySeen(), ShouldEqual, 0)
+		So(h.node.routingTable.Find(other), ShouldEqual, other)
+	})
+
+	Convey("it should refresh buckets that have gone stale with a lookup", t, func() {
+		later := time.Now().Add(2 * RoutingBucketStaleAge)
+		So(h.node.refreshBuckets(time.Now(), RoutingBucketStaleAge), ShouldEqual, 0)
+		So(h.node.refreshBuckets(later, RoutingBucketStaleAge), ShouldEqual, 1)
+		So(len(h.node.routingTable.StaleBuckets(RoutingBucketStaleAge, later)), ShouldEqual, 0)
+	})
+
+	Convey("it should report the table's health from what the running node saved", t, func() {
+		_, err := h.RoutingHealth()
+		So(err, ShouldEqual, ErrNoRoutingHealth)
+
+		health := h.node.routingTable.Health(time.Now())
+		So(health.Size, ShouldEqual, 1)
+		So(health.Pings, ShouldEqual, 2)
+		So(health.Evictions, ShouldEqual, 1)
+		So(health.Refreshes, ShouldEqual, 1)
+		h.peerLk.Lock()
+		So(h.saveRoutingHealth(health), ShouldBeNil)
+		h.peerLk.Unlock()
+		So(FileExists(filepath.Join(h.DBPath(), TableHealthFileName)), ShouldBeTrue)
+		So(h.peerDB, ShouldBeNil)
+
+		saved, err := h.RoutingHealth()
+		So(err, ShouldBeNil)
+		So(saved.Size, ShouldEqual, health.Size)
+		So(saved.Pings, ShouldEqual, health.Pings)
+		So(len(saved.Buckets), ShouldEqual, len(health.Buckets))
+		So(saved.String(), ShouldContainSubstring, "1 peers in 1 buckets")
+	})
+
+	Convey("stopping the refresh should wait for a tick that is saving the report", t, func() {
+		path := filepath.Join(h.DBPath(), TableHealthFileName)
+		h.RoutingRefresh(time.Millisecond)
+		So(h.tableRefreshing, ShouldNotBeNil)
+		time.Sleep(time.Millisecond * 50)
+		h.stopRoutingRefresh()
+		So(h.tableRefreshing, ShouldBeNil)
+		os.Remove(path)
+		time.Sleep(time.Millisecond * 50)
+		So(FileExists(path), ShouldBeFalse)
+	})
+}
@@ -10,10 +10,12 @@ package holochain
 
 import (
 	"container/list"
+	"crypto/rand"
 	"fmt"
 	peer "github.com/libp2p/go-libp2p-peer"
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	. "github.com/metacurrency/holochain/hash"
+	mh "github.com/multiformats/go-multihash"
 	"sort"
 	"sync"
 	"time"
@@ -41,6 +43,30 @@ type RoutingTable struct {
 	// notification functions
 	PeerRemoved func(peer.ID)
 	PeerAdded   func(peer.ID)
+
+	// counts of the table's maintenance, see RoutingTableHealth
+	refreshes  int
+	pings      int
+	evictions  int
+	promotions int
+}
+
+// BucketHealth reports the state of a routing table bucket
+type BucketHealth struct {
+	Peers        int
+	Replacements int       // peers cached to replace ones that leave the bucket
+	Refreshed    time.Time // when a peer in the bucket was last seen or a lookup last refreshed it
+}
+
+// RoutingTableHealth reports the state of the routing table and how it has been maintained
+type RoutingTableHealth struct {
+	Time       time.Time // when the report was made
+	Size       int
+	Buckets    []BucketHealth
+	Refreshes  int // lookups of random IDs run to refresh stale buckets
+	Pings      int // liveness pings sent to the least recently seen peers
+	Evictions  int // peers removed for not answering a ping
+	Promotions int // cached replacements moved into the table
 }
 
 // NewRoutingTable creates a new routing table with a given bucketsize, local ID, and latency tolerance.
@@ -75,6 +101,7 @@ func (rt *RoutingTable) Update(p peer.ID) {
 	}
 
 	bucket := rt.Buckets[bucketID]
+	bucket.Touch(time.Now())
 	if bucket.Has(p) {
 		// If the peer is already in the table, move it to the front.
 		// This signifies that it it "more active" and the less active nodes
@@ -88,22 +115,24 @@ func (rt *RoutingTable) Update(p peer.ID) {
 		return
 	}
 
+	if bucket.Len() >= rt.bucketsize && bucketID != len(rt.Buckets)-1 {
+		// The bucket is full and can't split, so as in the Kademlia paper keep
+		// the peers already in it, which are likely to stay up longer, and cache
+		// the new peer to replace any of them that stop answering pings
+		bucket.AddReplacement(p, rt.bucketsize)
+		return
+	}
+
 	// New peer, add to bucket
+	bucket.RemoveReplacement(p)
 	bucket.PushFront(p)
 	rt.PeerAdded(p)
 
 	// Are we past the max bucket size?
 	if bucket.Len() > rt.bucketsize {
-		// If this bucket is the rightmost bucket, and its full
+		// this bucket is the rightmost bucket, and its full
 		// we need to split it and create a new bucket
-		if bucketID == len(rt.Buckets)-1 {
-			rt.PeerRemoved(rt.nextBucket())
-			return
-		} else {
-			// If the bucket cant split kick out least active node
-			rt.PeerRemoved(bucket.PopBack())
-			return
-		}
+		rt.PeerRemoved(rt.nextBucket())
 	}
 }
 
@@ -120,8 +149,32 @@ func (rt *RoutingTable) Remove(p peer.ID) {
 	}
 
 	bucket := rt.Buckets[bucketID]
+	bucket.RemoveReplacement(p)
+	if !bucket.Has(p) {
+		rt.PeerRemoved(p)
+		return
+	}
 	bucket.Remove(p)
 	rt.PeerRemoved(p)
+
+	// fill the gap with the most recently seen replacement, at the back of the bucket
+	// so it's the next to be pinged
+	if r := bucket.PopReplacement(); r != "" {
+		bucket.lk.Lock()
+		bucket.list.PushBack(r)
+		bucket.lk.Unlock()
+		rt.promotions++
+		rt.PeerAdded(r)
+	}
+}
+
+// Evict removes a peer that didn't answer a liveness ping, replacing it with a cached
+// peer if there is one
+func (rt *RoutingTable) Evict(p peer.ID) {
+	rt.Remove(p)
+	rt.tabLock.Lock()
+	rt.evictions++
+	rt.tabLock.Unlock()
 }
 
 func (rt *RoutingTable) nextBucket() peer.ID {
@@ -134,11 +187,123 @@ func (rt *RoutingTable) nextBucket() peer.ID {
 
 	// If all elements were on left side of split...
 	if bucket.Len() > rt.bucketsize {
-		return bucket.PopBack()
+		p := bucket.PopBack()
+		bucket.AddReplacement(p, rt.bucketsize)
+		return p
 	}
 	return ""
 }
 
+// StaleBuckets returns the indexes of the buckets that no peer has been seen in, and no
+// lookup has refreshed, for maxAge
+func (rt *RoutingTable) StaleBuckets(maxAge time.Duration, now time.Time) (stale []int) {
+	rt.tabLock.RLock()
+	defer rt.tabLock.RUnlock()
+	for i, b := range rt.Buckets {
+		if now.Sub(b.Refreshed()) >= maxAge {
+			stale = append(stale, i)
+		}
+	}
+	return
+}
+
+// MarkRefreshed records that a lookup refreshed a bucket
+func (rt *RoutingTable) MarkRefreshed(i int, now time.Time) {
+	rt.tabLock.Lock()
+	defer rt.tabLock.Unlock()
+	if i < len(rt.Buckets) {
+		rt.Buckets[i].Touch(now)
+		rt.refreshes++
+	}
+}
+
+// RandomIDInBucket returns a random ID that belongs in the bucket with index i, i.e. that
+// has a common prefix of exactly i bits with the local ID, or at least i bits for the last
+// bucket.  Other buckets whose IDs would differ from the local ID in its multihash prefix
+// can't hold any peers, so have no IDs.
+func (rt *RoutingTable) RandomIDInBucket(i int) (id peer.ID, err error) {
+	local := []byte(rt.local)
+	decoded, err := mh.Decode(local)
+	if err != nil {
+		return
+	}
+	prefixBits := (len(local) - len(decoded.Digest)) * 8
+	rt.tabLock.RLock()
+	last := len(rt.Buckets) - 1
+	rt.tabLock.RUnlock()
+	if i == last && i < prefixBits {
+		i = prefixBits
+	}
+	if i < prefixBits || i >= len(local)*8 {
+		err = fmt.Errorf("no peer IDs belong in bucket %d", i)
+		return
+	}
+	b := make([]byte, len(local))
+	copy(b, local)
+	r := make([]byte, len(local))
+	if _, err = rand.Read(r); err != nil {
+		return
+	}
+	// keep the first i bits, flip bit i and randomize the rest
+	for j := i / 8; j < len(b); j++ {
+		mask := byte(0xff)
+		if j == i/8 {
+			mask = 0xff >> uint(i%8+1)
+		}
+		b[j] = b[j]&^mask | r[j]&mask
+	}
+	b[i/8] ^= 0x80 >> uint(i%8)
+	id = peer.ID(b)
+	return
+}
+
+// LeastRecentlySeen returns the least recently seen peer of each bucket that has any
+func (rt *RoutingTable) LeastRecentlySeen() (peers []peer.ID) {
+	rt.tabLock.RLock()
+	defer rt.tabLock.RUnlock()
+	for _, b := range rt.Buckets {
+		if p := b.Back(); p != "" {
+			peers = append(peers, p)
+		}
+	}
+	return
+}
+
+// CountPings records how many liveness pings were sent to the table's peers
+func (rt *RoutingTable) CountPings(count int) {
+	rt.tabLock.Lock()
+	rt.pings += count
+	rt.tabLock.Unlock()
+}
+
+// Health reports the state of the table and how it has been maintained
+func (rt *RoutingTable) Health(now time.Time) (health RoutingTableHealth) {
+	rt.tabLock.RLock()
+	defer rt.tabLock.RUnlock()
+	health.Time = now
+	for _, b := range rt.Buckets {
+		bh := BucketHealth{Peers: b.Len(), Replacements: len(b.Replacements()), Refreshed: b.Refreshed()}
+		health.Size += bh.Peers
+		health.Buckets = append(health.Buckets, bh)
+	}
+	health.Refreshes = rt.refreshes
+	health.Pings = rt.pings
+	health.Evictions = rt.evictions
+	health.Promotions = rt.promotions
+	return
+}
+
+// String converts a routing table health report into a human readable string
+func (health RoutingTableHealth) String() (result string) {
+	result = fmt.Sprintf("Routing table at %v: %d peers in %d buckets\n", health.Time.Format(time.RFC3339), health.Size, len(health.Buckets))
+	for i, b := range health.Buckets {
+		age := health.Time.Sub(b.Refreshed) / time.Second * time.Second
+		result += fmt.Sprintf("  bucket %d: %d peers, %d replacements, refreshed %v ago\n", i, b.Peers, b.Replacements, age)
+	}
+	result += fmt.Sprintf("Maintenance: %d refresh lookups, %d pings, %d evictions, %d promotions\n", health.Refreshes, health.Pings, health.Evictions, health.Promotions)
+	return
+}
+
 // Find a specific peer by ID or return nil
 func (rt *RoutingTable) Find(id peer.ID) peer.ID {
 	srch := rt.NearestPeers(HashFromPeerID(id), 1)
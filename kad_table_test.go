@@ -199,6 +199,107 @@ func TestTableMultithreaded(t *testing.T) {
 	<-done
 }
 
+func TestRandomIDInBucket(t *testing.T) {
+	local := tu.RandPeerIDFatal(t)
+	m := pstore.NewMetrics()
+	rt := NewRoutingTable(10, local, time.Hour, m)
+
+	// with a single bucket, targets for it start after the multihash prefix
+	id, err := rt.RandomIDInBucket(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpl := commonPrefixLen(id, local); cpl != 16 {
+		t.Fatalf("expected random id for the only bucket to have cpl 16, got %d", cpl)
+	}
+
+	for i := 0; i < 20; i++ {
+		rt.nextBucket()
+	}
+	for i := 16; i < 20; i++ {
+		id, err := rt.RandomIDInBucket(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cpl := commonPrefixLen(id, local); cpl != i {
+			t.Fatalf("expected random id for bucket %d to have that cpl, got %d", i, cpl)
+		}
+	}
+	if _, err := rt.RandomIDInBucket(3); err == nil {
+		t.Fatal("expected no ids in a bucket inside the multihash prefix")
+	}
+}
+
+func TestTableReplacements(t *testing.T) {
+	local := tu.RandPeerIDFatal(t)
+	m := pstore.NewMetrics()
+	rt := NewRoutingTable(2, local, time.Hour, m)
+	added := make(map[peer.ID]bool)
+	rt.PeerAdded = func(p peer.ID) {
+		added[p] = true
+	}
+	rt.PeerRemoved = func(p peer.ID) {
+		delete(added, p)
+	}
+
+	// peers that share exactly 16 bits with the local id all belong in bucket 16, so the
+	// third one overflows it when the table splits
+	var peers []peer.ID
+	for i := 0; i < 4; i++ {
+		id, err := rt.RandomIDInBucket(16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers = append(peers, id)
+		rt.Update(id)
+	}
+
+	bucket := rt.Buckets[16]
+	if bucket.Len() != 2 || len(added) != 2 {
+		t.Fatalf("expected the full bucket to keep 2 peers, got %d", bucket.Len())
+	}
+	replacements := bucket.Replacements()
+	if len(replacements) != 2 || replacements[0] != peers[3] {
+		t.Fatalf("expected the other peers to be cached as replacements, got %v", replacements)
+	}
+
+	evicted := bucket.Back()
+	rt.Evict(evicted)
+	if bucket.Has(evicted) || !bucket.Has(peers[3]) || bucket.Back() != peers[3] || !added[peers[3]] {
+		t.Fatal("expected the most recently seen replacement to take the evicted peer's place")
+	}
+
+	health := rt.Health(time.Now())
+	if health.Size != 2 || health.Evictions != 1 || health.Promotions != 1 || health.Buckets[16].Replacements != 1 {
+		t.Fatalf("unexpected health: %v", health)
+	}
+}
+
+func TestStaleBuckets(t *testing.T) {
+	local := tu.RandPeerIDFatal(t)
+	m := pstore.NewMetrics()
+	rt := NewRoutingTable(10, local, time.Hour, m)
+	for i := 0; i < 50; i++ {
+		rt.Update(tu.RandPeerIDFatal(t))
+	}
+
+	now := time.Now()
+	if stale := rt.StaleBuckets(time.Hour, now); len(stale) != 0 {
+		t.Fatalf("expected no stale buckets, got %v", stale)
+	}
+	later := now.Add(2 * time.Hour)
+	if stale := rt.StaleBuckets(time.Hour, later); len(stale) != len(rt.Buckets) {
+		t.Fatalf("expected all %d buckets to go stale, got %v", len(rt.Buckets), stale)
+	}
+	rt.MarkRefreshed(0, later)
+	if stale := rt.StaleBuckets(time.Hour, later); len(stale) != len(rt.Buckets)-1 || stale[0] == 0 {
+		t.Fatalf("expected a refreshed bucket not to be stale, got %v", stale)
+	}
+	if rt.Health(later).Refreshes != 1 {
+		t.Fatal("expected the refresh to be counted")
+	}
+}
+
 /*
 func BenchmarkUpdates(b *testing.B) {
 	b.StopTimer()
@@ -0,0 +1,134 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements code shared by an app's zomes: libraries which are loaded into every zome
+// of their ribosome type before the zome's own code, and modules which zome code loads
+// with require.  Both are part of the DNA so they are included in the DNA hash.
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrModuleNotFound = errors.New("module not found")
+
+// Library holds a file of zome code that is shared by an app's zomes
+type Library struct {
+	Name         string // the file's path relative to the DNA directory
+	RibosomeType string
+	Code         string
+}
+
+// ribosomeTypeBySuffix returns the ribosome type of a code file from its suffix
+func ribosomeTypeBySuffix(file string) (ribosomeType string) {
+	for _, t := range []string{JSRibosomeType, ZygoRibosomeType, ESRibosomeType} {
+		if strings.HasSuffix(file, suffixByRibosomeType(t)) {
+			ribosomeType = t
+			return
+		}
+	}
+	return
+}
+
+// loadLibraries reads library files given by their paths relative to the DNA directory
+func loadLibraries(dnaPath string, files []string) (libs []Library, err error) {
+	for _, file := range files {
+		name := path.Clean(filepath.ToSlash(file))
+		if path.IsAbs(name) || strings.HasPrefix(name, "../") {
+			err = fmt.Errorf("library file must be in the DNA directory: %s", file)
+			return
+		}
+		lib := Library{Name: name, RibosomeType: ribosomeTypeBySuffix(name)}
+		if lib.RibosomeType == "" {
+			err = fmt.Errorf("unknown ribosome type for library file: %s", file)
+			return
+		}
+		if !FileExists(filepath.Join(dnaPath, filepath.FromSlash(name))) {
+			err = errors.New("DNA specified library file missing: " + file)
+			return
+		}
+		var code []byte
+		code, err = ReadFile(dnaPath, filepath.FromSlash(name))
+		if err != nil {
+			return
+		}
+		lib.Code = string(code)
+		libs = append(libs, lib)
+	}
+	return
+}
+
+// saveLibraries writes library files into the DNA directory and returns their paths
+func saveLibraries(dnaPath string, libs []Library) (files []string, err error) {
+	for _, lib := range libs {
+		p := filepath.Join(dnaPath, filepath.FromSlash(lib.Name))
+		if err = os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			return
+		}
+		if err = WriteFile([]byte(lib.Code), filepath.Dir(p), filepath.Base(p)); err != nil {
+			return
+		}
+		files = append(files, lib.Name)
+	}
+	return
+}
+
+// LibraryCode returns the code of the DNA's libraries for a ribosome type, in the order
+// they were declared
+func (dna *DNA) LibraryCode(ribosomeType string) (code string) {
+	for _, lib := range dna.Libraries {
+		if lib.RibosomeType == ribosomeType {
+			code += lib.Code + "\n"
+		}
+	}
+	return
+}
+
+// Module returns the module that zome code of a ribosome type gets by requiring name.
+// Names are resolved relative to the DNA directory and may leave off the file suffix.
+func (dna *DNA) Module(name string, ribosomeType string) (lib *Library, err error) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	for _, n := range []string{name, name + suffixByRibosomeType(ribosomeType)} {
+		for i := range dna.Modules {
+			if dna.Modules[i].Name == n && dna.Modules[i].RibosomeType == ribosomeType {
+				lib = &dna.Modules[i]
+				return
+			}
+		}
+	}
+	err = fmt.Errorf("%v: %s", ErrModuleNotFound, name)
+	return
+}
+
+// zomeLibraryCode returns the library code to load before a zome's code
+func zomeLibraryCode(h *Holochain, ribosomeType string) string {
+	if h == nil || h.nucleus == nil {
+		return ""
+	}
+	return h.nucleus.dna.LibraryCode(ribosomeType)
+}
+
+// zomeModule returns the module that zome code of a ribosome type gets by requiring name
+func zomeModule(h *Holochain, name string, ribosomeType string) (lib *Library, err error) {
+	if h == nil || h.nucleus == nil {
+		err = fmt.Errorf("%v: %s", ErrModuleNotFound, name)
+		return
+	}
+	lib, err = h.nucleus.dna.Module(name, ribosomeType)
+	return
+}
+
+// JSRequire implements CommonJS style modules for the javascript ribosomes on top of the
+// hcModule host function which returns a module's resolved name and code
+const JSRequire = `var require=(function(){var cache={};return function(name){` +
+	`var m=hcModule(name);if(typeof m.Code!=="string"){throw m}` +
+	`if(!cache[m.Name]){var module={exports:{}};cache[m.Name]=module;` +
+	`(new Function("module","exports","require",m.Code))(module,module.exports,require)}` +
+	`return cache[m.Name].exports}})();`
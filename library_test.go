@@ -0,0 +1,111 @@
+package holochain
+
+import (
+	"bytes"
+	zygo "github.com/glycerine/zygomys/repl"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLibraries(t *testing.T) {
+	d := SetupTestDir()
+	defer CleanupTestDir(d)
+
+	os.MkdirAll(filepath.Join(d, "lib"), os.ModePerm)
+	WriteFile([]byte("function helper() {return 1}"), d, "lib", "helper.js")
+
+	Convey("it should load library files relative to the DNA directory", t, func() {
+		libs, err := loadLibraries(d, []string{"./lib/helper.js"})
+		So(err, ShouldBeNil)
+		So(libs, ShouldResemble, []Library{{Name: "lib/helper.js", RibosomeType: JSRibosomeType, Code: "function helper() {return 1}"}})
+	})
+
+	Convey("it should reject missing, outside and unknown library files", t, func() {
+		_, err := loadLibraries(d, []string{"lib/missing.js"})
+		So(err.Error(), ShouldEqual, "DNA specified library file missing: lib/missing.js")
+		_, err = loadLibraries(d, []string{"../lib/helper.js"})
+		So(err.Error(), ShouldEqual, "library file must be in the DNA directory: ../lib/helper.js")
+		_, err = loadLibraries(d, []string{"lib/helper.txt"})
+		So(err.Error(), ShouldEqual, "unknown ribosome type for library file: lib/helper.txt")
+	})
+}
+
+func TestDNAModule(t *testing.T) {
+	dna := DNA{Modules: []Library{
+		{Name: "lib/anchors.js", RibosomeType: JSRibosomeType, Code: "js"},
+		{Name: "lib/anchors.zy", RibosomeType: ZygoRibosomeType, Code: "zy"},
+	}}
+	Convey("it should resolve module names for the ribosome type", t, func() {
+		lib, err := dna.Module("./lib/anchors", JSRibosomeType)
+		So(err, ShouldBeNil)
+		So(lib.Code, ShouldEqual, "js")
+		lib, err = dna.Module("lib/anchors.zy", ZygoRibosomeType)
+		So(err, ShouldBeNil)
+		So(lib.Code, ShouldEqual, "zy")
+		_, err = dna.Module("lib/anchors.zy", JSRibosomeType)
+		So(err.Error(), ShouldEqual, "module not found: lib/anchors.zy")
+	})
+}
+
+func TestZomeLibraries(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	dna := h.nucleus.dna
+	dna.Libraries = []Library{
+		{Name: "lib/double.js", RibosomeType: JSRibosomeType, Code: "function double(x) {return x*2}"},
+		{Name: "lib/double.zy", RibosomeType: ZygoRibosomeType, Code: "(defn double [x] (* x 2))"},
+	}
+	dna.Modules = []Library{
+		{Name: "lib/triple.js", RibosomeType: JSRibosomeType, Code: `var inc = require("lib/inc"); exports.triple = function(x) {return inc.count(x*3)}`},
+		{Name: "lib/inc.js", RibosomeType: JSRibosomeType, Code: `var n = 0; exports.count = function(x) {n++; return x}; exports.n = function() {return n}`},
+		{Name: "lib/triple.zy", RibosomeType: ZygoRibosomeType, Code: "(defn triple [x] (* x 3))"},
+	}
+
+	Convey("js zomes should get libraries and modules", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `var t = require("./lib/triple"); var i = require("lib/inc.js");`})
+		So(err, ShouldBeNil)
+		_, err = v.Run(`double(t.triple(2)) + i.count(0) + i.n()`)
+		So(err, ShouldBeNil)
+		// inc is only loaded once so its counter is shared
+		So(v.(*JSRibosome).lastResult.String(), ShouldEqual, "14")
+
+		_, err = NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: `require("lib/missing")`})
+		So(err.Error(), ShouldContainSubstring, "module not found: lib/missing")
+	})
+
+	Convey("zygo zomes should get libraries and modules", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(require "lib/triple") (def y (double (triple 2)))`})
+		So(err, ShouldBeNil)
+		_, err = v.Run("y")
+		So(err, ShouldBeNil)
+		So(v.(*ZygoRibosome).lastResult.(*zygo.SexpInt).Val, ShouldEqual, 12)
+
+		_, err = NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(require "lib/missing")`})
+		So(err.Error(), ShouldContainSubstring, "module not found: lib/missing")
+	})
+
+	Convey("zygo requires should only be resolved when they are called", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(def s "(require \"lib/missing\")") // (require "lib/missing")
+(defn f [] (require "lib/triple"))`})
+		So(err, ShouldBeNil)
+		_, err = v.Run("s")
+		So(err, ShouldBeNil)
+		So(v.(*ZygoRibosome).lastResult.(*zygo.SexpStr).S, ShouldEqual, `(require "lib/missing")`)
+
+		So(len(v.(*ZygoRibosome).modules), ShouldEqual, 0)
+		_, err = v.Run("(f) (f) (triple 2)")
+		So(err, ShouldBeNil)
+		So(v.(*ZygoRibosome).lastResult.(*zygo.SexpInt).Val, ShouldEqual, 6)
+	})
+
+	Convey("libraries should be part of the DNA hash", t, func() {
+		var before, after bytes.Buffer
+		So(h.EncodeDNA(&before), ShouldBeNil)
+		dna.Libraries[0].Code += " "
+		So(h.EncodeDNA(&after), ShouldBeNil)
+		So(before.String(), ShouldNotEqual, after.String())
+	})
+}
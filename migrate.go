@@ -0,0 +1,213 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements migrating chain data from a holochain to a new holochain based on it
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+)
+
+const (
+	// MigrateFunctionName is the name of the zome function called to upgrade an
+	// entry whose definition has a different SchemaVersion in the new DNA
+	MigrateFunctionName = "migrate"
+)
+
+var ErrNotBasedOn = errors.New("DNA is not based on the holochain being migrated from")
+
+// MigrationArgs holds the arguments passed to a zome's migrate function
+type MigrationArgs struct {
+	EntryType   string
+	FromVersion int
+	ToVersion   int
+	Entry       interface{}
+}
+
+// Migrate clones the live entries of the old holochain's chain into this holochain, whose
+// DNA must be BasedOn the old one.  Entries whose schema version changed are passed
+// through the zome's migrate function and every entry is committed, and thus validated,
+// as if it were new.  Chunked entries are reassembled and migrated as a whole.  Hashes
+// in links entries are re-pointed at the migrated entries.
+// Returns the number of entries migrated.
+func (h *Holochain) Migrate(old *Holochain) (count int, err error) {
+	oldDNAHash := old.DNAHash()
+	if !h.nucleus.dna.BasedOn.Equal(&oldDNAHash) {
+		err = ErrNotBasedOn
+		return
+	}
+	if !h.Started() {
+		err = errors.New("chain not yet started")
+		return
+	}
+
+	// entries that were modified or deleted on the old chain don't get migrated, and
+	// neither do chunks, which are migrated as a whole along with their manifest
+	replaced := make(map[string]bool)
+	chunks := make(map[string]bool)
+	for i, header := range old.chain.Headers {
+		if header.Change.Action == ModAction || header.Change.Action == DelAction {
+			replaced[header.Change.Hash.String()] = true
+		}
+		if header.Type == ManifestEntryType {
+			for _, chunk := range old.chain.Entries[i].Content().(ChunkManifest).Chunks {
+				chunks[chunk.String()] = true
+			}
+		}
+	}
+
+	hashes := map[string]string{
+		oldDNAHash.String():         h.DNAHash().String(),
+		old.AgentHash().String():    h.AgentHash().String(),
+		old.AgentTopHash().String(): h.AgentTopHash().String(),
+		old.nodeIDStr:               h.nodeIDStr,
+	}
+
+	for i, header := range old.chain.Headers {
+		if header.Change.Action == DelAction || replaced[header.EntryLink.String()] || chunks[header.EntryLink.String()] {
+			continue
+		}
+
+		// a chunked entry is reassembled and migrated as a single entry of its type,
+		// and committing it chunks it again according to the new DNA's ChunkSize
+		entryType := header.Type
+		entry := old.chain.Entries[i]
+		if entryType == ManifestEntryType {
+			m := entry.Content().(ChunkManifest)
+			var b []byte
+			b, err = old.getChunked(&m, true)
+			if err != nil {
+				err = fmt.Errorf("error reading chunked %s entry %v: %v", m.EntryType, header.EntryLink, err)
+				return
+			}
+			entryType = m.EntryType
+			entry = &GobEntry{C: b}
+		}
+
+		var oldDef *EntryDef
+		_, oldDef, err = old.GetEntryDef(entryType)
+		if err != nil {
+			return
+		}
+		if oldDef.IsSysEntry() {
+			continue
+		}
+
+		var z *Zome
+		var def *EntryDef
+		z, def, err = h.GetEntryDef(entryType)
+		if err != nil {
+			Debugf("Migrate: skipping %s entry not in new DNA: %v", entryType, header.EntryLink)
+			err = nil
+			continue
+		}
+
+		var content string
+		content, err = oldDef.ContentString(entry)
+		if err != nil {
+			err = fmt.Errorf("error reading %s entry %v: %v", entryType, header.EntryLink, err)
+			return
+		}
+		if def.SchemaVersion != oldDef.SchemaVersion {
+			content, err = h.migrateEntry(z, def, oldDef.SchemaVersion, content)
+			if err != nil {
+				err = fmt.Errorf("error migrating %s entry %v: %v", entryType, header.EntryLink, err)
+				return
+			}
+		}
+		if def.DataFormat == DataFormatLinks {
+			content, err = migrateLinks(content, hashes)
+			if err != nil {
+				return
+			}
+		}
+
+		var c interface{}
+		c, err = def.ContentFromString(content)
+		if err != nil {
+			err = fmt.Errorf("error migrating %s entry %v: %v", entryType, header.EntryLink, err)
+			return
+		}
+		var r interface{}
+		r, err = NewCommitAction(entryType, &GobEntry{C: c}).Do(h)
+		if err != nil {
+			err = fmt.Errorf("error committing migrated %s entry %v: %v", entryType, header.EntryLink, err)
+			return
+		}
+		hashes[header.EntryLink.String()] = r.(Hash).String()
+		count++
+	}
+	return
+}
+
+// migrateEntry calls the zome's migrate function to convert entry content from an old schema version
+func (h *Holochain) migrateEntry(z *Zome, def *EntryDef, fromVersion int, content string) (migrated string, err error) {
+	args := MigrationArgs{EntryType: def.Name, FromVersion: fromVersion, ToVersion: def.SchemaVersion}
+	// cbor content is handed to the migrate function as JSON, and bytes content as base64
+	isJSON := def.DataFormat == DataFormatJSON || def.DataFormat == DataFormatLinks || def.DataFormat == DataFormatCBOR
+	if isJSON {
+		err = json.Unmarshal([]byte(content), &args.Entry)
+		if err != nil {
+			return
+		}
+	} else {
+		args.Entry = content
+	}
+
+	var j []byte
+	j, err = json.Marshal(args)
+	if err != nil {
+		return
+	}
+
+	var r Ribosome
+	r, err = z.MakeRibosome(h)
+	if err != nil {
+		return
+	}
+	var result interface{}
+	result, err = r.Call(&FunctionDef{Name: MigrateFunctionName, CallingType: JSON_CALLING}, string(j))
+	if err != nil {
+		return
+	}
+	migrated, ok := result.(string)
+	if !ok {
+		err = fmt.Errorf("%s returned %T instead of a string", MigrateFunctionName, result)
+		return
+	}
+	if !isJSON {
+		err = json.Unmarshal([]byte(migrated), &migrated)
+		if err != nil {
+			err = fmt.Errorf("%s should return a string for %s entries", MigrateFunctionName, def.DataFormat)
+		}
+	}
+	return
+}
+
+// migrateLinks re-points the bases and links in a links entry at their migrated hashes
+func migrateLinks(content string, hashes map[string]string) (migrated string, err error) {
+	var le LinksEntry
+	err = json.Unmarshal([]byte(content), &le)
+	if err != nil {
+		return
+	}
+	for i, l := range le.Links {
+		if n, ok := hashes[l.Base]; ok {
+			le.Links[i].Base = n
+		}
+		if n, ok := hashes[l.Link]; ok {
+			le.Links[i].Link = n
+		}
+	}
+	var j []byte
+	j, err = json.Marshal(le)
+	if err == nil {
+		migrated = string(j)
+	}
+	return
+}
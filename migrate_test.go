@@ -0,0 +1,148 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	commit(h, "oddNumbers", "7")
+	commit(h, "profile", `{"firstName":"Eric","lastName":"H-B"}`)
+
+	h2 := setupTestChain("test2", 0, s)
+	h2.Config.Port = h.Config.Port + 1
+
+	Convey("it should refuse to migrate from a holochain the DNA isn't based on", t, func() {
+		prepareTestChain(h2)
+		_, err := h2.Migrate(h)
+		So(err, ShouldEqual, ErrNotBasedOn)
+	})
+	h2.Close()
+
+	h3 := setupTestChain("test3", 0, s)
+	h3.Config.Port = h.Config.Port + 2
+	defer h3.Close()
+	h3.nucleus.dna.BasedOn = h.DNAHash()
+	z := &h3.nucleus.dna.Zomes[1]
+	z.Entries[0].SchemaVersion = 2
+	z.Code += `
+function migrate(x) {
+  if (x.EntryType=="oddNumbers") {return String(parseInt(x.Entry)+2)}
+  return x.Entry
+}`
+	prepareTestChain(h3)
+
+	Convey("it should migrate entries through the zome's migrate function", t, func() {
+		count, err := h3.Migrate(h)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+
+		_, header := h3.chain.TopType("oddNumbers")
+		e, _, err := h3.chain.GetEntry(header.EntryLink)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldEqual, "9")
+
+		_, header = h3.chain.TopType("profile")
+		e, _, err = h3.chain.GetEntry(header.EntryLink)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldEqual, `{"firstName":"Eric","lastName":"H-B"}`)
+	})
+}
+
+func TestMigrateLinks(t *testing.T) {
+	Convey("it should re-point migrated hashes in links", t, func() {
+		hashes := map[string]string{"QmOld": "QmNew"}
+		content, err := migrateLinks(`{"Links":[{"Base":"QmOld","Link":"QmOther","Tag":"t"}]}`, hashes)
+		So(err, ShouldBeNil)
+		So(content, ShouldEqual, `{"Links":[{"LinkAction":"","Base":"QmNew","Link":"QmOther","Tag":"t"}]}`)
+	})
+}
+
+func TestMigrateBinaryEntries(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	addBinaryEntries := func(h *Holochain) {
+		zome := &h.nucleus.dna.Zomes[1]
+		zome.Entries = append(zome.Entries,
+			EntryDef{Name: "blob", DataFormat: DataFormatBytes, Sharing: Public},
+			EntryDef{Name: "record", DataFormat: DataFormatCBOR, Sharing: Public},
+		)
+		zome.Code += "\nfunction validate(entry_type,entry,header,sources) {return true}"
+	}
+	addBinaryEntries(h)
+
+	if _, err := NewCommitAction("blob", &GobEntry{C: []byte("hello")}).Do(h); err != nil {
+		panic(err)
+	}
+	record, err := JSONToCBOR(`{"name":"Eric"}`)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := NewCommitAction("record", &GobEntry{C: record}).Do(h); err != nil {
+		panic(err)
+	}
+
+	h2 := setupTestChain("test2", 0, s)
+	h2.Config.Port = h.Config.Port + 1
+	defer h2.Close()
+	h2.nucleus.dna.BasedOn = h.DNAHash()
+	addBinaryEntries(h2)
+	prepareTestChain(h2)
+
+	Convey("it should migrate bytes and cbor entries", t, func() {
+		_, err := h2.Migrate(h)
+		So(err, ShouldBeNil)
+
+		_, header := h2.chain.TopType("blob")
+		e, _, err := h2.chain.GetEntry(header.EntryLink)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldResemble, []byte("hello"))
+
+		_, header = h2.chain.TopType("record")
+		e, _, err = h2.chain.GetEntry(header.EntryLink)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldResemble, record)
+	})
+}
+
+func TestMigrateChunkedEntries(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	addFileEntry := func(h *Holochain, chunkSize int) {
+		zome := &h.nucleus.dna.Zomes[1]
+		zome.Entries = append(zome.Entries, EntryDef{Name: "file", DataFormat: DataFormatBytes, Sharing: Public, ChunkSize: chunkSize})
+		zome.Code += "\nfunction validate(entry_type,entry,header,sources) {return true}"
+	}
+	addFileEntry(h, 4)
+	content := []byte("hello world")
+	if _, err := NewCommitAction("file", &GobEntry{C: content}).Do(h); err != nil {
+		panic(err)
+	}
+
+	h2 := setupTestChain("test2", 0, s)
+	h2.Config.Port = h.Config.Port + 1
+	defer h2.Close()
+	h2.nucleus.dna.BasedOn = h.DNAHash()
+	addFileEntry(h2, 5)
+	prepareTestChain(h2)
+
+	Convey("it should migrate chunked entries as a whole and chunk them again", t, func() {
+		count, err := h2.Migrate(h)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+
+		_, header := h2.chain.TopType(ManifestEntryType)
+		So(header, ShouldNotBeNil)
+		e, _, err := h2.chain.GetEntry(header.EntryLink)
+		So(err, ShouldBeNil)
+		m := e.Content().(ChunkManifest)
+		So(m.EntryType, ShouldEqual, "file")
+		So(len(m.Chunks), ShouldEqual, 3)
+		b, err := h2.getChunked(&m, true)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, content)
+	})
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements long-lived streams to peers over which concurrent requests and their
+// responses are multiplexed by request ID, so that busy protocols like gossip and gets
+// don't pay for setting up a stream per message
+
+package holochain
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"io"
+	"sync"
+)
+
+const requestIDSize = 8 // size of the request ID that precedes each message frame on a multiplexed stream
+
+var ErrStreamClosed = errors.New("stream closed")
+
+type streamKey struct {
+	peer  peer.ID
+	proto int
+}
+
+type muxResult struct {
+	m   Message
+	err error
+}
+
+// muxStream is a long-lived stream to a peer for one protocol
+type muxStream struct {
+	node     *Node
+	key      streamKey
+	s        net.Stream
+	encoding string
+	slots    chan bool // limits the requests in flight to MaxPeerRequests
+
+	wlk sync.Mutex // serializes writes of request frames
+
+	plk     sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan muxResult
+	err     error // set once the stream has failed
+}
+
+// muxStreamTo returns the open multiplexed stream to a peer for a protocol, if there is one
+func (node *Node) muxStreamTo(proto int, addr peer.ID) (ms *muxStream) {
+	node.slk.Lock()
+	ms = node.streams[streamKey{peer: addr, proto: proto}]
+	node.slk.Unlock()
+	return
+}
+
+// addMuxStream starts multiplexing requests over a newly opened stream. If another send
+// raced to open one first, that stream is used instead and the new one closed.
+func (node *Node) addMuxStream(proto int, addr peer.ID, s net.Stream) (ms *muxStream) {
+	key := streamKey{peer: addr, proto: proto}
+	node.slk.Lock()
+	defer node.slk.Unlock()
+	if existing := node.streams[key]; existing != nil {
+		s.Close()
+		ms = existing
+		return
+	}
+	ms = &muxStream{
+		node:     node,
+		key:      key,
+		s:        s,
+		encoding: node.protocols[proto].encodingOf(s.Protocol()),
+		slots:    make(chan bool, node.MaxPeerRequests),
+		pending:  make(map[uint64]chan muxResult),
+	}
+	node.streams[key] = ms
+	go ms.readResponses()
+	return
+}
+
+// removeMuxStream forgets a failed stream so that the next send opens a new one
+func (node *Node) removeMuxStream(ms *muxStream) {
+	node.slk.Lock()
+	if node.streams[ms.key] == ms {
+		delete(node.streams, ms.key)
+	}
+	node.slk.Unlock()
+}
+
+func writeRequestID(frame []byte, id uint64) []byte {
+	b := make([]byte, requestIDSize, requestIDSize+len(frame))
+	binary.BigEndian.PutUint64(b, id)
+	return append(b, frame...)
+}
+
+func readRequestID(r io.Reader) (id uint64, err error) {
+	var b [requestIDSize]byte
+	if _, err = io.ReadFull(r, b[:]); err != nil {
+		return
+	}
+	id = binary.BigEndian.Uint64(b[:])
+	return
+}
+
+// request sends a message over the stream and waits for its response
+func (ms *muxStream) request(ctx context.Context, m *Message) (response Message, err error) {
+	select {
+	case ms.slots <- true:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+	defer func() { <-ms.slots }()
+
+	frame, err := ms.node.frameMessage(ms.encoding, m)
+	if err != nil {
+		return
+	}
+
+	ms.plk.Lock()
+	if ms.err != nil {
+		err = ms.err
+		ms.plk.Unlock()
+		return
+	}
+	ms.nextID++
+	id := ms.nextID
+	result := make(chan muxResult, 1)
+	ms.pending[id] = result
+	ms.plk.Unlock()
+
+	ms.wlk.Lock()
+	_, err = ms.s.Write(writeRequestID(frame, id))
+	ms.wlk.Unlock()
+	if err != nil {
+		ms.fail(err)
+		return
+	}
+
+	select {
+	case r := <-result:
+		response, err = r.m, r.err
+	case <-ctx.Done():
+		ms.plk.Lock()
+		delete(ms.pending, id)
+		ms.plk.Unlock()
+		err = ctx.Err()
+	}
+	return
+}
+
+// readResponses hands each response read from the stream to the request waiting for it
+func (ms *muxStream) readResponses() {
+	for {
+		id, err := readRequestID(ms.s)
+		var m Message
+		if err == nil {
+			err = ms.node.readMessage(ms.s, ms.encoding, &m)
+		}
+		if err != nil {
+			ms.fail(err)
+			return
+		}
+		ms.plk.Lock()
+		result := ms.pending[id]
+		delete(ms.pending, id)
+		ms.plk.Unlock()
+		if result != nil {
+			result <- muxResult{m: m}
+		}
+	}
+}
+
+// fail closes the stream and fails all the requests waiting on it
+func (ms *muxStream) fail(err error) {
+	if err == io.EOF {
+		err = ErrStreamClosed
+	}
+	ms.node.removeMuxStream(ms)
+	ms.plk.Lock()
+	if ms.err == nil {
+		ms.err = err
+		ms.s.Close()
+	}
+	for id, result := range ms.pending {
+		result <- muxResult{err: ms.err}
+		delete(ms.pending, id)
+	}
+	ms.plk.Unlock()
+}
+
+// serveMuxStream answers the requests a peer multiplexes over a stream, handling at most
+// MaxPeerRequests of them at once
+func (node *Node) serveMuxStream(h *Holochain, p *Protocol, s net.Stream, encoding string) {
+	var wlk sync.Mutex
+	var wg sync.WaitGroup
+	respond := func(id uint64, err error, body interface{}) {
+		frame, err := node.frameMessage(encoding, node.responseMessage(err, body))
+		if err != nil {
+			// the response itself can't be sent, so tell the requester why
+			frame, err = node.frameMessage(encoding, node.responseMessage(err, nil))
+		}
+		if err == nil {
+			wlk.Lock()
+			_, err = s.Write(writeRequestID(frame, id))
+			wlk.Unlock()
+		}
+		if err != nil {
+			Infof("Response failed: %v", err)
+		}
+	}
+
+	slots := make(chan bool, node.MaxPeerRequests)
+	for {
+		id, err := readRequestID(s)
+		if err != nil {
+			break
+		}
+		var m Message
+		err = node.readMessage(s, encoding, &m)
+		if err == ErrMessageTooLarge {
+			// the rest of the message is never read so just respond and drop the stream
+			respond(id, err, nil)
+			break
+		}
+		if err != nil {
+			break
+		}
+		slots <- true
+		wg.Add(1)
+		go func(id uint64, m Message) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			response, err := node.receive(h, p, s, &m)
+			respond(id, err, response)
+		}(id, m)
+	}
+	wg.Wait()
+	s.Close()
+}
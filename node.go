@@ -7,8 +7,10 @@
 package holochain
 
 import (
+	"bytes"
 	"context"
 	//	host "github.com/libp2p/go-libp2p-host"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -29,10 +31,12 @@ import (
 	. "github.com/metacurrency/holochain/hash"
 	ma "github.com/multiformats/go-multiaddr"
 	mh "github.com/multiformats/go-multihash"
+	msmux "github.com/multiformats/go-multistream"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 
 	"math/big"
+	"path"
 	"sync"
 
 	go_net "net"
@@ -107,6 +111,17 @@ func (msgType MsgType) String() string {
 }
 
 var ErrBlockedListed = errors.New("node blockedlisted")
+var ErrMessageTooLarge = errors.New("message too large")
+
+// IncompatibleProtocolErr is returned when two nodes have no version of a protocol in common
+type IncompatibleProtocolErr struct {
+	Protocol string
+	Versions []string
+}
+
+func (e IncompatibleProtocolErr) Error() string {
+	return fmt.Sprintf("incompatible protocol version for %s, supported versions: %s", e.Protocol, strings.Join(e.Versions, ", "))
+}
 
 // Message represents data that can be sent to node in the network
 type Message struct {
@@ -119,15 +134,34 @@ type Message struct {
 // Node represents a node in the network
 type Node struct {
 	HashAddr     peer.ID
-	NetAddr      ma.Multiaddr
+	NetAddr      ma.Multiaddr   // the primary TCP address the node listens on
+	ListenAddrs  []ma.Multiaddr // all the addresses the node listens on, starting with NetAddr
 	host         *rhost.RoutedHost
 	mdnsSvc      discovery.Service
+	blk          sync.RWMutex
 	blockedlist  map[peer.ID]bool
 	protocols    [_protocolCount]*Protocol
 	peerstore    pstore.Peerstore
+	metrics      pstore.Metrics
 	routingTable *RoutingTable
 	nat          *nat.NAT
 
+	// MaxMessageSize is the largest message, in bytes, the node will send or accept
+	MaxMessageSize int
+
+	// MaxPeerRequests is how many requests to a peer, and from a peer, over a protocol
+	// may be in flight at once
+	MaxPeerRequests int
+	slk             sync.Mutex
+	streams         map[streamKey]*muxStream
+
+	llk     sync.Mutex
+	limiter *rateLimiter
+	inbound chan bool // limits the incoming requests handled at once
+
+	rlk    sync.Mutex
+	relays []relayServer
+
 	// items for the kademlia implementation
 	plk   sync.Mutex
 	peers map[peer.ID]*peerTracker
@@ -137,8 +171,55 @@ type Node struct {
 
 // Protocol encapsulates data for our different protocols
 type Protocol struct {
-	ID       protocol.ID
+	ID       protocol.ID // the protocol at the current ProtocolVersion in the preferred encoding
 	Receiver ReceiverFn
+	base     string // the protocol identifier without its version
+}
+
+// newProtocol creates a protocol named for its purpose and the holochain's protoMux
+func newProtocol(name string, protoMux string, receiver ReceiverFn) *Protocol {
+	p := &Protocol{Receiver: receiver, base: "/hc-" + name + "-" + protoMux}
+	p.ID = p.EncodingID(ProtocolVersion, WireEncodings[0])
+	return p
+}
+
+// VersionID returns the protocol's identifier at a given version
+func (p *Protocol) VersionID(version string) protocol.ID {
+	return protocol.ID(p.base + "/" + version)
+}
+
+// EncodingID returns the protocol's identifier at a given version and message encoding
+func (p *Protocol) EncodingID(version string, encoding string) protocol.ID {
+	return protocol.ID(p.base + "/" + version + "/" + encoding)
+}
+
+// IDs returns the protocol's identifiers for all the versions and encodings this node
+// speaks, preferred first
+func (p *Protocol) IDs() (ids []protocol.ID) {
+	for _, v := range ProtocolVersions {
+		for _, e := range WireEncodings {
+			ids = append(ids, p.EncodingID(v, e))
+		}
+	}
+	return
+}
+
+// encodingOf returns the message encoding of one of the protocol's identifiers
+func (p *Protocol) encodingOf(id protocol.ID) string {
+	return path.Base(string(id))
+}
+
+// versionOf returns the version of one of the protocol's identifiers
+func (p *Protocol) versionOf(id protocol.ID) string {
+	return path.Base(path.Dir(string(id)))
+}
+
+// negotiationErr converts a failure to agree on a protocol version into an IncompatibleProtocolErr
+func (p *Protocol) negotiationErr(err error) error {
+	if err == msmux.ErrNotSupported {
+		return IncompatibleProtocolErr{Protocol: p.base, Versions: ProtocolVersions}
+	}
+	return err
 }
 
 const (
@@ -151,8 +232,18 @@ const (
 
 const (
 	PeerTTL = time.Minute * 10
+
+	ProtocolVersion              = "0.2.0"         // the wire protocol version spoken by this node, which multiplexes requests
+	SingleRequestProtocolVersion = "0.1.0"         // the wire protocol version with one request per stream
+	LegacyProtocolVersion        = "0.0.0"         // the unframed wire protocol of older nodes
+	DefaultMaxMessageSize        = 4 * 1024 * 1024 // default largest message in bytes
+	DefaultMaxPeerRequests       = 16              // default number of requests in flight with a peer
+	messageLengthSize            = 4               // size of the length prefix of a message frame
 )
 
+// ProtocolVersions lists the wire protocol versions this node can speak, preferred first
+var ProtocolVersions = []string{ProtocolVersion, SingleRequestProtocolVersion}
+
 // implement peer found function for mdns discovery
 func (h *Holochain) HandlePeerFound(pi pstore.PeerInfo) {
 	h.dht.dlog.Logf("discovered peer via mdns: %v", pi)
@@ -185,19 +276,36 @@ func (n *Node) EnableMDNSDiscovery(h *Holochain, interval time.Duration) (err er
 	return
 }
 
-func (n *Node) ExternalAddr() ma.Multiaddr {
+// ExternalAddr returns the addresses other nodes should use to reach this one, one for each
+// transport it listens on.  In place of its primary address it reports its NAT port mapping
+// if it has one, otherwise a relayed address if it isn't publicly reachable and is connected
+// to a relay.
+func (n *Node) ExternalAddr() (addrs []ma.Multiaddr) {
+	addr := n.mappedAddr()
+	if addr == nil && n.Reachability() == ReachabilityPrivate {
+		addr = n.relayedAddr()
+	}
+	if addr == nil {
+		addr = n.NetAddr
+	}
+	addrs = append(addrs, addr)
+	addrs = append(addrs, n.ListenAddrs[1:]...)
+	return
+}
+
+// mappedAddr returns the external address of the node's NAT port mapping, if it has one
+func (n *Node) mappedAddr() ma.Multiaddr {
 	if n.nat == nil {
-		return n.NetAddr
-	} else {
-		mappings := n.nat.Mappings()
-		for i := 0; i < len(mappings); i++ {
-			external_addr, err := mappings[i].ExternalAddr()
-			if err == nil {
-				return external_addr
-			}
+		return nil
+	}
+	mappings := n.nat.Mappings()
+	for i := 0; i < len(mappings); i++ {
+		external_addr, err := mappings[i].ExternalAddr()
+		if err == nil {
+			return external_addr
 		}
-		return n.NetAddr
 	}
+	return nil
 }
 
 func (n *Node) discoverAndHandleNat(listenPort int) {
@@ -232,9 +340,9 @@ func (n *Node) discoverAndHandleNat(listenPort int) {
 			}
 		}
 
-		external_addr := n.ExternalAddr()
+		external_addr := n.mappedAddr()
 
-		if external_addr != n.NetAddr {
+		if external_addr != nil {
 			Debugf("NAT: successfully created port mapping! External address is: %s", external_addr.String())
 		} else {
 			Debugf("NAT: could not create port mappping. Keep trying...")
@@ -242,7 +350,7 @@ func (n *Node) discoverAndHandleNat(listenPort int) {
 			Infof("NAT:---------------------Warning---------------------------")
 			Infof("NAT:-------------------------------------------------------")
 			Infof("NAT: You seem to be behind a NAT that does not speak UPnP.")
-			Infof("NAT: You will have to setup a port forwarding manually.")
+			Infof("NAT: You will have to setup a port forwarding manually, or configure RelayServers.")
 			Infof("NAT: This instance is configured to listen on port: %d", listenPort)
 			Infof("NAT:-------------------------------------------------------")
 		}
@@ -250,8 +358,9 @@ func (n *Node) discoverAndHandleNat(listenPort int) {
 	}
 }
 
-// NewNode creates a new node with given multiAddress listener string and identity
-func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUPnP bool) (node *Node, err error) {
+// NewNode creates a new node with given multiAddress listener strings and identity.  The
+// first listener is the node's primary TCP address, and the rest may be WebSocket.
+func NewNode(listenAddrs []string, protoMux string, agent *LibP2PAgent, enableNATUPnP bool) (node *Node, err error) {
 	Debugf("Creating new node with protoMux: %s\n", protoMux)
 	nodeID, _, err := agent.NodeID()
 	if err != nil {
@@ -259,14 +368,14 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 	}
 
 	var n Node
-	listenPort, err := strconv.Atoi(strings.Split(listenAddr, "/")[4])
+	n.ListenAddrs, err = parseListenAddrs(listenAddrs)
 	if err != nil {
-		Infof("Can't parse port from Multiaddress string: %s", listenAddr)
 		return
 	}
-
-	n.NetAddr, err = ma.NewMultiaddr(listenAddr)
+	n.NetAddr = n.ListenAddrs[0]
+	listenPort, err := strconv.Atoi(strings.Split(listenAddrs[0], "/")[4])
 	if err != nil {
+		Infof("Can't parse port from Multiaddress string: %s", listenAddrs[0])
 		return
 	}
 
@@ -276,33 +385,35 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 
 	ps := pstore.NewPeerstore()
 	n.peerstore = ps
-	ps.AddAddrs(nodeID, []ma.Multiaddr{n.NetAddr}, pstore.PermanentAddrTTL)
+	ps.AddAddrs(nodeID, n.ListenAddrs, pstore.PermanentAddrTTL)
 
 	n.HashAddr = nodeID
 	priv := agent.PrivKey()
 	ps.AddPrivKey(nodeID, priv)
 	ps.AddPubKey(nodeID, priv.GetPublic())
 
-	validateProtocolString := "/hc-validate-" + protoMux + "/0.0.0"
-	gossipProtocolString := "/hc-gossip-" + protoMux + "/0.0.0"
-	actionProtocolString := "/hc-action-" + protoMux + "/0.0.0"
-	kademliaProtocolString := "/hc-kademlia-" + protoMux + "/0.0.0"
+	n.protocols[ValidateProtocol] = newProtocol("validate", protoMux, ValidateReceiver)
+	n.protocols[GossipProtocol] = newProtocol("gossip", protoMux, GossipReceiver)
+	n.protocols[ActionProtocol] = newProtocol("action", protoMux, ActionReceiver)
+	n.protocols[KademliaProtocol] = newProtocol("kademlia", protoMux, KademliaReceiver)
 
-	Debugf("Validate protocol identifier: " + validateProtocolString)
-	Debugf("Gossip protocol identifier: " + gossipProtocolString)
-	Debugf("Action protocol identifier: " + actionProtocolString)
-	Debugf("Kademlia protocol identifier: " + kademliaProtocolString)
+	Debugf("Validate protocol identifiers: %v", n.protocols[ValidateProtocol].IDs())
+	Debugf("Gossip protocol identifiers: %v", n.protocols[GossipProtocol].IDs())
+	Debugf("Action protocol identifiers: %v", n.protocols[ActionProtocol].IDs())
+	Debugf("Kademlia protocol identifiers: %v", n.protocols[KademliaProtocol].IDs())
 
-	n.protocols[ValidateProtocol] = &Protocol{protocol.ID(validateProtocolString), ValidateReceiver}
-	n.protocols[GossipProtocol] = &Protocol{protocol.ID(gossipProtocolString), GossipReceiver}
-	n.protocols[ActionProtocol] = &Protocol{protocol.ID(actionProtocolString), ActionReceiver}
-	n.protocols[KademliaProtocol] = &Protocol{protocol.ID(kademliaProtocolString), KademliaReceiver}
+	n.MaxMessageSize = DefaultMaxMessageSize
+	n.MaxPeerRequests = DefaultMaxPeerRequests
+	n.streams = make(map[streamKey]*muxStream)
+	if err = n.SetRateLimits(DefaultRateLimits()); err != nil {
+		return
+	}
 
 	ctx := context.Background()
 	n.ctx = ctx
 
 	// create a new swarm to be used by the service host
-	netw, err := swarm.NewNetwork(ctx, []ma.Multiaddr{n.NetAddr}, nodeID, ps, nil)
+	netw, err := swarm.NewNetwork(ctx, n.ListenAddrs, nodeID, ps, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -316,6 +427,7 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 	n.host = rhost.Wrap(bh, &n)
 
 	m := pstore.NewMetrics()
+	n.metrics = m
 	n.routingTable = NewRoutingTable(KValue, nodeID, time.Minute, m)
 	n.peers = make(map[peer.ID]*peerTracker)
 
@@ -333,7 +445,6 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 }
 
 // Encode codes a message to gob format
-// @TODO generalize for other message encoding formats
 func (m *Message) Encode() (data []byte, err error) {
 	data, err = ByteEncoder(m)
 	if err != nil {
@@ -343,13 +454,90 @@ func (m *Message) Encode() (data []byte, err error) {
 }
 
 // Decode converts a message from gob format
-// @TODO generalize for other message encoding formats
 func (m *Message) Decode(r io.Reader) (err error) {
 	dec := gob.NewDecoder(r)
 	err = dec.Decode(m)
 	return
 }
 
+// EncodeAs codes a message in one of the WireEncodings
+func (m *Message) EncodeAs(encoding string) (data []byte, err error) {
+	switch encoding {
+	case GobEncoding:
+		data, err = m.Encode()
+	case CBOREncoding:
+		data, err = EncodeCBOR(m)
+	default:
+		err = fmt.Errorf("unknown message encoding: %s", encoding)
+	}
+	return
+}
+
+// DecodeAs converts a message from one of the WireEncodings
+func (m *Message) DecodeAs(encoding string, data []byte) (err error) {
+	switch encoding {
+	case GobEncoding:
+		err = m.Decode(bytes.NewReader(data))
+	case CBOREncoding:
+		err = DecodeCBOR(data, m)
+	default:
+		err = fmt.Errorf("unknown message encoding: %s", encoding)
+	}
+	return
+}
+
+// frameMessage encodes a message as a frame of its length followed by its encoding
+func (node *Node) frameMessage(encoding string, m *Message) (frame []byte, err error) {
+	data, err := m.EncodeAs(encoding)
+	if err != nil {
+		return
+	}
+	if len(data) > node.MaxMessageSize {
+		err = ErrMessageTooLarge
+		return
+	}
+	frame = make([]byte, messageLengthSize+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[messageLengthSize:], data)
+	return
+}
+
+// writeMessage writes a message as a frame of its length followed by its encoding
+func (node *Node) writeMessage(w io.Writer, encoding string, m *Message) (err error) {
+	frame, err := node.frameMessage(encoding, m)
+	if err != nil {
+		return
+	}
+	n, err := w.Write(frame)
+	if err != nil {
+		return
+	}
+	if n != len(frame) {
+		err = errors.New("unable to send all data")
+	}
+	return
+}
+
+// readMessage reads a message frame written by writeMessage, refusing messages larger than
+// the node's MaxMessageSize
+func (node *Node) readMessage(r io.Reader, encoding string, m *Message) (err error) {
+	var prefix [messageLengthSize]byte
+	if _, err = io.ReadFull(r, prefix[:]); err != nil {
+		return
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if uint64(size) > uint64(node.MaxMessageSize) {
+		err = ErrMessageTooLarge
+		return
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return
+	}
+	err = m.DecodeAs(encoding, data)
+	return
+}
+
 // Fingerprint creates a hash of a message
 func (m *Message) Fingerprint() (f Hash, err error) {
 	var data []byte
@@ -372,9 +560,8 @@ func (m Message) String() string {
 	return fmt.Sprintf("%v @ %v From:%v Body:%v", m.Type, m.Time, m.From, m.Body)
 }
 
-// respondWith writes a message either error or otherwise, to the stream
-func (node *Node) respondWith(s net.Stream, err error, body interface{}) {
-	var m *Message
+// responseMessage creates the response to a request, either error or otherwise
+func (node *Node) responseMessage(err error, body interface{}) (m *Message) {
 	if err != nil {
 		errResp := NewErrorResponse(err)
 		errResp.Payload = body
@@ -382,36 +569,81 @@ func (node *Node) respondWith(s net.Stream, err error, body interface{}) {
 	} else {
 		m = node.NewMessage(OK_RESPONSE, body)
 	}
+	return
+}
 
-	data, err := m.Encode()
+// respondWith writes a message either error or otherwise, to the stream
+func (node *Node) respondWith(s net.Stream, encoding string, err error, body interface{}) {
+	err = node.writeMessage(s, encoding, node.responseMessage(err, body))
 	if err != nil {
-		Infof("Response failed: unable to encode message: %v", m)
+		Infof("Response failed: %v", err)
 	}
-	_, err = s.Write(data)
-	if err != nil {
-		Infof("Response failed: write returned error: %v", err)
+}
+
+// receive checks a message that arrived on a stream and passes it to the protocol's receiver
+func (node *Node) receive(h *Holochain, p *Protocol, s net.Stream, m *Message) (response interface{}, err error) {
+	if m.From == "" {
+		// @todo other sanity checks on From?
+		err = errors.New("message must have a source")
+		return
+	}
+	from := s.Conn().RemotePeer()
+	if node.IsBlocked(from) {
+		err = ErrBlockedListed
+		return
+	}
+	if err = node.limitRequest(from, m.Type); err != nil {
+		return
 	}
+	_, inbound := node.rateLimiting()
+	inbound <- true
+	response, err = p.Receiver(h, m)
+	<-inbound
+	return
 }
 
 // StartProtocol initiates listening for a protocol on the node
 func (node *Node) StartProtocol(h *Holochain, proto int) (err error) {
-	node.host.SetStreamHandler(node.protocols[proto].ID, func(s net.Stream) {
+	p := node.protocols[proto]
+	handler := func(s net.Stream, encoding string) {
 		var m Message
-		err := m.Decode(s)
+		err := node.readMessage(s, encoding, &m)
 		var response interface{}
-		if m.From == "" {
-			// @todo other sanity checks on From?
-			err = errors.New("message must have a source")
+		if err == ErrMessageTooLarge {
+			// the rest of the message is never read so just respond and drop the stream
+			node.respondWith(s, encoding, err, nil)
+			s.Close()
+			return
+		}
+		response, err = node.receive(h, p, s, &m)
+		node.respondWith(s, encoding, err, response)
+	}
+	for _, id := range p.IDs() {
+		encoding := p.encodingOf(id)
+		if p.versionOf(id) == SingleRequestProtocolVersion {
+			node.host.SetStreamHandler(id, func(s net.Stream) {
+				handler(s, encoding)
+			})
 		} else {
-			if node.IsBlocked(s.Conn().RemotePeer()) {
-				err = ErrBlockedListed
-			}
+			node.host.SetStreamHandler(id, func(s net.Stream) {
+				node.serveMuxStream(h, p, s, encoding)
+			})
+		}
+	}
 
-			if err == nil {
-				response, err = node.protocols[proto].Receiver(h, &m)
-			}
+	// older nodes send unframed messages and can't negotiate, so answer them in
+	// their own format with an explicit error rather than letting them fail to decode
+	legacyID := p.VersionID(LegacyProtocolVersion)
+	node.host.SetStreamHandler(legacyID, func(s net.Stream) {
+		defer s.Close()
+		incompatible := IncompatibleProtocolErr{Protocol: string(legacyID), Versions: ProtocolVersions}
+		data, err := node.NewMessage(ERROR_RESPONSE, ErrorResponse{Message: incompatible.Error()}).Encode()
+		if err == nil {
+			_, err = s.Write(data)
+		}
+		if err != nil {
+			Infof("Response to legacy node failed: %v", err)
 		}
-		node.respondWith(s, err, response)
 	})
 	return
 }
@@ -429,29 +661,49 @@ func (node *Node) Send(ctx context.Context, proto int, addr peer.ID, m *Message)
 		return
 	}
 
-	s, err := node.host.NewStream(ctx, addr, node.protocols[proto].ID)
-	if err != nil {
-		return
+	p := node.protocols[proto]
+	// a peer only closes a stream once it has answered everything it read from it, so a
+	// request that fails with ErrStreamClosed was never received and can go on a new stream
+	for attempt := 0; attempt < 2; attempt++ {
+		ms := node.muxStreamTo(proto, addr)
+		if ms == nil {
+			var s net.Stream
+			s, err = node.host.NewStream(ctx, addr, p.IDs()...)
+			if err != nil {
+				err = p.negotiationErr(err)
+				return
+			}
+			if p.versionOf(s.Protocol()) == SingleRequestProtocolVersion {
+				response, err = node.sendOnce(p, s, m)
+				return
+			}
+			ms = node.addMuxStream(proto, addr, s)
+		}
+		response, err = ms.request(ctx, m)
+		if err != ErrStreamClosed {
+			return
+		}
 	}
+	return
+}
+
+// sendOnce sends a message and reads the response over a stream that carries just that
+// request, as spoken by nodes that don't multiplex
+func (node *Node) sendOnce(p *Protocol, s net.Stream, m *Message) (response Message, err error) {
 	defer s.Close()
+	encoding := p.encodingOf(s.Protocol())
 
 	// encode the message and send it
-	data, err := m.Encode()
+	err = node.writeMessage(s, encoding, m)
 	if err != nil {
+		err = p.negotiationErr(err)
 		return
 	}
 
-	n, err := s.Write(data)
-	if err != nil {
-		return
-	}
-	if n != len(data) {
-		err = errors.New("unable to send all data")
-	}
-
 	// decode the response
-	err = response.Decode(s)
+	err = node.readMessage(s, encoding, &response)
 	if err != nil {
+		err = p.negotiationErr(err)
 		Debugf("failed to decode: %v err:%v ", err)
 		return
 	}
@@ -467,13 +719,17 @@ func (node *Node) NewMessage(t MsgType, body interface{}) (msg *Message) {
 
 // IsBlockedListed checks to see if a node is on the blockedlist
 func (node *Node) IsBlocked(addr peer.ID) (ok bool) {
+	node.blk.RLock()
 	ok = node.blockedlist[addr]
+	node.blk.RUnlock()
 	return
 }
 
 // InitBlockedList sets up the blockedlist from a PeerList
 func (node *Node) InitBlockedList(list PeerList) {
+	node.blk.Lock()
 	node.blockedlist = make(map[peer.ID]bool)
+	node.blk.Unlock()
 	for _, r := range list.Records {
 		node.Block(r.ID)
 	}
@@ -481,17 +737,21 @@ func (node *Node) InitBlockedList(list PeerList) {
 
 // Block adds a peer to the blocklist
 func (node *Node) Block(addr peer.ID) {
+	node.blk.Lock()
 	if node.blockedlist == nil {
 		node.blockedlist = make(map[peer.ID]bool)
 	}
 	node.blockedlist[addr] = true
+	node.blk.Unlock()
 }
 
 // Unblock removes a peer from the blocklist
 func (node *Node) Unblock(addr peer.ID) {
+	node.blk.Lock()
 	if node.blockedlist != nil {
 		delete(node.blockedlist, addr)
 	}
+	node.blk.Unlock()
 }
 
 type ErrorResponse struct {
@@ -509,6 +769,8 @@ const (
 	ErrLinkNotFoundCode
 	ErrEntryTypeMismatchCode
 	ErrBlockedListedCode
+	ErrMessageTooLargeCode
+	ErrRateLimitedCode
 )
 
 // NewErrorResponse encodes standard errors for transmitting
@@ -528,6 +790,10 @@ func NewErrorResponse(err error) (errResp ErrorResponse) {
 		errResp.Code = ErrEntryTypeMismatchCode
 	case ErrBlockedListed:
 		errResp.Code = ErrBlockedListedCode
+	case ErrMessageTooLarge:
+		errResp.Code = ErrMessageTooLargeCode
+	case ErrRateLimited:
+		errResp.Code = ErrRateLimitedCode
 	default:
 		errResp.Message = err.Error() //Code will be set to ErrUnknown by default cus it's 0
 	}
@@ -551,6 +817,10 @@ func (errResp ErrorResponse) DecodeResponseError() (err error) {
 		err = ErrEntryTypeMismatch
 	case ErrBlockedListedCode:
 		err = ErrBlockedListed
+	case ErrMessageTooLargeCode:
+		err = ErrMessageTooLarge
+	case ErrRateLimitedCode:
+		err = ErrRateLimited
 	default:
 		err = errors.New(errResp.Message)
 	}
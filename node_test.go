@@ -14,6 +14,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -199,6 +201,104 @@ func TestNodeSend(t *testing.T) {
 		So(fmt.Sprintf("%T", r.Body), ShouldEqual, "holochain.Gossip")
 	})
 
+	Convey("It should multiplex concurrent requests to a peer over one stream", t, func() {
+		node1.SetRateLimits(RateLimits{PerPeer: map[string]RateLimit{}})
+		defer node1.SetRateLimits(DefaultRateLimits())
+		ms := node2.muxStreamTo(GossipProtocol, node1.HashAddr)
+		So(ms, ShouldNotBeNil)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r, err := node2.Send(context.Background(), GossipProtocol, node1.HashAddr, node2.NewMessage(GOSSIP_REQUEST, GossipReq{}))
+				if err == nil && r.Type != OK_RESPONSE {
+					err = fmt.Errorf("unexpected response: %v", r)
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			So(err, ShouldBeNil)
+		}
+		So(node2.muxStreamTo(GossipProtocol, node1.HashAddr), ShouldEqual, ms)
+		So(len(ms.pending), ShouldEqual, 0)
+	})
+
+	Convey("It should fall back to a stream per request with nodes that don't multiplex", t, func() {
+		versions := ProtocolVersions
+		ProtocolVersions = []string{SingleRequestProtocolVersion}
+		defer func() { ProtocolVersions = versions }()
+		r, err := node2.Send(context.Background(), ValidateProtocol, node1.HashAddr, node2.NewMessage(GOSSIP_REQUEST, "fish"))
+		So(err, ShouldBeNil)
+		So(r.Type, ShouldEqual, ERROR_RESPONSE)
+		So(node2.muxStreamTo(ValidateProtocol, node1.HashAddr), ShouldBeNil)
+	})
+
+	Convey("It should respond to nodes that negotiate the gob encoding", t, func() {
+		gobID := node1.protocols[GossipProtocol].EncodingID(SingleRequestProtocolVersion, GobEncoding)
+		s, err := node2.host.NewStream(context.Background(), node1.HashAddr, gobID)
+		So(err, ShouldBeNil)
+		defer s.Close()
+		err = node2.writeMessage(s, GobEncoding, node2.NewMessage(GOSSIP_REQUEST, GossipReq{}))
+		So(err, ShouldBeNil)
+
+		var r Message
+		err = node2.readMessage(s, GobEncoding, &r)
+		So(err, ShouldBeNil)
+		So(r.Type, ShouldEqual, OK_RESPONSE)
+		So(fmt.Sprintf("%T", r.Body), ShouldEqual, "holochain.Gossip")
+	})
+
+	Convey("It should tell legacy nodes they are incompatible", t, func() {
+		legacyID := node1.protocols[ActionProtocol].VersionID(LegacyProtocolVersion)
+		s, err := node2.host.NewStream(context.Background(), node1.HashAddr, legacyID)
+		So(err, ShouldBeNil)
+		defer s.Close()
+		data, _ := node2.NewMessage(GOSSIP_REQUEST, GossipReq{}).Encode()
+		_, err = s.Write(data)
+		So(err, ShouldBeNil)
+
+		var r Message
+		err = r.Decode(s)
+		So(err, ShouldBeNil)
+		So(r.Type, ShouldEqual, ERROR_RESPONSE)
+		So(r.Body.(ErrorResponse).Message, ShouldEqual, "incompatible protocol version for "+string(legacyID)+", supported versions: "+strings.Join(ProtocolVersions, ", "))
+	})
+
+	Convey("It should return an incompatibility error when sending to a legacy node", t, func() {
+		node3, err := makeNode(1236, "node3")
+		So(err, ShouldBeNil)
+		defer node3.Close()
+		node3.host.SetStreamHandler(node3.protocols[ActionProtocol].VersionID(LegacyProtocolVersion), func(s net.Stream) {
+			s.Close()
+		})
+		node2.host.Peerstore().AddAddr(node3.HashAddr, node3.NetAddr, pstore.PermanentAddrTTL)
+
+		m := node2.NewMessage(GOSSIP_REQUEST, GossipReq{})
+		_, err = node2.Send(context.Background(), ActionProtocol, node3.HashAddr, m)
+		So(err, ShouldResemble, IncompatibleProtocolErr{Protocol: "/hc-action-fakednahash", Versions: ProtocolVersions})
+	})
+
+	Convey("It should respond with err on messages over the size cap", t, func() {
+		node2.MaxMessageSize = DefaultMaxMessageSize * 2
+		node1.MaxMessageSize = 100
+		defer func() {
+			node1.MaxMessageSize = DefaultMaxMessageSize
+			node2.MaxMessageSize = DefaultMaxMessageSize
+		}()
+		m := node2.NewMessage(GOSSIP_REQUEST, GossipReq{})
+		m.Body = strings.Repeat("x", 200)
+		r, err := node2.Send(context.Background(), GossipProtocol, node1.HashAddr, m)
+		So(err, ShouldBeNil)
+		So(r.Type, ShouldEqual, ERROR_RESPONSE)
+		So(r.Body.(ErrorResponse).Code, ShouldEqual, ErrMessageTooLargeCode)
+	})
+
 	Convey("it should respond with err on messages from nodes on the blockedlist", t, func() {
 		node1.Block(node2.HashAddr)
 		m := node2.NewMessage(GOSSIP_REQUEST, GossipReq{})
@@ -285,6 +385,50 @@ func TestMessageCoding(t *testing.T) {
 
 }
 
+func TestMessageFraming(t *testing.T) {
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	m := node.NewMessage(PUT_REQUEST, "foo")
+	Convey("It should write and read length prefixed messages", t, func() {
+		for _, encoding := range WireEncodings {
+			var buf bytes.Buffer
+			err := node.writeMessage(&buf, encoding, m)
+			So(err, ShouldBeNil)
+			data, _ := m.EncodeAs(encoding)
+			So(buf.Len(), ShouldEqual, messageLengthSize+len(data))
+
+			var m2 Message
+			err = node.readMessage(&buf, encoding, &m2)
+			So(err, ShouldBeNil)
+			So(fmt.Sprintf("%v", m), ShouldEqual, fmt.Sprintf("%v", &m2))
+		}
+	})
+
+	Convey("It should refuse to write or read messages over the size cap", t, func() {
+		var buf bytes.Buffer
+		err := node.writeMessage(&buf, GobEncoding, m)
+		So(err, ShouldBeNil)
+
+		node.MaxMessageSize = 10
+		defer func() { node.MaxMessageSize = DefaultMaxMessageSize }()
+		var m2 Message
+		So(node.readMessage(&buf, GobEncoding, &m2), ShouldEqual, ErrMessageTooLarge)
+		So(node.writeMessage(&buf, GobEncoding, m), ShouldEqual, ErrMessageTooLarge)
+	})
+
+	Convey("It should version the protocol identifiers", t, func() {
+		p := node.protocols[ActionProtocol]
+		So(string(p.ID), ShouldEqual, "/hc-action-fakednahash/"+ProtocolVersion+"/cbor")
+		So(len(p.IDs()), ShouldEqual, len(ProtocolVersions)*len(WireEncodings))
+		So(p.encodingOf(p.EncodingID(ProtocolVersion, GobEncoding)), ShouldEqual, GobEncoding)
+		So(string(p.VersionID(LegacyProtocolVersion)), ShouldEqual, "/hc-action-fakednahash/0.0.0")
+	})
+}
+
 func TestFingerprintMessage(t *testing.T) {
 	Convey("it should create a unique fingerprint for messages", t, func() {
 		var id peer.ID
@@ -423,7 +567,7 @@ func makeNode(port int, id string) (*Node, error) {
 	listenaddr := fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", port)
 	_, key := makePeer(id)
 	agent := LibP2PAgent{identity: AgentIdentity(id), priv: key, pub: key.GetPublic()}
-	return NewNode(listenaddr, "fakednahash", &agent, false)
+	return NewNode([]string{listenaddr}, "fakednahash", &agent, false)
 }
 
 func addTestPeers(h *Holochain, peers []peer.ID, start int, count int) []peer.ID {
@@ -438,3 +582,54 @@ func addTestPeers(h *Holochain, peers []peer.ID, start int, count int) []peer.ID
 	}
 	return peers
 }
+
+func setupSendBenchmark(b *testing.B) (from *Node, to peer.ID, cleanup func()) {
+	d, _, h := PrepareTestChain("test")
+	h.node.Close()
+	node1, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	h.node = node1
+	// measure the sends rather than the rate limits
+	node1.SetRateLimits(RateLimits{PerPeer: map[string]RateLimit{}})
+	h.Activate()
+
+	node2, err := makeNode(1235, "node2")
+	if err != nil {
+		panic(err)
+	}
+	node2.host.Peerstore().AddAddr(node1.HashAddr, node1.NetAddr, pstore.PermanentAddrTTL)
+	from, to = node2, node1.HashAddr
+	cleanup = func() {
+		node2.Close()
+		CleanupTestChain(h, d)
+	}
+	b.ResetTimer()
+	return
+}
+
+func benchmarkSends(b *testing.B, versions []string) {
+	saved := ProtocolVersions
+	ProtocolVersions = versions
+	defer func() { ProtocolVersions = saved }()
+	from, to, cleanup := setupSendBenchmark(b)
+	defer cleanup()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, err := from.Send(context.Background(), GossipProtocol, to, from.NewMessage(GOSSIP_REQUEST, GossipReq{}))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSendStreamPerRequest(b *testing.B) {
+	benchmarkSends(b, []string{SingleRequestProtocolVersion})
+}
+
+func BenchmarkSendMultiplexed(b *testing.B) {
+	benchmarkSends(b, []string{ProtocolVersion})
+}
@@ -22,6 +22,8 @@ type DNA struct {
 	DHTConfig                 DHTConfig
 	Progenitor                Progenitor
 	Zomes                     []Zome
+	Libraries                 []Library // code loaded into zomes of the same ribosome type before their own code
+	Modules                   []Library // code that zomes load with require
 	propertiesSchemaValidator SchemaValidator
 }
 
@@ -0,0 +1,194 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements persisting what a node knows about its peers, i.e. their addresses, latency
+// metrics and whether they are in the routing table, so a restarted node can reconnect
+// without waiting on bootstrap servers or mDNS
+
+package holochain
+
+import (
+	"encoding/json"
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/tidwall/buntdb"
+	"path/filepath"
+	"time"
+)
+
+const (
+	PeerStoreTTL          = 24 * time.Hour // how long a peer is remembered after it was last seen
+	PeerStoreSaveInterval = time.Minute    // how often the known peers are saved
+)
+
+// PeerRecord holds what is remembered about a peer
+type PeerRecord struct {
+	ID      string
+	Addrs   []string
+	Latency time.Duration // the peer's latency EWMA
+	InTable bool          // whether the peer was in the routing table
+}
+
+// initPeerDB opens the database of remembered peers, the caller must hold peerLk
+func (h *Holochain) initPeerDB() (err error) {
+	if h.peerDB == nil {
+		h.peerDB, err = buntdb.Open(filepath.Join(h.DBPath(), PeerStoreFileName))
+	}
+	return
+}
+
+// SavePeers remembers the peers in the peerstore, other than this node and blocked peers,
+// for PeerStoreTTL
+func (h *Holochain) SavePeers() (err error) {
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	err = h.savePeers()
+	return
+}
+
+// savePeers does the work of SavePeers, the caller must hold peerLk
+func (h *Holochain) savePeers() (err error) {
+	if h.node == nil {
+		return
+	}
+	if err = h.initPeerDB(); err != nil {
+		return
+	}
+	n := h.node
+	err = h.peerDB.Update(func(tx *buntdb.Tx) error {
+		for _, id := range n.peerstore.Peers() {
+			if id == n.HashAddr || n.IsBlocked(id) {
+				continue
+			}
+			r := PeerRecord{ID: peer.IDB58Encode(id), Latency: n.metrics.LatencyEWMA(id), InTable: n.routingTable.Find(id) == id}
+			for _, addr := range n.peerstore.Addrs(id) {
+				r.Addrs = append(r.Addrs, addr.String())
+			}
+			if len(r.Addrs) == 0 {
+				continue
+			}
+			b, e := json.Marshal(r)
+			if e != nil {
+				return e
+			}
+			_, _, e = tx.Set("peer:"+r.ID, string(b), &buntdb.SetOptions{Expires: true, TTL: PeerStoreTTL})
+			if e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// LoadPeers adds the remembered peers back into the peerstore, metrics and routing table,
+// returning how many there were
+func (h *Holochain) LoadPeers() (count int, err error) {
+	var records []PeerRecord
+	records, err = h.peerRecords()
+	if err != nil {
+		return
+	}
+	n := h.node
+	for _, r := range records {
+		id, e := peer.IDB58Decode(r.ID)
+		if e != nil || id == n.HashAddr || n.IsBlocked(id) {
+			continue
+		}
+		var addrs []ma.Multiaddr
+		for _, a := range r.Addrs {
+			if addr, e := ma.NewMultiaddr(a); e == nil {
+				addrs = append(addrs, addr)
+			}
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		if r.Latency > 0 {
+			n.metrics.RecordLatency(id, r.Latency)
+		}
+		if r.InTable {
+			if e = h.AddPeer(id, addrs); e != nil {
+				h.dht.dlog.Logf("error adding remembered peer %s: %v", r.ID, e)
+				continue
+			}
+		} else {
+			n.peerstore.AddAddrs(id, addrs, PeerTTL)
+		}
+		count++
+	}
+	return
+}
+
+// peerRecords returns the remembered peers
+func (h *Holochain) peerRecords() (records []PeerRecord, err error) {
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	if err = h.initPeerDB(); err != nil {
+		return
+	}
+	err = h.peerDB.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys("peer:*", func(key, value string) bool {
+			var r PeerRecord
+			if json.Unmarshal([]byte(value), &r) == nil {
+				records = append(records, r)
+			}
+			return true
+		})
+	})
+	return
+}
+
+// RememberPeers loads the remembered peers and then saves the known peers on an interval
+func (h *Holochain) RememberPeers(interval time.Duration) (err error) {
+	var count int
+	count, err = h.LoadPeers()
+	if err != nil {
+		return
+	}
+	h.dht.dlog.Logf("loaded %d remembered peers", count)
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	h.stopSavingPeers()
+	var stop chan bool
+	stop = Ticker(interval, func() {
+		h.peerLk.Lock()
+		defer h.peerLk.Unlock()
+		// remembering peers may have been stopped while this tick was waiting for the lock
+		if h.savingPeers != stop {
+			return
+		}
+		if e := h.savePeers(); e != nil {
+			h.dht.dlog.Logf("error saving peers: %v", e)
+		}
+	})
+	h.savingPeers = stop
+	return
+}
+
+// stopSavingPeers stops the ticker that saves the known peers, the caller must hold peerLk
+func (h *Holochain) stopSavingPeers() {
+	if h.savingPeers != nil {
+		stop := h.savingPeers
+		h.savingPeers = nil
+		stop <- true
+	}
+}
+
+// stopRememberingPeers saves the known peers one last time and closes the peer database,
+// waiting for a save that is running to finish first so it can't reopen it
+func (h *Holochain) stopRememberingPeers() {
+	h.peerLk.Lock()
+	defer h.peerLk.Unlock()
+	if h.savingPeers != nil {
+		h.stopSavingPeers()
+		if err := h.savePeers(); err != nil {
+			h.dht.dlog.Logf("error saving peers: %v", err)
+		}
+	}
+	if h.peerDB != nil {
+		h.peerDB.Close()
+		h.peerDB = nil
+	}
+}
@@ -0,0 +1,80 @@
+package holochain
+
+import (
+	peer "github.com/libp2p/go-libp2p-peer"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"testing"
+	"time"
+)
+
+func TestRememberPeers(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	tablePeer, _ := makePeer("table peer")
+	otherPeer, _ := makePeer("other peer")
+	blockedPeer, _ := makePeer("blocked peer")
+	tableAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1234")
+	otherAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1235")
+	blockedAddr, _ := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1236")
+
+	h.node.metrics.RecordLatency(tablePeer, 20*time.Millisecond)
+	if err := h.AddPeer(tablePeer, []ma.Multiaddr{tableAddr}); err != nil {
+		panic(err)
+	}
+	h.node.peerstore.AddAddrs(otherPeer, []ma.Multiaddr{otherAddr}, PeerTTL)
+	h.node.peerstore.AddAddrs(blockedPeer, []ma.Multiaddr{blockedAddr}, PeerTTL)
+	h.node.Block(blockedPeer)
+
+	Convey("it should save the peers that aren't blocked", t, func() {
+		So(h.SavePeers(), ShouldBeNil)
+		h.stopRememberingPeers()
+	})
+
+	Convey("it should load them back into a fresh node", t, func() {
+		h.node.Close()
+		if err := h.createNode(); err != nil {
+			panic(err)
+		}
+		So(h.node.routingTable.Size(), ShouldEqual, 0)
+
+		count, err := h.LoadPeers()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+		So(h.node.routingTable.Find(tablePeer), ShouldEqual, tablePeer)
+		So(h.node.routingTable.Find(otherPeer), ShouldNotEqual, otherPeer)
+		So(h.node.metrics.LatencyEWMA(tablePeer), ShouldEqual, 20*time.Millisecond)
+		So(h.node.peerstore.Addrs(tablePeer)[0].String(), ShouldEqual, tableAddr.String())
+		So(h.node.peerstore.Addrs(otherPeer)[0].String(), ShouldEqual, otherAddr.String())
+		So(len(h.node.peerstore.Addrs(blockedPeer)), ShouldEqual, 0)
+	})
+
+	Convey("it should not load peers once they have expired", t, func() {
+		expiredPeer, _ := makePeer("expired peer")
+		id := peer.IDB58Encode(expiredPeer)
+		err := h.peerDB.Update(func(tx *buntdb.Tx) error {
+			_, _, err := tx.Set("peer:"+id, `{"ID":"`+id+`","Addrs":["/ip4/127.0.0.1/tcp/1237"]}`, &buntdb.SetOptions{Expires: true, TTL: time.Millisecond})
+			return err
+		})
+		So(err, ShouldBeNil)
+		time.Sleep(10 * time.Millisecond)
+		count, err := h.LoadPeers()
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 2)
+		So(len(h.node.peerstore.Addrs(expiredPeer)), ShouldEqual, 0)
+	})
+
+	Convey("stopping remembering peers should leave the peer database closed", t, func() {
+		So(h.RememberPeers(time.Millisecond), ShouldBeNil)
+		So(h.savingPeers, ShouldNotBeNil)
+		time.Sleep(time.Millisecond * 10)
+		h.stopRememberingPeers()
+		So(h.savingPeers, ShouldBeNil)
+		time.Sleep(time.Millisecond * 10)
+		h.peerLk.Lock()
+		So(h.peerDB, ShouldBeNil)
+		h.peerLk.Unlock()
+	})
+}
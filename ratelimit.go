@@ -0,0 +1,286 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements limits on the requests other nodes can make of this one, so a misbehaving
+// peer can't saturate validation and storage
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxInboundRequests  = 64               // default number of incoming requests handled at once
+	DefaultRateLimitBlockAfter = 100              // default rate limited requests in a minute after which a peer is blocked
+	DefaultRateLimitBlockFor   = 10 * 60          // default seconds a rate limited peer stays blocked
+	rateLimitStrikeWindow      = time.Minute      // the window over which rate limited requests are counted
+	rateLimitIdlePeer          = 10 * time.Minute // how long a quiet peer's buckets are kept
+)
+
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimit is a token bucket limit on how often a peer may send a type of message
+type RateLimit struct {
+	Rate  float64 // messages per second, 0 means unlimited
+	Burst int     // messages that may arrive at once
+}
+
+// RateLimits configures the limits on requests coming in from other nodes
+type RateLimits struct {
+	PerPeer    map[string]RateLimit // limits for each peer by message type name, e.g. "GET_REQUEST"
+	MaxInbound int                  // incoming requests handled at once across all peers
+	BlockAfter int                  // rate limited requests in a minute after which a peer is temporarily blocked, negative never blocks
+	BlockFor   int                  // seconds a rate limited peer stays blocked
+}
+
+// DefaultRateLimits returns the limits used when a holochain doesn't configure its own
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		PerPeer: map[string]RateLimit{
+			PUT_REQUEST.String():    RateLimit{Rate: 50, Burst: 100},
+			GET_REQUEST.String():    RateLimit{Rate: 100, Burst: 200},
+			GOSSIP_REQUEST.String(): RateLimit{Rate: 10, Burst: 20},
+			APP_MESSAGE.String():    RateLimit{Rate: 20, Burst: 40},
+		},
+		MaxInbound: DefaultMaxInboundRequests,
+		BlockAfter: DefaultRateLimitBlockAfter,
+		BlockFor:   DefaultRateLimitBlockFor,
+	}
+}
+
+// RateLimitStats reports how often the rate limits have been hit
+type RateLimitStats struct {
+	Rejected map[string]int // rate limited requests by message type name
+	Blocks   int            // times a peer was blocked for too many rate limited requests
+	Blocked  []peer.ID      // peers currently blocked for too many rate limited requests
+}
+
+// msgTypeByName returns the MsgType with the given name
+func msgTypeByName(name string) (t MsgType, err error) {
+	for t = ERROR_RESPONSE; t <= FIND_NODE_REQUEST; t++ {
+		if t.String() == name {
+			return
+		}
+	}
+	err = fmt.Errorf("unknown message type: %s", name)
+	return
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket, after refilling it for the time since the last take
+func (b *tokenBucket) take(limit RateLimit, now time.Time) bool {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type peerQuota struct {
+	buckets map[MsgType]*tokenBucket
+	strikes int       // rate limited requests in the current window
+	window  time.Time // start of the current window
+	seen    time.Time
+}
+
+type rateLimiter struct {
+	lk         sync.Mutex
+	limits     map[MsgType]RateLimit
+	blockAfter int
+	blockFor   time.Duration
+	peers      map[peer.ID]*peerQuota
+	rejected   map[MsgType]int
+	blocks     int
+	blocked    map[peer.ID]bool
+	pruned     time.Time
+}
+
+func newRateLimiter(limits RateLimits) (r *rateLimiter, err error) {
+	r = &rateLimiter{
+		limits:     make(map[MsgType]RateLimit),
+		blockAfter: limits.BlockAfter,
+		blockFor:   time.Duration(limits.BlockFor) * time.Second,
+		peers:      make(map[peer.ID]*peerQuota),
+		rejected:   make(map[MsgType]int),
+		blocked:    make(map[peer.ID]bool),
+	}
+	for name, limit := range limits.PerPeer {
+		var t MsgType
+		t, err = msgTypeByName(name)
+		if err != nil {
+			return
+		}
+		if limit.Rate > 0 {
+			r.limits[t] = limit
+		}
+	}
+	return
+}
+
+// take uses up one of a peer's requests of a type, returning whether the request is allowed
+// and whether the peer has now been rate limited often enough to be blocked
+func (r *rateLimiter) take(from peer.ID, t MsgType, now time.Time) (ok bool, block bool) {
+	limit, limited := r.limits[t]
+	if !limited {
+		ok = true
+		return
+	}
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	r.prune(now)
+	q := r.peers[from]
+	if q == nil {
+		q = &peerQuota{buckets: make(map[MsgType]*tokenBucket), window: now}
+		r.peers[from] = q
+	}
+	q.seen = now
+	b := q.buckets[t]
+	if b == nil {
+		b = &tokenBucket{}
+		q.buckets[t] = b
+	}
+	if ok = b.take(limit, now); ok {
+		return
+	}
+	r.rejected[t]++
+	if now.Sub(q.window) > rateLimitStrikeWindow {
+		q.window = now
+		q.strikes = 0
+	}
+	q.strikes++
+	if r.blockAfter > 0 && q.strikes >= r.blockAfter && !r.blocked[from] {
+		q.strikes = 0
+		r.blocks++
+		r.blocked[from] = true
+		block = true
+	}
+	return
+}
+
+// prune forgets the buckets of peers that have gone quiet
+func (r *rateLimiter) prune(now time.Time) {
+	if now.Sub(r.pruned) < rateLimitIdlePeer {
+		return
+	}
+	r.pruned = now
+	for id, q := range r.peers {
+		if now.Sub(q.seen) > rateLimitIdlePeer {
+			delete(r.peers, id)
+		}
+	}
+}
+
+// release records that a peer's block has ended, returning whether it had been blocked
+func (r *rateLimiter) release(from peer.ID) (ok bool) {
+	r.lk.Lock()
+	ok = r.blocked[from]
+	delete(r.blocked, from)
+	r.lk.Unlock()
+	return
+}
+
+func (r *rateLimiter) stats() (stats RateLimitStats) {
+	r.lk.Lock()
+	defer r.lk.Unlock()
+	stats.Rejected = make(map[string]int)
+	for t, count := range r.rejected {
+		stats.Rejected[t.String()] = count
+	}
+	stats.Blocks = r.blocks
+	for id := range r.blocked {
+		stats.Blocked = append(stats.Blocked, id)
+	}
+	return
+}
+
+// SetRateLimits configures the limits on requests from other nodes
+func (node *Node) SetRateLimits(limits RateLimits) (err error) {
+	defaults := DefaultRateLimits()
+	if limits.PerPeer == nil {
+		limits.PerPeer = defaults.PerPeer
+	}
+	if limits.MaxInbound <= 0 {
+		limits.MaxInbound = defaults.MaxInbound
+	}
+	if limits.BlockAfter == 0 {
+		limits.BlockAfter = defaults.BlockAfter
+	}
+	if limits.BlockFor <= 0 {
+		limits.BlockFor = defaults.BlockFor
+	}
+	limiter, err := newRateLimiter(limits)
+	if err != nil {
+		return
+	}
+	node.llk.Lock()
+	node.limiter = limiter
+	node.inbound = make(chan bool, limits.MaxInbound)
+	node.llk.Unlock()
+	return
+}
+
+// rateLimiting returns the node's current rate limiter and inbound request limit, requests
+// keep using the ones they started with if the limits are changed while they are handled
+func (node *Node) rateLimiting() (limiter *rateLimiter, inbound chan bool) {
+	node.llk.Lock()
+	defer node.llk.Unlock()
+	return node.limiter, node.inbound
+}
+
+// RateLimitStats returns the counts of requests rejected and peers blocked by the rate limits
+func (node *Node) RateLimitStats() RateLimitStats {
+	limiter, _ := node.rateLimiting()
+	return limiter.stats()
+}
+
+// limitRequest checks a request from a peer against the rate limits, temporarily blocking
+// peers that keep exceeding them
+func (node *Node) limitRequest(from peer.ID, t MsgType) (err error) {
+	limiter, _ := node.rateLimiting()
+	ok, block := limiter.take(from, t, time.Now())
+	if ok {
+		return
+	}
+	err = ErrRateLimited
+	if !block {
+		return
+	}
+	if node.IsBlocked(from) {
+		// already blocked some other way, so leave it to whatever blocked it to unblock
+		limiter.release(from)
+		return
+	}
+	node.Block(from)
+	stats := limiter.stats()
+	Infof("blocked peer %v for %v after repeated rate limiting (%d blocks so far, rejected: %v)", from, limiter.blockFor, stats.Blocks, stats.Rejected)
+	time.AfterFunc(limiter.blockFor, func() {
+		if limiter.release(from) {
+			node.Unblock(from)
+			Infof("unblocked rate limited peer %v", from)
+		}
+	})
+	return
+}
@@ -0,0 +1,131 @@
+package holochain
+
+import (
+	"context"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	Convey("it should allow a burst and then refill at the rate", t, func() {
+		var b tokenBucket
+		limit := RateLimit{Rate: 2, Burst: 3}
+		now := time.Unix(1, 0)
+		So(b.take(limit, now), ShouldBeTrue)
+		So(b.take(limit, now), ShouldBeTrue)
+		So(b.take(limit, now), ShouldBeTrue)
+		So(b.take(limit, now), ShouldBeFalse)
+		So(b.take(limit, now.Add(time.Second/2)), ShouldBeTrue)
+		So(b.take(limit, now.Add(time.Second/2)), ShouldBeFalse)
+		So(b.take(limit, now.Add(time.Hour)), ShouldBeTrue)
+		So(b.tokens, ShouldEqual, 2)
+	})
+}
+
+func TestRateLimiter(t *testing.T) {
+	from, _ := makePeer("peer")
+	other, _ := makePeer("other peer")
+
+	Convey("it should reject unknown message types", t, func() {
+		_, err := newRateLimiter(RateLimits{PerPeer: map[string]RateLimit{"FISH_REQUEST": RateLimit{Rate: 1}}})
+		So(err.Error(), ShouldEqual, "unknown message type: FISH_REQUEST")
+	})
+
+	Convey("it should limit each peer and message type separately", t, func() {
+		r, err := newRateLimiter(RateLimits{PerPeer: map[string]RateLimit{"GET_REQUEST": RateLimit{Rate: 1, Burst: 1}}, BlockAfter: 3})
+		So(err, ShouldBeNil)
+		now := time.Unix(1, 0)
+		ok, _ := r.take(from, GET_REQUEST, now)
+		So(ok, ShouldBeTrue)
+		ok, _ = r.take(from, GET_REQUEST, now)
+		So(ok, ShouldBeFalse)
+		ok, _ = r.take(other, GET_REQUEST, now)
+		So(ok, ShouldBeTrue)
+		ok, _ = r.take(from, PUT_REQUEST, now)
+		So(ok, ShouldBeTrue)
+
+		Convey("and say to block peers that keep exceeding their limits", func() {
+			ok, block := r.take(from, GET_REQUEST, now)
+			So(ok || block, ShouldBeFalse)
+			ok, block = r.take(from, GET_REQUEST, now)
+			So(ok, ShouldBeFalse)
+			So(block, ShouldBeTrue)
+			stats := r.stats()
+			So(stats.Rejected["GET_REQUEST"], ShouldEqual, 3)
+			So(stats.Blocks, ShouldEqual, 1)
+			So(stats.Blocked, ShouldResemble, []peer.ID{from})
+			So(r.release(from), ShouldBeTrue)
+			So(r.release(from), ShouldBeFalse)
+		})
+	})
+}
+
+func TestNodeRateLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	node1, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	h.node.Close()
+	h.node = node1
+	h.Activate()
+
+	node2, err := makeNode(1235, "node2")
+	if err != nil {
+		panic(err)
+	}
+	defer node2.Close()
+	node2.host.Peerstore().AddAddr(node1.HashAddr, node1.NetAddr, pstore.PermanentAddrTTL)
+
+	err = node1.SetRateLimits(RateLimits{PerPeer: map[string]RateLimit{"GOSSIP_REQUEST": RateLimit{Rate: 0.001, Burst: 2}}, BlockAfter: 2, BlockFor: 1})
+	if err != nil {
+		panic(err)
+	}
+
+	send := func() Message {
+		r, err := node2.Send(context.Background(), GossipProtocol, node1.HashAddr, node2.NewMessage(GOSSIP_REQUEST, GossipReq{}))
+		So(err, ShouldBeNil)
+		return r
+	}
+
+	Convey("it should respond with err once a peer exceeds its rate limit", t, func() {
+		So(send().Type, ShouldEqual, OK_RESPONSE)
+		So(send().Type, ShouldEqual, OK_RESPONSE)
+		r := send()
+		So(r.Type, ShouldEqual, ERROR_RESPONSE)
+		So(r.Body.(ErrorResponse).Code, ShouldEqual, ErrRateLimitedCode)
+	})
+
+	Convey("it should temporarily block peers that keep exceeding it", t, func() {
+		ShouldLog(&infoLog, "blocked peer "+node2.HashAddr.String(), func() {
+			send()
+		})
+		So(node1.IsBlocked(node2.HashAddr), ShouldBeTrue)
+		So(send().Body.(ErrorResponse).Code, ShouldEqual, ErrBlockedListedCode)
+		So(node1.RateLimitStats().Blocks, ShouldEqual, 1)
+
+		time.Sleep(time.Second + 200*time.Millisecond)
+		So(node1.IsBlocked(node2.HashAddr), ShouldBeFalse)
+		So(len(node1.RateLimitStats().Blocked), ShouldEqual, 0)
+	})
+
+	Convey("it should be safe to change the limits while requests are handled", t, func() {
+		done := make(chan bool)
+		go func() {
+			for i := 0; i < 10; i++ {
+				node2.Send(context.Background(), GossipProtocol, node1.HashAddr, node2.NewMessage(GOSSIP_REQUEST, GossipReq{}))
+			}
+			done <- true
+		}()
+		for i := 0; i < 20; i++ {
+			So(node1.SetRateLimits(DefaultRateLimits()), ShouldBeNil)
+		}
+		<-done
+		So(send().Type, ShouldEqual, OK_RESPONSE)
+	})
+}
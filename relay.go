@@ -0,0 +1,223 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements circuit relaying, so nodes behind NATs that can't be mapped can still be
+// reached (and so have their authored data validated) through publicly reachable nodes that
+// have opted in to relaying for them
+
+package holochain
+
+import (
+	"context"
+	"fmt"
+	relay "github.com/libp2p/go-libp2p-circuit"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	go_net "net"
+	"time"
+)
+
+const (
+	RelayRefreshInterval = time.Minute      // how often connections to relays are checked
+	RelayConnectTimeout  = 10 * time.Second // how long connecting to a relay may take
+)
+
+// Reachability is whether other nodes can connect to this one directly
+type Reachability int
+
+const (
+	ReachabilityPrivate Reachability = iota // behind a NAT or firewall without a port mapping
+	ReachabilityPublic
+)
+
+func (r Reachability) String() string {
+	return []string{"private", "public"}[r]
+}
+
+// relayServer is a node that may relay connections to this one
+type relayServer struct {
+	ID   peer.ID
+	Addr ma.Multiaddr // the relay's own transport address, without its /ipfs/ part
+}
+
+var privateNets = func() (nets []*go_net.IPNet) {
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := go_net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return
+}()
+
+// isPublicIP returns true if an address can be routed to over the internet
+func isPublicIP(ip go_net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRelayAddr splits the multiaddress of a relay, e.g.
+// /ip4/104.236.179.241/tcp/4001/ipfs/QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM,
+// into the relay's ID and transport address
+func parseRelayAddr(s string) (r relayServer, err error) {
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return
+	}
+	id, err := addr.ValueForProtocol(ma.P_IPFS)
+	if err != nil {
+		err = fmt.Errorf("relay address %s has no /ipfs/ peer ID", s)
+		return
+	}
+	r.ID, err = peer.IDB58Decode(id)
+	if err != nil {
+		return
+	}
+	ipfs, err := ma.NewMultiaddr("/ipfs/" + id)
+	if err != nil {
+		return
+	}
+	r.Addr = addr.Decapsulate(ipfs)
+	return
+}
+
+// EnableRelay adds the circuit relay transport to the node, so it can reach and be reached
+// through relays, and if hop is true lets it relay connections for other nodes
+func (n *Node) EnableRelay(hop bool) (err error) {
+	var opts []relay.RelayOpt
+	if hop {
+		opts = append(opts, relay.OptHop)
+		if n.Reachability() != ReachabilityPublic {
+			Infof("relay: relaying is enabled but this node doesn't seem to be publicly reachable")
+		}
+	}
+	err = relay.AddRelayTransport(n.ctx, n.host, opts...)
+	return
+}
+
+// AddRelay adds a relay that the node may be reached through when it isn't publicly reachable
+func (n *Node) AddRelay(addr string) (err error) {
+	r, err := parseRelayAddr(addr)
+	if err != nil {
+		return
+	}
+	n.peerstore.AddAddr(r.ID, r.Addr, pstore.PermanentAddrTTL)
+	n.rlk.Lock()
+	n.relays = append(n.relays, r)
+	n.rlk.Unlock()
+	return
+}
+
+// Reachability detects whether other nodes can connect to this one directly, either
+// because it has a NAT port mapping or it is listening on a public address
+func (n *Node) Reachability() Reachability {
+	if n.mappedAddr() != nil {
+		return ReachabilityPublic
+	}
+	for _, ip := range n.listenIPs() {
+		if isPublicIP(ip) {
+			return ReachabilityPublic
+		}
+	}
+	return ReachabilityPrivate
+}
+
+// listenIPs returns the IP addresses the node listens on, looking them up from the
+// interfaces if it listens on all of them
+func (n *Node) listenIPs() (ips []go_net.IP) {
+	s, err := n.NetAddr.ValueForProtocol(ma.P_IP4)
+	if err != nil {
+		s, err = n.NetAddr.ValueForProtocol(ma.P_IP6)
+	}
+	if err != nil {
+		return
+	}
+	ip := go_net.ParseIP(s)
+	if !ip.IsUnspecified() {
+		ips = append(ips, ip)
+		return
+	}
+	addrs, _ := go_net.InterfaceAddrs()
+	ips = interfaceIPs(addrs, ip.To4() != nil)
+	return
+}
+
+// interfaceIPs returns the IPs of the interface addresses of one family, as a node listening
+// on 0.0.0.0 can only be reached on the IPv4 ones and a node listening on :: on the IPv6 ones
+func interfaceIPs(addrs []go_net.Addr, ip4 bool) (ips []go_net.IP) {
+	for _, addr := range addrs {
+		if v, ok := addr.(*go_net.IPNet); ok && (v.IP.To4() != nil) == ip4 {
+			ips = append(ips, v.IP)
+		}
+	}
+	return
+}
+
+// relayedAddr returns an address the node can be reached at through a connected relay
+func (n *Node) relayedAddr() ma.Multiaddr {
+	n.rlk.Lock()
+	defer n.rlk.Unlock()
+	for _, r := range n.relays {
+		if n.host.Network().Connectedness(r.ID) != net.Connected {
+			continue
+		}
+		circuit, err := ma.NewMultiaddr("/ipfs/" + peer.IDB58Encode(r.ID) + "/p2p-circuit")
+		if err == nil {
+			return r.Addr.Encapsulate(circuit)
+		}
+	}
+	return nil
+}
+
+// connectRelays connects to the node's relays that it isn't already connected to,
+// returning how many it is connected to
+func (n *Node) connectRelays() (connected int) {
+	n.rlk.Lock()
+	relays := n.relays
+	n.rlk.Unlock()
+	for _, r := range relays {
+		if n.host.Network().Connectedness(r.ID) != net.Connected {
+			ctx, cancel := context.WithTimeout(n.ctx, RelayConnectTimeout)
+			err := n.host.Connect(ctx, pstore.PeerInfo{ID: r.ID, Addrs: []ma.Multiaddr{r.Addr}})
+			cancel()
+			if err != nil {
+				Debugf("relay: couldn't connect to %v: %v", r.ID, err)
+				continue
+			}
+		}
+		connected++
+	}
+	return
+}
+
+// RelayRefresh keeps the node connected to its relays, if it needs them because it
+// isn't publicly reachable
+func (h *Holochain) RelayRefresh(interval time.Duration) {
+	h.stopRelayRefresh()
+	if h.node.Reachability() == ReachabilityPublic || len(h.node.relays) == 0 {
+		return
+	}
+	refresh := func() {
+		connected := h.node.connectRelays()
+		h.dht.dlog.Logf("relay: not publicly reachable, connected to %d of %d relays", connected, len(h.node.relays))
+	}
+	refresh()
+	h.relayRefreshing = Ticker(interval, refresh)
+}
+
+// stopRelayRefresh stops keeping the node connected to its relays
+func (h *Holochain) stopRelayRefresh() {
+	if h.relayRefreshing != nil {
+		stop := h.relayRefreshing
+		h.relayRefreshing = nil
+		stop <- true
+	}
+}
@@ -0,0 +1,99 @@
+package holochain
+
+import (
+	"context"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	. "github.com/smartystreets/goconvey/convey"
+	go_net "net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	Convey("it should only treat internet routable addresses as public", t, func() {
+		for _, ip := range []string{"127.0.0.1", "0.0.0.0", "10.1.2.3", "172.16.0.1", "192.168.1.1", "100.64.0.1", "169.254.1.1", "::1", "fd00::1", "fe80::1"} {
+			So(isPublicIP(go_net.ParseIP(ip)), ShouldBeFalse)
+		}
+		for _, ip := range []string{"104.236.179.241", "8.8.8.8", "2001:4860:4860::8888"} {
+			So(isPublicIP(go_net.ParseIP(ip)), ShouldBeTrue)
+		}
+	})
+}
+
+func TestInterfaceIPs(t *testing.T) {
+	var addrs []go_net.Addr
+	for _, s := range []string{"127.0.0.1/8", "8.8.8.8/24", "::1/128", "2001:4860:4860::8888/64"} {
+		ip, ipnet, _ := go_net.ParseCIDR(s)
+		ipnet.IP = ip
+		addrs = append(addrs, ipnet)
+	}
+	Convey("a node listening on 0.0.0.0 should only be reachable on the IPv4 interface addresses", t, func() {
+		ips := interfaceIPs(addrs, go_net.ParseIP("0.0.0.0").To4() != nil)
+		So(len(ips), ShouldEqual, 2)
+		So(ips[0].String(), ShouldEqual, "127.0.0.1")
+		So(ips[1].String(), ShouldEqual, "8.8.8.8")
+	})
+	Convey("a node listening on :: should only be reachable on the IPv6 interface addresses", t, func() {
+		ips := interfaceIPs(addrs, go_net.ParseIP("::").To4() != nil)
+		So(len(ips), ShouldEqual, 2)
+		So(ips[0].String(), ShouldEqual, "::1")
+		So(ips[1].String(), ShouldEqual, "2001:4860:4860::8888")
+	})
+}
+
+func TestParseRelayAddr(t *testing.T) {
+	Convey("it should split a relay address into its ID and transport address", t, func() {
+		r, err := parseRelayAddr("/ip4/104.236.179.241/tcp/4001/ipfs/QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM")
+		So(err, ShouldBeNil)
+		So(peer.IDB58Encode(r.ID), ShouldEqual, "QmSoLPppuBtQSGwKDZT2M73ULpjvfd3aZ6ha4oFGL1KrGM")
+		So(r.Addr.String(), ShouldEqual, "/ip4/104.236.179.241/tcp/4001")
+	})
+
+	Convey("it should require the relay's ID", t, func() {
+		_, err := parseRelayAddr("/ip4/104.236.179.241/tcp/4001")
+		So(err.Error(), ShouldEqual, "relay address /ip4/104.236.179.241/tcp/4001 has no /ipfs/ peer ID")
+	})
+}
+
+func TestRelay(t *testing.T) {
+	relayNode, err := makeNode(1234, "relay")
+	if err != nil {
+		panic(err)
+	}
+	defer relayNode.Close()
+	natted, err := makeNode(1235, "natted")
+	if err != nil {
+		panic(err)
+	}
+	defer natted.Close()
+	other, err := makeNode(1236, "other")
+	if err != nil {
+		panic(err)
+	}
+	defer other.Close()
+
+	Convey("nodes listening on private addresses should not be publicly reachable", t, func() {
+		So(natted.Reachability(), ShouldEqual, ReachabilityPrivate)
+		So(natted.ExternalAddr()[0].String(), ShouldEqual, natted.NetAddr.String())
+	})
+
+	Convey("it should report a relayed address once connected to a relay", t, func() {
+		So(relayNode.EnableRelay(true), ShouldBeNil)
+		So(natted.EnableRelay(false), ShouldBeNil)
+		So(other.EnableRelay(false), ShouldBeNil)
+
+		err := natted.AddRelay(relayNode.NetAddr.String() + "/ipfs/" + peer.IDB58Encode(relayNode.HashAddr))
+		So(err, ShouldBeNil)
+		So(natted.ExternalAddr()[0].String(), ShouldEqual, natted.NetAddr.String())
+		So(natted.connectRelays(), ShouldEqual, 1)
+		So(natted.ExternalAddr()[0].String(), ShouldEqual, relayNode.NetAddr.String()+"/ipfs/"+peer.IDB58Encode(relayNode.HashAddr)+"/p2p-circuit")
+	})
+
+	Convey("other nodes should be able to connect through the relay", t, func() {
+		other.peerstore.AddAddr(relayNode.HashAddr, relayNode.NetAddr, pstore.PermanentAddrTTL)
+		err := other.host.Connect(context.Background(), pstore.PeerInfo{ID: natted.HashAddr, Addrs: natted.ExternalAddr()})
+		So(err, ShouldBeNil)
+		So(other.host.Network().Connectedness(natted.HashAddr), ShouldEqual, net.Connected)
+	})
+}
@@ -7,11 +7,16 @@
 package holochain
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/metacurrency/holochain/hash"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type RibosomeFactory func(h *Holochain, zome *Zome) (Ribosome, error)
@@ -46,12 +51,263 @@ const (
 )
 
 var ValidationFailedErr = errors.New("Validation Failed")
+var ErrRibosomeAbandoned = errors.New("ribosome was abandoned after exceeding its execution limits")
+
+// ExecLimits holds the resource budgets for each call into a ribosome, zero values mean no limit,
+// though a holochain with no limits set at all, such as one whose config predates them, gets
+// DefaultExecLimits.  A step is each statement and expression evaluated for javascript, each
+// function call for zygo, and each function call and loop iteration for wasm.  Interpreters
+// that can't count steps are interrupted once they pass the Timeout.
+type ExecLimits struct {
+	Timeout    int // milliseconds a call may run before it is interrupted
+	StackDepth int // maximum depth of the javascript call stack
+	Memory     int // maximum bytes of linear memory a wasm module may grow to, checked at each host call
+	Steps      int // maximum number of steps a call may take
+}
+
+// ExecLimitErr is returned when a ribosome call exceeds one of its ExecLimits.  Because
+// validation runs for other people's data, validation treats this as a rejection.
+type ExecLimitErr struct {
+	Limit string
+	Value int
+}
+
+func (e *ExecLimitErr) Error() string {
+	return fmt.Sprintf("ribosome exceeded its %s limit of %d", e.Limit, e.Value)
+}
+
+// NondeterministicCallErr is returned by a validation function that used a host function,
+// or a builtin, that could give different results on different nodes.  Nodes must agree on
+// what is valid, so the validation fails even if the app code caught the error.
+type NondeterministicCallErr struct {
+	Fn string
+}
+
+func (e *NondeterministicCallErr) Error() string {
+	return fmt.Sprintf("%s is not allowed during validation because its result can differ between nodes", e.Fn)
+}
+
+// nondeterministicFns are the host functions which reach the network, or depend on or change
+// the local node's state, and so can't be called by validation functions
+var nondeterministicFns = map[string]bool{
+	"get":         true,
+	"getLinks":    true,
+	"send":        true,
+	"call":        true,
+	"bridge":      true,
+	"getBridges":  true,
+	"query":       true,
+	"commit":      true,
+	"update":      true,
+	"updateAgent": true,
+	"remove":      true,
+	"sign":        true,
+}
+
+// validationContext is embedded in ribosomes to restrict what app code can do while one of
+// its validation functions is running
+type validationContext struct {
+	validating bool
+	time       *time.Time // the time in the header being validated, if there is one
+	violation  error
+}
+
+// startValidation enters the restricted context for validating an action
+func (c *validationContext) startValidation(action interface{}) {
+	c.validating = true
+	c.violation = nil
+	c.time = nil
+	var header *Header
+	switch t := action.(type) {
+	case *ActionPut:
+		header = t.header
+	case *ActionCommit:
+		header = t.header
+	case *ActionMod:
+		header = t.header
+	}
+	if header != nil {
+		c.time = &header.Time
+	}
+}
+
+// endValidation leaves the restricted context, returning the error of any nondeterministic
+// call in place of the validation's result
+func (c *validationContext) endValidation(err error) error {
+	if c.violation != nil {
+		err = c.violation
+	}
+	c.validating = false
+	c.violation = nil
+	c.time = nil
+	return err
+}
+
+// checkCall returns an error if a host function may not be called in the current context
+func (c *validationContext) checkCall(fnName string) (err error) {
+	if c == nil || !c.validating || !nondeterministicFns[fnName] {
+		return
+	}
+	err = c.nondeterministic(fnName)
+	return
+}
+
+// nondeterministic records the use of a nondeterministic function during validation
+func (c *validationContext) nondeterministic(fnName string) (err error) {
+	err = &NondeterministicCallErr{Fn: fnName}
+	if c.violation == nil {
+		c.violation = err
+	}
+	return
+}
+
+// restrict wraps a host function so that it fails when called during validation
+func (c *validationContext) restrict(fnName string, fn jsonHostFn) jsonHostFn {
+	return func(args []interface{}) (result interface{}, err error) {
+		if err = c.checkCall(fnName); err != nil {
+			return
+		}
+		return fn(args)
+	}
+}
+
+// DefaultExecLimits returns the execution limits used when none are configured
+func DefaultExecLimits() ExecLimits {
+	return ExecLimits{Timeout: DefaultExecTimeout, StackDepth: DefaultExecStackDepth, Steps: DefaultExecSteps}
+}
+
+// execLimits returns the execution limits configured for a holochain
+func execLimits(h *Holochain) (limits ExecLimits) {
+	if h != nil {
+		limits = h.Config.ExecLimits
+	}
+	if limits == (ExecLimits{}) {
+		limits = DefaultExecLimits()
+	}
+	return
+}
+
+// execErr wraps an error from running a ribosome function, keeping execution limit errors distinct
+func execErr(fnName string, err error) error {
+	if _, ok := err.(*ExecLimitErr); ok {
+		return err
+	}
+	return fmt.Errorf("Error executing %s: %v", fnName, err)
+}
+
+// interrupter is embedded in ribosomes whose interpreters have no interrupt of their own.
+// Once interrupted the interpreter is stopped at its next check, its host functions refuse
+// to run and it must not be used again.
+type interrupter struct {
+	stopped int32
+}
+
+// interrupt marks the interpreter as stopped, it may be called from any goroutine
+func (i *interrupter) interrupt() {
+	atomic.StoreInt32(&i.stopped, 1)
+}
+
+// interrupted returns true if the interpreter has been stopped
+func (i *interrupter) interrupted() bool {
+	return atomic.LoadInt32(&i.stopped) == 1
+}
+
+// runWithTimeout runs fn, giving up on it if it doesn't finish within timeout milliseconds,
+// in which case interrupt is called to stop the interpreter running fn in the background.
+func runWithTimeout(timeout int, interrupt func(), fn func() (interface{}, error)) (result interface{}, err error) {
+	if timeout <= 0 {
+		return fn()
+	}
+	type ret struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan ret, 1)
+	go func() {
+		r, e := fn()
+		done <- ret{r, e}
+	}()
+	select {
+	case r := <-done:
+		result, err = r.result, r.err
+	case <-time.After(time.Duration(timeout) * time.Millisecond):
+		interrupt()
+		err = &ExecLimitErr{Limit: "time", Value: timeout}
+	}
+	return
+}
 
 // FunctionDef holds the name and calling type of an DNA exposed function
 type FunctionDef struct {
-	Name        string
-	CallingType string
-	Exposure    string
+	Name             string
+	CallingType      string
+	Exposure         string
+	InputSchema      string // optional JSON schema the function's arguments must match
+	OutputSchema     string // optional JSON schema the function's result must match
+	InputSchemaFile  string // file in the zome's directory from which InputSchema is loaded
+	OutputSchemaFile string // file in the zome's directory from which OutputSchema is loaded
+}
+
+// functionValidators caches the validators built from function schemas
+var functionValidators = struct {
+	sync.Mutex
+	m map[string]SchemaValidator
+}{m: make(map[string]SchemaValidator)}
+
+// schemaValidator returns the validator for a function schema
+func schemaValidator(schema string) (validator SchemaValidator, err error) {
+	functionValidators.Lock()
+	defer functionValidators.Unlock()
+	validator, ok := functionValidators.m[schema]
+	if !ok {
+		validator, err = BuildJSONSchemaValidatorFromString(schema)
+		if err != nil {
+			return
+		}
+		functionValidators.m[schema] = validator
+	}
+	return
+}
+
+// validateSchema checks a function's arguments or result against a schema.  JSON_CALLING
+// values are checked as the JSON they hold and STRING_CALLING values as strings.
+func (f *FunctionDef) validateSchema(schema string, what string, value interface{}) (err error) {
+	if schema == "" {
+		return
+	}
+	var validator SchemaValidator
+	validator, err = schemaValidator(schema)
+	if err != nil {
+		err = fmt.Errorf("bad %s schema for %s: %v", what, f.Name, err)
+		return
+	}
+	var v interface{}
+	switch t := value.(type) {
+	case []byte:
+		v = string(t)
+	default:
+		v = t
+	}
+	if s, ok := v.(string); ok && f.CallingType == JSON_CALLING && s != "" {
+		if err = json.Unmarshal([]byte(s), &v); err != nil {
+			err = fmt.Errorf("invalid %s for %s: %v", what, f.Name, err)
+			return
+		}
+	}
+	if err = validator.Validate(v); err != nil {
+		err = fmt.Errorf("invalid %s for %s: %v", what, f.Name, err)
+	}
+	return
+}
+
+// ValidateInput checks a function's arguments against its input schema if it has one
+func (f *FunctionDef) ValidateInput(args interface{}) error {
+	return f.validateSchema(f.InputSchema, "input", args)
+}
+
+// ValidateOutput checks a function's result against its output schema if it has one
+func (f *FunctionDef) ValidateOutput(result interface{}) error {
+	return f.validateSchema(f.OutputSchema, "output", result)
 }
 
 // ValidExposure verifies that the function can be called in the given context
@@ -93,6 +349,9 @@ func RegisterRibosome(name string, factory RibosomeFactory) {
 func RegisterBultinRibosomes() {
 	RegisterRibosome(ZygoRibosomeType, NewZygoRibosome)
 	RegisterRibosome(JSRibosomeType, NewJSRibosome)
+	RegisterRibosome(WasmRibosomeType, NewWasmRibosome)
+	RegisterRibosome(GoRibosomeType, NewGoRibosome)
+	RegisterRibosome(ESRibosomeType, NewESRibosome)
 }
 
 // CreateRibosome returns a new Ribosome of the given type
@@ -112,3 +371,654 @@ func CreateRibosome(h *Holochain, zome *Zome) (Ribosome, error) {
 
 	return factory(h, zome)
 }
+
+// getRespContent returns the entry content of a get response in the form passed to
+// ribosomes, i.e. chunked entries are reassembled and binary formats are converted
+// with EntryDef.ContentString
+func getRespContent(h *Holochain, resp GetResp) (content interface{}, err error) {
+	content = resp.Entry.Content()
+	entry := &resp.Entry
+	entryType := resp.EntryType
+	if m, ok := content.(ChunkManifest); ok {
+		// chunked entries get reassembled
+		var b []byte
+		b, err = h.GetChunked(&m)
+		if err != nil {
+			return
+		}
+		entry = &GobEntry{C: b}
+		entryType = m.EntryType
+		content = b
+	}
+	if _, ok := content.([]byte); !ok {
+		return
+	}
+	var def *EntryDef
+	_, def, err = h.GetEntryDef(entryType)
+	if err != nil {
+		return
+	}
+	if def.DataFormat == DataFormatBytes || def.DataFormat == DataFormatCBOR {
+		content, err = def.ContentString(entry)
+	}
+	return
+}
+
+// jsonHostFn is the go side of a host API function, it receives the decoded JSON arguments
+// and returns a value to be encoded as the JSON result
+type jsonHostFn func(args []interface{}) (interface{}, error)
+
+// jsonEntryValue returns the value of an entry as it is passed to app code as JSON, JSON
+// formats are passed as JSON and everything else as a string
+func jsonEntryValue(def *EntryDef, entry Entry) (value interface{}, err error) {
+	if def.DataFormat == DataFormatSysAgent {
+		value = entry.Content()
+		return
+	}
+	var s string
+	s, err = def.ContentString(entry)
+	if err != nil {
+		return
+	}
+	switch def.DataFormat {
+	case DataFormatCBOR:
+		fallthrough
+	case DataFormatLinks:
+		fallthrough
+	case DataFormatJSON:
+		value = json.RawMessage(s)
+	default:
+		value = s
+	}
+	return
+}
+
+// jsonHeader returns the header fields passed to validation functions
+func jsonHeader(header *Header) map[string]string {
+	if header == nil {
+		return map[string]string{"EntryLink": "", "Type": "", "Time": ""}
+	}
+	return map[string]string{
+		"EntryLink": header.EntryLink.String(),
+		"Type":      header.Type,
+		"Time":      header.Time.UTC().Format(time.RFC3339),
+	}
+}
+
+// prepareJSONValidateArgs returns the arguments passed to a validation function
+func prepareJSONValidateArgs(action Action, def *EntryDef) (args []interface{}, err error) {
+	var entry interface{}
+	switch t := action.(type) {
+	case *ActionPut:
+		entry, err = jsonEntryValue(def, t.entry)
+		args = []interface{}{entry, jsonHeader(t.header)}
+	case *ActionCommit:
+		entry, err = jsonEntryValue(def, t.entry)
+		args = []interface{}{entry, jsonHeader(t.header)}
+	case *ActionMod:
+		entry, err = jsonEntryValue(def, t.entry)
+		args = []interface{}{entry, jsonHeader(t.header), t.replaces.String()}
+	case *ActionDel:
+		args = []interface{}{t.entry.Hash.String()}
+	case *ActionLink:
+		args = []interface{}{t.validationBase.String(), t.links}
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+	}
+	return
+}
+
+// processJSONArgs processes the decoded JSON arguments according to the args spec filling
+// args[].value with the converted value
+func processJSONArgs(h *Holochain, args []Arg, jArgs []interface{}) (err error) {
+	err = checkArgCount(args, len(jArgs))
+	if err != nil {
+		return err
+	}
+
+	for i, arg := range jArgs {
+		switch args[i].Type {
+		case StringArg:
+			str, ok := arg.(string)
+			if !ok {
+				return argErr("string", i+1, args[i])
+			}
+			args[i].value = str
+		case HashArg:
+			str, ok := arg.(string)
+			if !ok {
+				return argErr("string", i+1, args[i])
+			}
+			var hash Hash
+			hash, err = NewHash(str)
+			if err != nil {
+				return
+			}
+			args[i].value = hash
+		case IntArg:
+			integer, ok := arg.(float64)
+			if !ok {
+				return argErr("int", i+1, args[i])
+			}
+			args[i].value = int64(integer)
+		case BoolArg:
+			boolean, ok := arg.(bool)
+			if !ok {
+				return argErr("boolean", i+1, args[i])
+			}
+			args[i].value = boolean
+		case ArgsArg:
+			switch t := arg.(type) {
+			case string:
+				args[i].value = t
+			case map[string]interface{}:
+				var j []byte
+				j, err = json.Marshal(t)
+				if err != nil {
+					return
+				}
+				args[i].value = string(j)
+			default:
+				return argErr("string or object", i+1, args[i])
+			}
+		case EntryArg:
+			// this a special case in that all EntryArgs must be preceeded by
+			// string arg that specifies the entry type
+			entryType, ok := jArgs[i-1].(string)
+			if !ok {
+				return argErr("string", i, args[i-1])
+			}
+			var def *EntryDef
+			_, def, err = h.GetEntryDef(entryType)
+			if err != nil {
+				return
+			}
+			var entry string
+			switch def.DataFormat {
+			case DataFormatRawJS:
+				fallthrough
+			case DataFormatRawZygo:
+				fallthrough
+			case DataFormatBytes:
+				fallthrough
+			case DataFormatString:
+				entry, ok = arg.(string)
+				if !ok {
+					return argErr("string", i+1, args[i])
+				}
+			case DataFormatCBOR:
+				fallthrough
+			case DataFormatLinks:
+				if _, ok = arg.(map[string]interface{}); !ok {
+					return argErr("object", i+1, args[i])
+				}
+				fallthrough
+			case DataFormatJSON:
+				var j []byte
+				j, err = json.Marshal(arg)
+				if err != nil {
+					return
+				}
+				entry = string(j)
+			default:
+				err = errors.New("data format not implemented: " + def.DataFormat)
+				return
+			}
+			args[i].value, err = def.ContentFromString(entry)
+			if err != nil {
+				return
+			}
+		case MapArg:
+			m, ok := arg.(map[string]interface{})
+			if !ok {
+				return argErr("object", i+1, args[i])
+			}
+			args[i].value = m
+		case ToStrArg:
+			if str, ok := arg.(string); ok {
+				args[i].value = str
+			} else {
+				var j []byte
+				j, err = json.Marshal(arg)
+				if err != nil {
+					return
+				}
+				args[i].value = string(j)
+			}
+		}
+	}
+	return
+}
+
+// jsonGetOptions converts get options passed from app code
+func jsonGetOptions(opts map[string]interface{}) (options GetOptions, err error) {
+	options = GetOptions{StatusMask: StatusDefault}
+	if mask, ok := opts["StatusMask"]; ok {
+		maskval, ok := numInterfaceToInt(mask)
+		if !ok {
+			err = fmt.Errorf("expecting int StatusMask attribute, got %T", mask)
+			return
+		}
+		options.StatusMask = maskval
+	}
+	if mask, ok := opts["GetMask"]; ok {
+		maskval, ok := numInterfaceToInt(mask)
+		if !ok {
+			err = fmt.Errorf("expecting int GetMask attribute, got %T", mask)
+			return
+		}
+		options.GetMask = maskval
+	}
+	if local, ok := opts["Local"]; ok {
+		options.Local, _ = local.(bool)
+	}
+	return
+}
+
+// jsonHostFns builds the host API functions that take and return JSON values.  They are
+// imported by wasm modules and wrapped by the es ribosome.
+func jsonHostFns(h *Holochain, zome *Zome) map[string]jsonHostFn {
+	hashResult := func(r interface{}) string {
+		var hash Hash
+		if r != nil {
+			hash = r.(Hash)
+		}
+		return hash.String()
+	}
+
+	return map[string]jsonHostFn{
+		"property": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionProperty{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.prop = args[0].value.(string)
+			result, err = a.Do(h)
+			return
+		},
+		"debug": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionDebug{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.msg = args[0].value.(string)
+			a.Do(h)
+			return
+		},
+		"makeHash": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionMakeHash{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.entryType = args[0].value.(string)
+			a.entry = &GobEntry{C: args[1].value}
+			var r interface{}
+			r, err = a.Do(h)
+			if err == nil {
+				result = hashResult(r)
+			}
+			return
+		},
+		"commit": func(jArgs []interface{}) (result interface{}, err error) {
+			args := (&ActionCommit{}).Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			var r interface{}
+			r, err = NewCommitAction(args[0].value.(string), &GobEntry{C: args[1].value}).Do(h)
+			if err == nil {
+				result = hashResult(r)
+			}
+			return
+		},
+		"update": func(jArgs []interface{}) (result interface{}, err error) {
+			args := (&ActionMod{}).Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			var r interface{}
+			r, err = NewModAction(args[0].value.(string), &GobEntry{C: args[1].value}, args[2].value.(Hash)).Do(h)
+			if err == nil {
+				result = hashResult(r)
+			}
+			return
+		},
+		"updateAgent": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionModAgent{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			opts := args[0].value.(map[string]interface{})
+			if id, ok := opts["Identity"].(string); ok {
+				a.Identity = AgentIdentity(id)
+			}
+			if rev, ok := opts["Revocation"].(string); ok {
+				a.Revocation = rev
+			}
+			var r interface{}
+			r, err = a.Do(h)
+			if err == nil {
+				result = hashResult(r)
+			}
+			return
+		},
+		"remove": func(jArgs []interface{}) (result interface{}, err error) {
+			args := (&ActionDel{}).Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			entry := DelEntry{
+				Hash:    args[0].value.(Hash),
+				Message: args[1].value.(string),
+			}
+			var header *Header
+			header, err = h.chain.GetEntryHeader(entry.Hash)
+			if err != nil {
+				return
+			}
+			var r interface{}
+			r, err = NewDelAction(header.Type, entry).Do(h)
+			if err == nil {
+				result = hashResult(r)
+			}
+			return
+		},
+		"get": func(jArgs []interface{}) (result interface{}, err error) {
+			args := (&ActionGet{}).Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			options := GetOptions{StatusMask: StatusDefault}
+			if len(jArgs) == 2 {
+				options, err = jsonGetOptions(args[1].value.(map[string]interface{}))
+				if err != nil {
+					return
+				}
+			}
+			req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
+			var r interface{}
+			r, err = NewGetAction(req, &options).Do(h)
+			if err != nil {
+				return
+			}
+			getResp := r.(GetResp)
+			var content interface{}
+			content, err = getRespContent(h, getResp)
+			if err != nil {
+				return
+			}
+			mask := options.GetMask
+			if mask == GetMaskDefault {
+				mask = GetMaskEntry
+			}
+			switch mask {
+			case GetMaskEntry:
+				result = content
+			case GetMaskEntryType:
+				result = getResp.EntryType
+			case GetMaskSources:
+				result = getResp.Sources
+			default:
+				respObj := make(map[string]interface{})
+				if mask&GetMaskEntry != 0 {
+					respObj["Entry"] = content
+				}
+				if mask&GetMaskEntryType != 0 {
+					respObj["EntryType"] = getResp.EntryType
+				}
+				if mask&GetMaskSources != 0 {
+					respObj["Sources"] = getResp.Sources
+				}
+				result = respObj
+			}
+			return
+		},
+		"getLinks": func(jArgs []interface{}) (result interface{}, err error) {
+			args := (&ActionGetLinks{}).Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			base := args[0].value.(Hash)
+			tag := args[1].value.(string)
+			options := GetLinksOptions{Load: false, StatusMask: StatusLive}
+			if len(jArgs) == 3 {
+				opts := args[2].value.(map[string]interface{})
+				if load, ok := opts["Load"]; ok {
+					loadval, ok := load.(bool)
+					if !ok {
+						err = fmt.Errorf("expecting boolean Load attribute in object, got %T", load)
+						return
+					}
+					options.Load = loadval
+				}
+				if mask, ok := opts["StatusMask"]; ok {
+					maskval, ok := numInterfaceToInt(mask)
+					if !ok {
+						err = fmt.Errorf("expecting int StatusMask attribute in object, got %T", mask)
+						return
+					}
+					options.StatusMask = maskval
+				}
+			}
+			var r interface{}
+			r, err = NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: options.StatusMask}, &options).Do(h)
+			if err != nil {
+				return
+			}
+			links := make([]map[string]interface{}, 0)
+			for _, th := range r.(*LinkQueryResp).Links {
+				l := map[string]interface{}{"Hash": th.H}
+				if tag == "" {
+					l["Tag"] = th.T
+				}
+				if options.Load {
+					l["EntryType"] = th.EntryType
+					l["Source"] = th.Source
+					var def *EntryDef
+					_, def, err = h.GetEntryDef(th.EntryType)
+					if err != nil {
+						return
+					}
+					switch def.DataFormat {
+					case DataFormatSysAgent:
+						fallthrough
+					case DataFormatCBOR:
+						fallthrough
+					case DataFormatLinks:
+						fallthrough
+					case DataFormatJSON:
+						l["Entry"] = json.RawMessage(th.E)
+					default:
+						l["Entry"] = th.E
+					}
+				}
+				links = append(links, l)
+			}
+			result = links
+			return
+		},
+		"query": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionQuery{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			options := QueryOptions{}
+			if len(jArgs) == 1 {
+				var j []byte
+				j, err = json.Marshal(args[0].value)
+				if err != nil {
+					return
+				}
+				err = json.Unmarshal(j, &options)
+				if err != nil {
+					return
+				}
+			}
+			a.options = &options
+			var r interface{}
+			r, err = a.Do(h)
+			if err != nil {
+				return
+			}
+			defs := make(map[string]*EntryDef)
+			results := make([]interface{}, 0)
+			for _, qr := range r.([]QueryResult) {
+				item := make(map[string]interface{})
+				if options.Return.Hashes {
+					item["Hash"] = qr.Header.EntryLink.String()
+				}
+				if options.Return.Headers {
+					item["Header"] = map[string]interface{}{
+						"Type":       qr.Header.Type,
+						"Time":       qr.Header.Time,
+						"EntryLink":  qr.Header.EntryLink.String(),
+						"HeaderLink": qr.Header.HeaderLink.String(),
+						"TypeLink":   qr.Header.TypeLink.String(),
+					}
+				}
+				if options.Return.Entries {
+					def, ok := defs[qr.Header.Type]
+					if !ok {
+						_, def, err = h.GetEntryDef(qr.Header.Type)
+						if err != nil {
+							return
+						}
+						defs[qr.Header.Type] = def
+					}
+					item["Entry"], err = jsonEntryValue(def, qr.Entry)
+					if err != nil {
+						return
+					}
+				}
+				if len(item) == 1 {
+					for _, v := range item {
+						results = append(results, v)
+					}
+				} else {
+					results = append(results, item)
+				}
+			}
+			result = results
+			return
+		},
+		"send": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionSend{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+			if err != nil {
+				return
+			}
+			var j []byte
+			j, err = json.Marshal(args[1].value)
+			if err != nil {
+				return
+			}
+			a.msg.ZomeType = zome.Name
+			a.msg.Body = string(j)
+			if len(jArgs) == 3 {
+				a.options = &SendOptions{}
+				opts := args[2].value.(map[string]interface{})
+				if cbmap, ok := opts["Callback"].(map[string]interface{}); ok {
+					callback := Callback{zomeType: zome.Name}
+					if callback.Function, ok = cbmap["Function"].(string); !ok {
+						err = errors.New("callback option requires Function")
+						return
+					}
+					if callback.ID, ok = cbmap["ID"].(string); !ok {
+						err = errors.New("callback option requires ID")
+						return
+					}
+					a.options.Callback = &callback
+				}
+				if timeout, ok := opts["Timeout"]; ok {
+					a.options.Timeout, _ = numInterfaceToInt(timeout)
+				}
+			}
+			result, err = a.Do(h)
+			return
+		},
+		"call": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionCall{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.zome = args[0].value.(string)
+			a.function = args[1].value.(string)
+			a.args = args[2].value.(string)
+			result, err = a.Do(h)
+			return
+		},
+		"bridge": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionBridge{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.token, a.url, err = h.GetBridgeToken(args[0].value.(Hash))
+			if err != nil {
+				return
+			}
+			a.zome = args[1].value.(string)
+			a.function = args[2].value.(string)
+			a.args = args[3].value.(string)
+			result, err = a.Do(h)
+			return
+		},
+		"getBridges": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionGetBridges{}
+			if err = processJSONArgs(h, a.Args(), jArgs); err != nil {
+				return
+			}
+			var r interface{}
+			r, err = a.Do(h)
+			if err != nil {
+				return
+			}
+			bridges := make([]map[string]interface{}, 0)
+			for _, b := range r.([]Bridge) {
+				if b.Side == BridgeTo {
+					bridges = append(bridges, map[string]interface{}{"Side": b.Side, "Token": b.Token})
+				} else {
+					bridges = append(bridges, map[string]interface{}{"Side": b.Side, "ToApp": b.ToApp.String()})
+				}
+			}
+			result = bridges
+			return
+		},
+		"sign": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionSign{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.doc = []byte(args[0].value.(string))
+			var r interface{}
+			r, err = a.Do(h)
+			if err == nil && r != nil {
+				result = string(r.([]byte))
+			}
+			return
+		},
+		"verifySignature": func(jArgs []interface{}) (result interface{}, err error) {
+			a := &ActionVerifySignature{}
+			args := a.Args()
+			if err = processJSONArgs(h, args, jArgs); err != nil {
+				return
+			}
+			a.signature = args[0].value.(string)
+			a.data = args[1].value.(string)
+			a.pubKey = args[2].value.(string)
+			result, err = a.Do(h)
+			return
+		},
+	}
+}
@@ -1,15 +1,18 @@
 package holochain
 
 import (
+	"errors"
 	"fmt"
+	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
 	"testing"
+	"time"
 )
 
 func TestCreateRibosome(t *testing.T) {
 	Convey("should fail to create a ribosome based from bad ribosome type", t, func() {
 		_, err := CreateRibosome(nil, &Zome{RibosomeType: "foo", Code: "some code"})
-		So(err.Error(), ShouldEqual, "Invalid ribosome name. Must be one of: js, zygo")
+		So(err.Error(), ShouldEqual, "Invalid ribosome name. Must be one of: es, go, js, wasm, zygo")
 	})
 	Convey("should create a ribosome based from a good schema type", t, func() {
 		v, err := CreateRibosome(nil, &Zome{RibosomeType: ZygoRibosomeType, Code: `(+ 1 1)`})
@@ -31,3 +34,57 @@ func TestValidExposure(t *testing.T) {
 		So(fn.ValidExposure(ZOME_EXPOSURE), ShouldBeTrue)
 	})
 }
+
+func TestRunWithTimeout(t *testing.T) {
+	Convey("it should return the result of functions that finish in time", t, func() {
+		var i interrupter
+		r, err := runWithTimeout(100, i.interrupt, func() (interface{}, error) { return 2, nil })
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, 2)
+		So(i.interrupted(), ShouldBeFalse)
+	})
+	Convey("it should give up on and interrupt functions that run too long", t, func() {
+		var i interrupter
+		_, err := runWithTimeout(10, i.interrupt, func() (interface{}, error) {
+			time.Sleep(time.Millisecond * 100)
+			return nil, nil
+		})
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "time", Value: 10})
+		So(i.interrupted(), ShouldBeTrue)
+		So(execErr("foo", err), ShouldEqual, err)
+		So(execErr("foo", errors.New("bar")).Error(), ShouldEqual, "Error executing foo: bar")
+	})
+}
+
+func TestExecLimits(t *testing.T) {
+	Convey("it should use the default limits when none are set", t, func() {
+		So(execLimits(nil), ShouldResemble, DefaultExecLimits())
+		h := &Holochain{}
+		So(execLimits(h), ShouldResemble, DefaultExecLimits())
+		h.Config.ExecLimits = ExecLimits{Timeout: 5}
+		So(execLimits(h), ShouldResemble, ExecLimits{Timeout: 5})
+	})
+}
+
+func TestProcessJSONArgs(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should convert JSON arguments", t, func() {
+		args := []Arg{{Name: "entryType", Type: StringArg}, {Name: "entry", Type: EntryArg}}
+		err := processJSONArgs(h, args, []interface{}{"profile", map[string]interface{}{"firstName": "Eric"}})
+		So(err, ShouldBeNil)
+		So(args[1].value, ShouldEqual, `{"firstName":"Eric"}`)
+
+		err = processJSONArgs(h, args, []interface{}{"oddNumbers", 3.0})
+		So(err.Error(), ShouldEqual, "argument 2 (entry) should be string")
+
+		args = []Arg{{Name: "hash", Type: HashArg}}
+		err = processJSONArgs(h, args, []interface{}{h.nodeIDStr})
+		So(err, ShouldBeNil)
+		So(args[0].value.(Hash).String(), ShouldEqual, h.nodeIDStr)
+
+		err = processJSONArgs(h, args, []interface{}{})
+		So(err, ShouldEqual, ErrWrongNargs)
+	})
+}
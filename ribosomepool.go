@@ -0,0 +1,135 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements per zome pools of ribosome instances so that calls and validation don't have
+// to build a new VM and reload the zome code every time
+
+package holochain
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	DefaultRibosomePoolSize = 4
+
+	// MaxCachedCode is how many compiled zome codes the javascript and es ribosomes each
+	// keep, the least recently used is dropped when another is added
+	MaxCachedCode = 32
+)
+
+// ResettableRibosome is a Ribosome that can be returned to the state it was in just after
+// its zome code was loaded, so that it can be reused without state leaking between calls.
+// Ribosomes that aren't resettable are never pooled.
+type ResettableRibosome interface {
+	Ribosome
+	Reset() error
+}
+
+// ribosomePool holds the idle instances of a zome's ribosome
+type ribosomePool struct {
+	code string // the zome code the instances were made from
+	idle chan Ribosome
+}
+
+// ribosomePools holds a holochain's ribosome pools by zome name
+type ribosomePools struct {
+	lk    sync.Mutex
+	pools map[string]*ribosomePool
+}
+
+// pool returns the pool for a zome, replacing it if the zome code has changed
+func (p *ribosomePools) pool(z *Zome, size int) *ribosomePool {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if p.pools == nil {
+		p.pools = make(map[string]*ribosomePool)
+	}
+	pool, ok := p.pools[z.Name]
+	if !ok || pool.code != z.Code {
+		pool = &ribosomePool{code: z.Code, idle: make(chan Ribosome, size)}
+		p.pools[z.Name] = pool
+	}
+	return pool
+}
+
+// GetRibosome returns an idle ribosome from the zome's pool, or makes a new one if there
+// aren't any.  The returned release function must be called when done with the ribosome to
+// reset it and return it to the pool.
+func (h *Holochain) GetRibosome(zomeName string) (r Ribosome, z *Zome, release func(), err error) {
+	z, err = h.GetZome(zomeName)
+	if err != nil {
+		return
+	}
+	release = func() {}
+	size := h.Config.RibosomePoolSize
+	if size <= 0 {
+		r, err = z.MakeRibosome(h)
+		return
+	}
+	pool := h.ribosomes.pool(z, size)
+	select {
+	case r = <-pool.idle:
+	default:
+		r, err = z.MakeRibosome(h)
+		if err != nil {
+			return
+		}
+	}
+	release = func() {
+		rr, ok := r.(ResettableRibosome)
+		if !ok || h.ribosomes.pool(z, size) != pool {
+			return
+		}
+		if rr.Reset() != nil {
+			return
+		}
+		select {
+		case pool.idle <- r:
+		default:
+			// the pool is full
+		}
+	}
+	return
+}
+
+// cachedCode is a compiled zome code in a codeCache
+type cachedCode struct {
+	code     string
+	compiled interface{}
+}
+
+// codeCache caches compiled zome code so that new VMs don't have to parse it again
+type codeCache struct {
+	sync.Mutex
+	m     map[string]*list.Element
+	order *list.List // most recently used first
+}
+
+func newCodeCache() *codeCache {
+	return &codeCache{m: make(map[string]*list.Element), order: list.New()}
+}
+
+// get returns the compiled form of some zome code, calling compile if it isn't cached
+func (c *codeCache) get(code string, compile func() (interface{}, error)) (compiled interface{}, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.m[code]; ok {
+		c.order.MoveToFront(e)
+		compiled = e.Value.(*cachedCode).compiled
+		return
+	}
+	compiled, err = compile()
+	if err != nil {
+		return
+	}
+	c.m[code] = c.order.PushFront(&cachedCode{code: code, compiled: compiled})
+	for c.order.Len() > MaxCachedCode {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.m, e.Value.(*cachedCode).code)
+	}
+	return
+}
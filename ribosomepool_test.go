@@ -0,0 +1,121 @@
+package holochain
+
+import (
+	"fmt"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestGetRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	zome := &h.nucleus.dna.Zomes[1]
+	zome.Code += "\nvar count=0;function inc() {count++;return count}"
+	zome.Functions = append(zome.Functions, FunctionDef{Name: "inc", CallingType: STRING_CALLING})
+	h.Config.RibosomePoolSize = 1
+
+	Convey("it should reuse released ribosomes", t, func() {
+		r1, z, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(z.Name, ShouldEqual, "jsSampleZome")
+		release()
+		r2, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldPointTo, r1)
+
+		r3, _, release3, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r3, ShouldNotPointTo, r1)
+		release()
+		release3()
+	})
+
+	Convey("it should reset ribosomes between calls", t, func() {
+		for i := 0; i < 3; i++ {
+			result, err := h.Call("jsSampleZome", "inc", "", ZOME_EXPOSURE)
+			So(err, ShouldBeNil)
+			So(result, ShouldEqual, "1")
+		}
+	})
+
+	Convey("it should not reuse ribosomes made from old code", t, func() {
+		r1, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		release()
+		zome.Code += "\ncount=10"
+		r2, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldNotPointTo, r1)
+		release()
+		result, err := h.Call("jsSampleZome", "inc", "", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "11")
+	})
+
+	Convey("it should not pool ribosomes that can't be reset", t, func() {
+		r1, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		release()
+		r2, _, release, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldNotPointTo, r1)
+		release()
+	})
+
+	Convey("a pool size of zero should disable pooling", t, func() {
+		h.Config.RibosomePoolSize = 0
+		r1, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		release()
+		r2, _, release, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2, ShouldNotPointTo, r1)
+		release()
+	})
+}
+
+func TestJSCompileCache(t *testing.T) {
+	vm := otto.New()
+	Convey("it should reuse compiled scripts", t, func() {
+		s1, err := jsCompile(vm, "var cached = 1;")
+		So(err, ShouldBeNil)
+		s2, err := jsCompile(vm, "var cached = 1;")
+		So(err, ShouldBeNil)
+		So(s2, ShouldPointTo, s1)
+	})
+
+	Convey("it should drop the least recently used scripts when full", t, func() {
+		first, _ := jsCompile(vm, "var first = 1;")
+		for i := 0; i < MaxCachedCode; i++ {
+			jsCompile(vm, fmt.Sprintf("var x = %d;", i))
+		}
+		So(len(jsScripts.m), ShouldEqual, MaxCachedCode)
+		So(jsScripts.order.Len(), ShouldEqual, MaxCachedCode)
+		again, err := jsCompile(vm, "var first = 1;")
+		So(err, ShouldBeNil)
+		So(again, ShouldNotPointTo, first)
+	})
+}
+
+func TestESCompileCache(t *testing.T) {
+	Convey("it should reuse compiled programs", t, func() {
+		p1, err := esCompile("var cached = 1;")
+		So(err, ShouldBeNil)
+		p2, err := esCompile("var cached = 1;")
+		So(err, ShouldBeNil)
+		So(p2, ShouldPointTo, p1)
+	})
+
+	Convey("it should drop the least recently used programs when full", t, func() {
+		first, _ := esCompile("var first = 1;")
+		for i := 0; i < MaxCachedCode; i++ {
+			esCompile(fmt.Sprintf("var x = %d;", i))
+		}
+		So(len(esPrograms.m), ShouldEqual, MaxCachedCode)
+		again, err := esCompile("var first = 1;")
+		So(err, ShouldBeNil)
+		So(again, ShouldNotPointTo, first)
+	})
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements calling the zome functions that the DNA schedules to run periodically
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/buntdb"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultScheduleInterval = time.Second // how often the scheduler checks for functions to run
+)
+
+// ScheduledFunction holds the name of a zome function which is called periodically, and
+// the interval between calls in the format of time.ParseDuration, e.g. "10m"
+type ScheduledFunction struct {
+	Function string
+	Interval string
+}
+
+// ParseInterval returns the interval of a scheduled function
+func (s *ScheduledFunction) ParseInterval() (interval time.Duration, err error) {
+	interval, err = time.ParseDuration(s.Interval)
+	if err == nil && interval <= 0 {
+		err = errors.New("interval must be positive")
+	}
+	if err != nil {
+		err = fmt.Errorf("bad interval for scheduled function %s: %v", s.Function, err)
+	}
+	return
+}
+
+// checkSchedule makes sure that a zome only schedules its own functions at valid intervals
+func (zome *Zome) checkSchedule() (err error) {
+	for _, s := range zome.Scheduled {
+		if _, err = zome.GetFunctionDef(s.Function); err != nil {
+			err = fmt.Errorf("scheduled function %s not found in zome %s", s.Function, zome.Name)
+			return
+		}
+		if _, err = s.ParseInterval(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// lastRunKey returns the key under which the last run time of a scheduled function is stored
+func lastRunKey(zomeName string, function string) string {
+	return "lastrun:" + zomeName + ":" + function
+}
+
+// initScheduleDB opens the database of the last run times of scheduled functions
+func (h *Holochain) initScheduleDB() (err error) {
+	if h.scheduleDB == nil {
+		h.scheduleDB, err = buntdb.Open(filepath.Join(h.DBPath(), ScheduleDBFileName))
+	}
+	return
+}
+
+// LastRun returns the time a scheduled function was last called, which is the zero time
+// if it hasn't been
+func (h *Holochain) LastRun(zomeName string, function string) (t time.Time, err error) {
+	if err = h.initScheduleDB(); err != nil {
+		return
+	}
+	err = h.scheduleDB.View(func(tx *buntdb.Tx) error {
+		v, e := tx.Get(lastRunKey(zomeName, function))
+		if e == buntdb.ErrNotFound {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		nanos, e := strconv.ParseInt(v, 10, 64)
+		if e != nil {
+			return e
+		}
+		t = time.Unix(0, nanos)
+		return nil
+	})
+	return
+}
+
+// setLastRun records the time a scheduled function was called
+func (h *Holochain) setLastRun(zomeName string, function string, t time.Time) (err error) {
+	err = h.scheduleDB.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set(lastRunKey(zomeName, function), strconv.FormatInt(t.UnixNano(), 10), nil)
+		return e
+	})
+	return
+}
+
+// scheduledArgs returns the arguments a scheduled function is called with, which is no
+// arguments: an empty string for string calling functions and an empty object for json ones
+func scheduledArgs(zome *Zome, function string) string {
+	fn, err := zome.GetFunctionDef(function)
+	if err == nil && fn.CallingType == JSON_CALLING {
+		return "{}"
+	}
+	return ""
+}
+
+// RunScheduled calls the scheduled functions whose interval has passed since they were last
+// called, or that have never been called.  The last run times are stored so that the
+// schedule carries on across restarts.  Errors from the functions are logged and don't
+// stop the other functions from running.
+func (h *Holochain) RunScheduled(now time.Time) (err error) {
+	if err = h.initScheduleDB(); err != nil {
+		return
+	}
+	for _, z := range h.nucleus.dna.Zomes {
+		for _, s := range z.Scheduled {
+			var interval time.Duration
+			interval, err = s.ParseInterval()
+			if err != nil {
+				return
+			}
+			var last time.Time
+			last, err = h.LastRun(z.Name, s.Function)
+			if err != nil {
+				return
+			}
+			if !last.IsZero() && now.Sub(last) < interval {
+				continue
+			}
+			// the run is recorded first so a failing function isn't retried on every tick
+			if err = h.setLastRun(z.Name, s.Function, now); err != nil {
+				return
+			}
+			Debugf("running scheduled function %s:%s", z.Name, s.Function)
+			_, e := h.Call(z.Name, s.Function, scheduledArgs(&z, s.Function), ZOME_EXPOSURE)
+			if e != nil {
+				h.Config.Loggers.App.Logf("scheduled function %s:%s failed: %v", z.Name, s.Function, e)
+			}
+		}
+	}
+	return
+}
+
+// Schedule starts checking for scheduled functions to run on an interval
+func (h *Holochain) Schedule(interval time.Duration) {
+	h.scheduleLk.Lock()
+	defer h.scheduleLk.Unlock()
+	h.stopScheduling()
+	var stop chan bool
+	stop = Ticker(interval, func() {
+		h.scheduleLk.Lock()
+		defer h.scheduleLk.Unlock()
+		// the scheduler may have been stopped while this tick was waiting for the lock
+		if h.scheduling != stop {
+			return
+		}
+		err := h.RunScheduled(time.Now())
+		if err != nil {
+			h.Config.Loggers.App.Logf("scheduler error: %v", err)
+		}
+	})
+	h.scheduling = stop
+}
+
+// stopScheduling stops the scheduler's ticker, the caller must hold scheduleLk
+func (h *Holochain) stopScheduling() {
+	if h.scheduling != nil {
+		Debug("Stopping scheduler")
+		stop := h.scheduling
+		h.scheduling = nil
+		stop <- true
+	}
+}
+
+// stopSchedule stops the scheduler and closes its database, waiting for any scheduled
+// functions that are running to finish first so they can't reopen it
+func (h *Holochain) stopSchedule() {
+	h.scheduleLk.Lock()
+	defer h.scheduleLk.Unlock()
+	h.stopScheduling()
+	if h.scheduleDB != nil {
+		h.scheduleDB.Close()
+		h.scheduleDB = nil
+	}
+}
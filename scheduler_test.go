@@ -0,0 +1,103 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+var scheduledTicks int
+var scheduledParams string
+
+func init() {
+	RegisterGoZome("scheduleTestZome", &GoZome{
+		Functions: map[string]GoZomeFunction{
+			"tick": func(api *GoAPI, params string) (string, error) {
+				scheduledTicks++
+				return "", nil
+			},
+			"tickJSON": func(api *GoAPI, params string) (string, error) {
+				scheduledParams = params
+				return "{}", nil
+			},
+			"fail": func(api *GoAPI, params string) (string, error) {
+				return "", errors.New("scheduled failure")
+			},
+		},
+	})
+}
+
+func TestCheckSchedule(t *testing.T) {
+	zome := Zome{Name: "z", Functions: []FunctionDef{{Name: "tick"}}}
+	Convey("it should accept scheduled functions of the zome", t, func() {
+		zome.Scheduled = []ScheduledFunction{{Function: "tick", Interval: "1m"}}
+		So(zome.checkSchedule(), ShouldBeNil)
+	})
+	Convey("it should reject unknown functions and bad intervals", t, func() {
+		zome.Scheduled = []ScheduledFunction{{Function: "tock", Interval: "1m"}}
+		So(zome.checkSchedule().Error(), ShouldEqual, "scheduled function tock not found in zome z")
+		zome.Scheduled = []ScheduledFunction{{Function: "tick", Interval: "-1m"}}
+		So(zome.checkSchedule().Error(), ShouldEqual, "bad interval for scheduled function tick: interval must be positive")
+		zome.Scheduled = []ScheduledFunction{{Function: "tick", Interval: "often"}}
+		So(zome.checkSchedule(), ShouldNotBeNil)
+	})
+}
+
+func TestRunScheduled(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h.nucleus.dna.Zomes = append(h.nucleus.dna.Zomes, Zome{
+		Name:         "scheduleZome",
+		RibosomeType: GoRibosomeType,
+		Code:         "scheduleTestZome",
+		Functions: []FunctionDef{
+			{Name: "tick", CallingType: STRING_CALLING},
+			{Name: "tickJSON", CallingType: JSON_CALLING, InputSchema: `{"type":"object"}`},
+			{Name: "fail", CallingType: STRING_CALLING},
+		},
+		Scheduled: []ScheduledFunction{{Function: "fail", Interval: "1m"}, {Function: "tick", Interval: "1m"}, {Function: "tickJSON", Interval: "1m"}},
+	})
+	now := time.Now()
+
+	Convey("it should run functions that have never run and log their errors", t, func() {
+		scheduledTicks = 0
+		ShouldLog(&h.Config.Loggers.App, "scheduled function scheduleZome:fail failed: scheduled failure\n", func() {
+			So(h.RunScheduled(now), ShouldBeNil)
+		})
+		So(scheduledTicks, ShouldEqual, 1)
+		So(scheduledParams, ShouldEqual, "{}")
+		last, err := h.LastRun("scheduleZome", "tick")
+		So(err, ShouldBeNil)
+		So(last.Equal(now), ShouldBeTrue)
+	})
+
+	Convey("it should only run functions again after their interval", t, func() {
+		So(h.RunScheduled(now.Add(30*time.Second)), ShouldBeNil)
+		So(scheduledTicks, ShouldEqual, 1)
+		So(h.RunScheduled(now.Add(time.Minute)), ShouldBeNil)
+		So(scheduledTicks, ShouldEqual, 2)
+	})
+
+	Convey("last run times should persist across restarts", t, func() {
+		h.stopSchedule()
+		last, err := h.LastRun("scheduleZome", "tick")
+		So(err, ShouldBeNil)
+		So(last.Equal(now.Add(time.Minute)), ShouldBeTrue)
+		So(h.RunScheduled(now.Add(90*time.Second)), ShouldBeNil)
+		So(scheduledTicks, ShouldEqual, 2)
+	})
+
+	Convey("stopping the scheduler should leave its database closed", t, func() {
+		h.Schedule(time.Millisecond)
+		So(h.scheduling, ShouldNotBeNil)
+		time.Sleep(time.Millisecond * 10)
+		h.stopSchedule()
+		So(h.scheduling, ShouldBeNil)
+		time.Sleep(time.Millisecond * 10)
+		h.scheduleLk.Lock()
+		So(h.scheduleDB, ShouldBeNil)
+		h.scheduleLk.Unlock()
+	})
+}
@@ -42,11 +42,18 @@ const (
 	DNAHashFileName      string = "dna.hash"    // Filename for storing the hash of the holochain
 	DHTStoreFileName     string = "dht.db"      // Filname for storing the dht
 	BridgeDBFileName     string = "bridge.db"   // Filname for storing bridge keys
+	BSCacheFileName      string = "bs.cache"    // Filename for caching the peers got from a bootstrap server
+	ScheduleDBFileName   string = "schedule.db" // Filename for storing when scheduled functions last ran
+	PeerStoreFileName    string = "peers.db"    // Filename for remembering peers across restarts
+	TableHealthFileName  string = "health.json" // Filename for the last routing table health report
 
 	TestConfigFileName string = "_config.json"
 
 	DefaultPort            = 6283
 	DefaultBootstrapServer = "bootstrap.holochain.net:10000"
+	DefaultExecTimeout     = 10000 // milliseconds
+	DefaultExecStackDepth  = 1000
+	DefaultExecSteps       = 10000000
 
 	HC_BOOTSTRAPSERVER = "HC_BOOTSTRAPSERVER"
 	HC_ENABLEMDNS      = "HC_DEFAULT_ENABLEMDNS"
@@ -89,11 +96,14 @@ type Service struct {
 }
 
 type EntryDefFile struct {
-	Name       string
-	DataFormat string
-	Schema     string
-	SchemaFile string // file name of schema or language schema directive
-	Sharing    string
+	Name          string
+	DataFormat    string
+	Schema        string
+	SchemaFile    string // file name of schema or language schema directive
+	SchemaVersion int
+	ChunkSize     int
+	TTL           int
+	Sharing       string
 }
 
 type ZomeFile struct {
@@ -103,8 +113,9 @@ type ZomeFile struct {
 	Entries      []EntryDefFile
 	RibosomeType string
 	Functions    []FunctionDef
-	BridgeFuncs  []string // functions in zome that can be bridged to by fromApp
-	BridgeTo     string   // dna Hash of toApp that this zome is a client of
+	Scheduled    []ScheduledFunction // functions the app calls periodically
+	BridgeFuncs  []string            // functions in zome that can be bridged to by fromApp
+	BridgeTo     string              // dna Hash of toApp that this zome is a client of
 }
 
 type DNAFile struct {
@@ -118,6 +129,8 @@ type DNAFile struct {
 	RequiresVersion      int
 	DHTConfig            DHTConfig
 	Progenitor           Progenitor
+	Libraries            []string // library files relative to the DNA directory
+	Modules              []string // module files relative to the DNA directory
 }
 
 // TestData holds a test entry for a chain
@@ -343,6 +356,15 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		return
 	}
 
+	dna.Libraries, err = loadLibraries(path, dnaFile.Libraries)
+	if err != nil {
+		return
+	}
+	dna.Modules, err = loadLibraries(path, dnaFile.Modules)
+	if err != nil {
+		return
+	}
+
 	dna.Zomes = make([]Zome, len(dnaFile.Zomes))
 	for i, zome := range dnaFile.Zomes {
 		if zome.CodeFile == "" {
@@ -352,6 +374,12 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 				ext = ".js"
 			case "zygo":
 				ext = ".zy"
+			case "wasm":
+				ext = ".wasm"
+			case "go":
+				ext = ".gozome"
+			case "es":
+				ext = ".es"
 			}
 			dnaFile.Zomes[i].CodeFile = zome.Name + ext
 		}
@@ -366,7 +394,27 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		dna.Zomes[i].Description = zome.Description
 		dna.Zomes[i].RibosomeType = zome.RibosomeType
 		dna.Zomes[i].Functions = zome.Functions
+		for j, fn := range zome.Functions {
+			if fn.InputSchema == "" && fn.InputSchemaFile != "" {
+				var schema []byte
+				if schema, err = ReadFile(zomePath, fn.InputSchemaFile); err != nil {
+					return
+				}
+				dna.Zomes[i].Functions[j].InputSchema = string(schema)
+			}
+			if fn.OutputSchema == "" && fn.OutputSchemaFile != "" {
+				var schema []byte
+				if schema, err = ReadFile(zomePath, fn.OutputSchemaFile); err != nil {
+					return
+				}
+				dna.Zomes[i].Functions[j].OutputSchema = string(schema)
+			}
+		}
 		dna.Zomes[i].BridgeFuncs = zome.BridgeFuncs
+		dna.Zomes[i].Scheduled = zome.Scheduled
+		if err = dna.Zomes[i].checkSchedule(); err != nil {
+			return
+		}
 		if zome.BridgeTo != "" {
 			dna.Zomes[i].BridgeTo, err = NewHash(zome.BridgeTo)
 			if err != nil {
@@ -397,7 +445,7 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		if err != nil {
 			return
 		}
-		dna.Zomes[i].Code = string(code[:])
+		dna.Zomes[i].SetCode(code)
 
 		dna.Zomes[i].Entries = make([]EntryDef, len(zome.Entries))
 		for j, entry := range zome.Entries {
@@ -405,6 +453,13 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 			dna.Zomes[i].Entries[j].DataFormat = entry.DataFormat
 			dna.Zomes[i].Entries[j].Sharing = entry.Sharing
 			dna.Zomes[i].Entries[j].Schema = entry.Schema
+			dna.Zomes[i].Entries[j].SchemaVersion = entry.SchemaVersion
+			if entry.ChunkSize > 0 && entry.DataFormat != DataFormatBytes {
+				err = fmt.Errorf("entry %s: ChunkSize is only allowed for %s entries", entry.Name, DataFormatBytes)
+				return
+			}
+			dna.Zomes[i].Entries[j].ChunkSize = entry.ChunkSize
+			dna.Zomes[i].Entries[j].TTL = entry.TTL
 			if entry.Schema == "" && entry.SchemaFile != "" {
 				schemaFilePath := filepath.Join(zomePath, entry.SchemaFile)
 				if !FileExists(schemaFilePath) {
@@ -552,6 +607,12 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 		suffix = ".js"
 	case ZygoRibosomeType:
 		suffix = ".zy"
+	case WasmRibosomeType:
+		suffix = ".wasm"
+	case GoRibosomeType:
+		suffix = ".gozome"
+	case ESRibosomeType:
+		suffix = ".es"
 	default:
 	}
 	return
@@ -559,11 +620,16 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 
 func _makeConfig(s *Service) (config Config, err error) {
 	config = Config{
-		Port:            DefaultPort,
-		PeerModeDHTNode: s.Settings.DefaultPeerModeDHTNode,
-		PeerModeAuthor:  s.Settings.DefaultPeerModeAuthor,
-		BootstrapServer: s.Settings.DefaultBootstrapServer,
-		EnableNATUPnP:   s.Settings.DefaultEnableNATUPnP,
+		Port:             DefaultPort,
+		PeerModeDHTNode:  s.Settings.DefaultPeerModeDHTNode,
+		PeerModeAuthor:   s.Settings.DefaultPeerModeAuthor,
+		BootstrapServer:  s.Settings.DefaultBootstrapServer,
+		EnableNATUPnP:    s.Settings.DefaultEnableNATUPnP,
+		ExecLimits:       DefaultExecLimits(),
+		RibosomePoolSize: DefaultRibosomePoolSize,
+		MaxMessageSize:   DefaultMaxMessageSize,
+		MaxPeerRequests:  DefaultMaxPeerRequests,
+		RateLimits:       DefaultRateLimits(),
 		Loggers: Loggers{
 			App:        Logger{Name: "App", Format: "%{color:cyan}%{message}", Enabled: true},
 			DHT:        Logger{Name: "DHT", Format: "%{color:yellow}%{time} DHT: %{message}"},
@@ -588,7 +654,10 @@ func _makeConfig(s *Service) (config Config, err error) {
 		if val == "_" {
 			val = ""
 		}
-		config.BootstrapServer = val
+		// the variable may hold a comma separated list of servers to try in order
+		servers := strings.Split(val, ",")
+		config.BootstrapServer = servers[0]
+		config.BootstrapServers = servers[1:]
 		if val == "" {
 			val = "NO BOOTSTRAP SERVER"
 		}
@@ -887,7 +956,11 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		if err = os.MkdirAll(zpath, os.ModePerm); err != nil {
 			return
 		}
-		if err = WriteFile([]byte(z.Code), zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
+		var code []byte
+		if code, err = z.CodeBytes(); err != nil {
+			return
+		}
+		if err = WriteFile(code, zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
 			return
 		}
 
@@ -896,17 +969,21 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 			CodeFile:     z.CodeFileName(),
 			RibosomeType: z.RibosomeType,
 			Functions:    z.Functions,
+			Scheduled:    z.Scheduled,
 			BridgeFuncs:  z.BridgeFuncs,
 			BridgeTo:     z.BridgeTo.String(),
 		}
 
 		for _, e := range z.Entries {
 			entryDefFile := EntryDefFile{
-				Name:       e.Name,
-				DataFormat: e.DataFormat,
-				Sharing:    e.Sharing,
+				Name:          e.Name,
+				DataFormat:    e.DataFormat,
+				SchemaVersion: e.SchemaVersion,
+				ChunkSize:     e.ChunkSize,
+				TTL:           e.TTL,
+				Sharing:       e.Sharing,
 			}
-			if e.DataFormat == DataFormatJSON && e.Schema != "" {
+			if (e.DataFormat == DataFormatJSON || e.DataFormat == DataFormatCBOR) && e.Schema != "" {
 				entryDefFile.SchemaFile = e.Name + ".json"
 				if err = WriteFile([]byte(e.Schema), zpath, e.Name+".json"); err != nil {
 					return
@@ -924,6 +1001,13 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		}
 	}
 
+	if dnaFile.Libraries, err = saveLibraries(dnaPath, dna.Libraries); err != nil {
+		return
+	}
+	if dnaFile.Modules, err = saveLibraries(dnaPath, dna.Modules); err != nil {
+		return
+	}
+
 	err = Encode(f, encodingFormat, dnaFile)
 	return
 }
@@ -0,0 +1,75 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements listening on more than one transport, so that browser-embedded nodes can
+// connect over WebSockets
+
+package holochain
+
+import (
+	"fmt"
+	ma "github.com/multiformats/go-multiaddr"
+	"strings"
+)
+
+const (
+	TCPTransport       = "tcp"
+	WebSocketTransport = "ws"
+)
+
+// transportOf returns the transport a listen address is for, e.g. "ws" for
+// /ip4/0.0.0.0/tcp/6284/ws
+func transportOf(addr ma.Multiaddr) (transport string, err error) {
+	protos := addr.Protocols()
+	if len(protos) != 3 || (protos[0].Name != "ip4" && protos[0].Name != "ip6") {
+		err = fmt.Errorf("unsupported listen address: %s", addr)
+		return
+	}
+	switch protos[1].Name + "/" + protos[2].Name {
+	case "tcp/ws":
+		transport = WebSocketTransport
+	default:
+		err = fmt.Errorf("unsupported listen address: %s", addr)
+	}
+	return
+}
+
+// parseListenAddrs parses the addresses a node listens on.  The first is its primary
+// address, which must be plain TCP, and the rest may use any of the other transports.
+func parseListenAddrs(addrs []string) (parsed []ma.Multiaddr, err error) {
+	if len(addrs) == 0 {
+		err = fmt.Errorf("no listen address")
+		return
+	}
+	for i, s := range addrs {
+		var addr ma.Multiaddr
+		addr, err = ma.NewMultiaddr(s)
+		if err != nil {
+			return
+		}
+		if i == 0 {
+			protos := addr.Protocols()
+			if len(protos) != 2 || protos[1].Name != TCPTransport {
+				err = fmt.Errorf("primary listen address must be TCP: %s", addr)
+				return
+			}
+		} else if _, err = transportOf(addr); err != nil {
+			return
+		}
+		parsed = append(parsed, addr)
+	}
+	return
+}
+
+// listenAddrs returns the addresses a node should listen on: TCP on the configured port
+// followed by any other ListenAddrs
+func (config *Config) listenAddrs(ip string) (addrs []string) {
+	addrs = append(addrs, fmt.Sprintf("/ip4/%s/tcp/%d", ip, config.Port))
+	for _, addr := range config.ListenAddrs {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return
+}
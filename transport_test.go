@@ -0,0 +1,69 @@
+package holochain
+
+import (
+	"context"
+	net "github.com/libp2p/go-libp2p-net"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseListenAddrs(t *testing.T) {
+	Convey("it should know the transport of each listen address", t, func() {
+		addrs, err := parseListenAddrs([]string{"/ip4/0.0.0.0/tcp/6283", "/ip4/0.0.0.0/tcp/6284/ws", "/ip6/::/tcp/6285/ws"})
+		So(err, ShouldBeNil)
+		So(len(addrs), ShouldEqual, 3)
+		transport, _ := transportOf(addrs[1])
+		So(transport, ShouldEqual, WebSocketTransport)
+		transport, _ = transportOf(addrs[2])
+		So(transport, ShouldEqual, WebSocketTransport)
+	})
+
+	Convey("it should require a primary TCP address", t, func() {
+		_, err := parseListenAddrs(nil)
+		So(err.Error(), ShouldEqual, "no listen address")
+		_, err = parseListenAddrs([]string{"/ip4/0.0.0.0/tcp/6284/ws"})
+		So(err.Error(), ShouldEqual, "primary listen address must be TCP: /ip4/0.0.0.0/tcp/6284/ws")
+	})
+
+	Convey("it should refuse addresses of unsupported transports", t, func() {
+		_, err := parseListenAddrs([]string{"/ip4/0.0.0.0/tcp/6283", "/ip4/0.0.0.0/udp/6283"})
+		So(err.Error(), ShouldEqual, "unsupported listen address: /ip4/0.0.0.0/udp/6283")
+		_, err = parseListenAddrs([]string{"/ip4/0.0.0.0/tcp/6283", "/ip4/0.0.0.0/udp/6283/quic"})
+		So(err.Error(), ShouldEqual, "unsupported listen address: /ip4/0.0.0.0/udp/6283/quic")
+	})
+
+	Convey("it should listen on the configured port and any other addresses", t, func() {
+		config := Config{Port: 6283, ListenAddrs: []string{"/ip4/0.0.0.0/tcp/6284/ws", " "}}
+		So(config.listenAddrs("0.0.0.0"), ShouldResemble, []string{"/ip4/0.0.0.0/tcp/6283", "/ip4/0.0.0.0/tcp/6284/ws"})
+	})
+}
+
+func TestTransports(t *testing.T) {
+	_, key := makePeer("multi")
+	agent := LibP2PAgent{identity: "multi", priv: key, pub: key.GetPublic()}
+	listenAddrs := []string{"/ip4/127.0.0.1/tcp/1240", "/ip4/127.0.0.1/tcp/1241/ws"}
+	node, err := NewNode(listenAddrs, "fakednahash", &agent, false)
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+
+	Convey("it should report an external address for each transport", t, func() {
+		var addrs []string
+		for _, addr := range node.ExternalAddr() {
+			addrs = append(addrs, addr.String())
+		}
+		So(addrs, ShouldResemble, listenAddrs)
+	})
+
+	Convey("other nodes should be able to connect over WebSockets", t, func() {
+		other, err := makeNode(1242, "other")
+		So(err, ShouldBeNil)
+		defer other.Close()
+		err = other.host.Connect(context.Background(), pstore.PeerInfo{ID: node.HashAddr, Addrs: []ma.Multiaddr{node.ListenAddrs[1]}})
+		So(err, ShouldBeNil)
+		So(other.host.Network().Connectedness(node.HashAddr), ShouldEqual, net.Connected)
+	})
+}
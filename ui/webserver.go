@@ -8,7 +8,7 @@ package ui
 
 import (
 	"context"
-	_ "encoding/json"
+	"encoding/json"
 	"errors"
 	"fmt"
 	websocket "github.com/gorilla/websocket"
@@ -28,6 +28,15 @@ type WebServer struct {
 	server *http.Server
 }
 
+// fnDescription describes an exposed zome function so UIs and bridge callers can generate clients
+type fnDescription struct {
+	Name         string
+	CallingType  string
+	Exposure     string
+	InputSchema  json.RawMessage `json:",omitempty"`
+	OutputSchema json.RawMessage `json:",omitempty"`
+}
+
 func NewWebServer(h *holo.Holochain, port string) *WebServer {
 	w := WebServer{h: h, port: port}
 	w.log = holo.Logger{Format: "%{color:magenta}%{message}"}
@@ -186,6 +195,35 @@ func (ws *WebServer) Start() {
 		}
 	})
 
+	mux.HandleFunc("/_describe/", func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Split(strings.TrimSuffix(r.URL.Path, "/"), "/")
+		var zomeName string
+		if len(path) == 3 {
+			zomeName = path[2]
+		} else if len(path) != 2 {
+			http.Error(w, "bad request", 400)
+			return
+		}
+		// bridge callers call functions in the zome exposure context, so they can ask to
+		// have those described too
+		exposure := holo.PUBLIC_EXPOSURE
+		switch r.URL.Query().Get("exposure") {
+		case "", "public":
+		case "zome":
+			exposure = holo.ZOME_EXPOSURE
+		default:
+			http.Error(w, "bad exposure", 400)
+			return
+		}
+		desc, err := ws.describe(zomeName, exposure)
+		if err != nil {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(desc)
+	})
+
 	// set router
 	ws.log.Logf("Starting server on localhost:%s\n", ws.port)
 
@@ -204,6 +242,37 @@ func (ws *WebServer) Start() {
 	}()
 }
 
+// describe returns the functions of a zome that can be called in the exposure context,
+// or those of all zomes if zomeName is empty, keyed by zome name
+func (ws *WebServer) describe(zomeName string, exposure string) (desc map[string][]fnDescription, err error) {
+	desc = make(map[string][]fnDescription)
+	for _, zome := range ws.h.Nucleus().DNA().Zomes {
+		if zomeName != "" && zome.Name != zomeName {
+			continue
+		}
+		fns := []fnDescription{}
+		for _, fn := range zome.Functions {
+			if !fn.ValidExposure(exposure) {
+				continue
+			}
+			d := fnDescription{Name: fn.Name, CallingType: fn.CallingType, Exposure: fn.Exposure}
+			if fn.InputSchema != "" {
+				d.InputSchema = json.RawMessage(fn.InputSchema)
+			}
+			if fn.OutputSchema != "" {
+				d.OutputSchema = json.RawMessage(fn.OutputSchema)
+			}
+			fns = append(fns, d)
+		}
+		desc[zome.Name] = fns
+	}
+	if zomeName != "" && len(desc) == 0 {
+		err = errors.New("unknown zome: " + zomeName)
+		desc = nil
+	}
+	return
+}
+
 // Stop sends a message through the stop channel to unblock
 func (ws *WebServer) Stop() {
 	ws.stop <- true
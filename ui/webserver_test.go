@@ -2,6 +2,7 @@ package ui
 
 import (
 	"bytes"
+	"encoding/json"
 	. "github.com/metacurrency/holochain"
 	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
@@ -79,6 +80,49 @@ func TestWebServer(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(string(b), ShouldEqual, "en")
 	})
+
+	Convey("it should describe the exposed functions", t, func() {
+		zome, _ := h.GetZome("jsSampleZome")
+		for i := range zome.Functions {
+			if zome.Functions[i].Name == "addProfile" {
+				zome.Functions[i].InputSchema = `{"type":"object"}`
+			}
+		}
+		resp, err := http.Get("http://0.0.0.0:31415/_describe/jsSampleZome")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		var desc map[string][]map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&desc)
+		So(err, ShouldBeNil)
+		fns := desc["jsSampleZome"]
+		So(len(fns), ShouldEqual, 3)
+		So(fns[0]["Name"], ShouldEqual, "getProperty")
+		So(fns[0]["InputSchema"], ShouldBeNil)
+		So(fns[2]["Name"], ShouldEqual, "addProfile")
+		So(fns[2]["CallingType"], ShouldEqual, "json")
+		So(fns[2]["InputSchema"], ShouldResemble, map[string]interface{}{"type": "object"})
+
+		resp, err = http.Get("http://0.0.0.0:31415/_describe/jsSampleZome?exposure=zome")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		err = json.NewDecoder(resp.Body).Decode(&desc)
+		So(err, ShouldBeNil)
+		fns = desc["jsSampleZome"]
+		So(len(fns), ShouldEqual, 7)
+		So(fns[2]["Exposure"], ShouldEqual, "public")
+		So(fns[3]["Name"], ShouldEqual, "testStrFn1")
+		So(fns[3]["Exposure"], ShouldEqual, "")
+
+		resp, err = http.Get("http://0.0.0.0:31415/_describe/jsSampleZome?exposure=bogus")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+
+		resp, err = http.Get("http://0.0.0.0:31415/_describe/bogus")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 404)
+	})
 	ws.Stop()
 	ws.Wait()
 }
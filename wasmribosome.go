@@ -0,0 +1,620 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// WasmRibosome implements a WebAssembly use of the Ribosome interface
+//
+// The zome's code file is a compiled WebAssembly module which is run by a pure-Go
+// interpreter.  Values cross the module boundary as JSON text in the module's linear
+// memory:
+//
+// The module must export its "memory" and an "alloc(size i32) i32" function which the
+// host uses to get space for the JSON it passes in.  The exported zome functions, receive,
+// the validation callbacks and bridgeGenesis take "(ptr i32, len i32)" of their JSON
+// arguments.  genesis, bridgeGenesis and the validate functions return an i32 which is
+// non-zero on success, the others return an i64 with the pointer to their output in the
+// high 32 bits and its length in the low 32 bits.
+//
+// The host API (commit, get, getLinks, send, query, sign, ...) is imported from the "env"
+// module.  Each host function takes "(ptr i32, len i32)" of a JSON array of its arguments
+// and returns the length of its JSON result, or the negated length of an error message.
+// The module then allocates that much space and calls the "result(ptr i32) i32" import to
+// have the result or error copied there.
+
+package holochain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-interpreter/wagon/disasm"
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+	ops "github.com/go-interpreter/wagon/wasm/operators"
+	. "github.com/metacurrency/holochain/hash"
+	"math"
+	"reflect"
+	"strings"
+)
+
+const (
+	WasmRibosomeType = "wasm"
+
+	// WasmHostModule is the name of the module the host API is imported from
+	WasmHostModule = "env"
+)
+
+var ErrWasmBadPointer = errors.New("wasm pointer out of bounds")
+
+// WasmRibosome holds data needed for the WebAssembly VM
+type WasmRibosome struct {
+	validationContext
+	interrupter
+	h          *Holochain
+	zome       *Zome
+	module     *wasm.Module
+	vm         *exec.VM
+	proc       *exec.Process // used to terminate the vm
+	result     []byte        // the pending result of the last host function call
+	lastResult interface{}
+	exceeded   error // the limit a host function call found the module had exceeded
+	metered    bool  // true if the module was instrumented by wasmMeter
+	setSteps   int64 // the function added by wasmMeter which sets the steps left
+	getSteps   int64 // the function added by wasmMeter which returns the steps left
+}
+
+// Type returns the string value under which this ribosome is registered
+func (wr *WasmRibosome) Type() string { return WasmRibosomeType }
+
+// export returns the function index of an exported function
+func (wr *WasmRibosome) export(fnName string) (index int64, err error) {
+	e, ok := wr.module.Export.Entries[fnName]
+	if !ok || e.Kind != wasm.ExternalFunction {
+		err = fmt.Errorf("wasm module doesn't export function: %s", fnName)
+		return
+	}
+	index = int64(e.Index)
+	return
+}
+
+// exec calls an exported function
+func (wr *WasmRibosome) exec(fnName string, args ...uint64) (result interface{}, err error) {
+	var index int64
+	index, err = wr.export(fnName)
+	if err != nil {
+		return
+	}
+	if wr.interrupted() {
+		err = ErrRibosomeAbandoned
+		return
+	}
+	limits := execLimits(wr.h)
+	if wr.metered {
+		steps := uint64(limits.Steps)
+		if limits.Steps <= 0 {
+			steps = math.MaxUint64
+		}
+		_, err = wr.vm.ExecCode(wr.setSteps, steps)
+		if err != nil {
+			return
+		}
+	}
+	result, err = runWithTimeout(limits.Timeout, wr.stop, func() (interface{}, error) {
+		return wr.vm.ExecCode(index, args...)
+	})
+	if _, ok := err.(*ExecLimitErr); !ok {
+		if wr.exceeded != nil {
+			result, err = nil, wr.exceeded
+		} else if err != nil && wr.metered && wr.stepsLeft() == 0 {
+			result, err = nil, &ExecLimitErr{Limit: "steps", Value: limits.Steps}
+		} else if err == nil && limits.Memory > 0 && len(wr.vm.Memory()) > limits.Memory {
+			wr.interrupt()
+			err = &ExecLimitErr{Limit: "memory", Value: limits.Memory}
+		}
+	}
+	if err != nil {
+		err = execErr(fnName, err)
+	}
+	return
+}
+
+// stepsLeft returns how many steps the last call had left
+func (wr *WasmRibosome) stepsLeft() uint64 {
+	left, err := wr.vm.ExecCode(wr.getSteps)
+	if err != nil {
+		return 0
+	}
+	return left.(uint64)
+}
+
+// stop interrupts the module and terminates the vm at its next instruction
+func (wr *WasmRibosome) stop() {
+	wr.interrupt()
+	wr.proc.Terminate()
+}
+
+// checkLimits is called at each host function call, to stop the module if it has been
+// interrupted or has grown past its memory limit
+func (wr *WasmRibosome) checkLimits() (err error) {
+	if limit := execLimits(wr.h).Memory; limit > 0 && !wr.interrupted() && len(wr.vm.Memory()) > limit {
+		wr.exceeded = &ExecLimitErr{Limit: "memory", Value: limit}
+		wr.stop()
+	}
+	if wr.interrupted() {
+		wr.proc.Terminate()
+		err = ErrRibosomeAbandoned
+	}
+	return
+}
+
+// write copies data into memory allocated by the module's alloc function
+func (wr *WasmRibosome) write(data []byte) (ptr uint32, err error) {
+	if len(data) == 0 {
+		return
+	}
+	var r interface{}
+	r, err = wr.exec("alloc", uint64(len(data)))
+	if err != nil {
+		return
+	}
+	ptr, ok := r.(uint32)
+	if !ok {
+		err = fmt.Errorf("alloc should return i32, got: %T", r)
+		return
+	}
+	mem := wr.vm.Memory()
+	if int(ptr)+len(data) > len(mem) {
+		err = ErrWasmBadPointer
+		return
+	}
+	copy(mem[ptr:], data)
+	return
+}
+
+// read copies data out of the module's memory
+func (wr *WasmRibosome) read(ptr uint32, l uint32) (data []byte, err error) {
+	mem := wr.vm.Memory()
+	if int(ptr)+int(l) > len(mem) {
+		err = ErrWasmBadPointer
+		return
+	}
+	data = make([]byte, l)
+	copy(data, mem[ptr:])
+	return
+}
+
+// callJSON passes input to an exported function and returns the output it points to
+func (wr *WasmRibosome) callJSON(fnName string, input []byte) (output []byte, err error) {
+	var ptr uint32
+	ptr, err = wr.write(input)
+	if err != nil {
+		return
+	}
+	var r interface{}
+	r, err = wr.exec(fnName, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return
+	}
+	v, ok := r.(uint64)
+	if !ok {
+		err = fmt.Errorf("%s should return i64, got: %T", fnName, r)
+		return
+	}
+	output, err = wr.read(uint32(v>>32), uint32(v))
+	return
+}
+
+// callBool passes input to an exported function and returns whether it returned non-zero
+func (wr *WasmRibosome) callBool(fnName string, input []byte) (ok bool, err error) {
+	var ptr uint32
+	ptr, err = wr.write(input)
+	if err != nil {
+		return
+	}
+	var r interface{}
+	if input == nil {
+		r, err = wr.exec(fnName)
+	} else {
+		r, err = wr.exec(fnName, uint64(ptr), uint64(len(input)))
+	}
+	if err != nil {
+		return
+	}
+	v, isI32 := r.(uint32)
+	if !isI32 {
+		err = fmt.Errorf("%s should return i32, got: %T", fnName, r)
+		return
+	}
+	ok = v != 0
+	return
+}
+
+func (wr *WasmRibosome) boolFn(fnName string, input []byte) (err error) {
+	var ok bool
+	ok, err = wr.callBool(fnName, input)
+	if err == nil && !ok {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (wr *WasmRibosome) ChainGenesis() (err error) {
+	err = wr.boolFn("genesis", nil)
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (wr *WasmRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	var j []byte
+	j, err = json.Marshal([]interface{}{side, dnaHash.String(), data})
+	if err != nil {
+		return
+	}
+	err = wr.boolFn("bridgeGenesis", j)
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (wr *WasmRibosome) Receive(from string, msg string) (response string, err error) {
+	var j []byte
+	j, err = json.Marshal([]interface{}{from, json.RawMessage(msg)})
+	if err != nil {
+		return
+	}
+	var output []byte
+	output, err = wr.callJSON("receive", j)
+	if err != nil {
+		return
+	}
+	response = string(output)
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (wr *WasmRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	wr.startValidation(action)
+	defer func() {
+		err = wr.endValidation(err)
+		if err != nil {
+			req = nil
+		}
+	}()
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	var j []byte
+	j, err = json.Marshal([]interface{}{def.Name})
+	if err != nil {
+		return
+	}
+	var output []byte
+	output, err = wr.callJSON(fnName, j)
+	if err != nil {
+		return
+	}
+	var v interface{}
+	err = json.Unmarshal(output, &v)
+	if err != nil {
+		return
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		req = PackagingReq(t)
+		// JSON numbers decode as float64 but the packaging flags are expected as int64
+		if f, ok := req[PkgReqChain].(float64); ok {
+			req[PkgReqChain] = int64(f)
+		}
+	case nil:
+	default:
+		err = fmt.Errorf("%s should return null or object, got: %v", fnName, v)
+	}
+	return
+}
+
+// ValidateAction builds the correct validation function based on the action an calls it
+func (wr *WasmRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	wr.startValidation(action)
+	defer func() { err = wr.endValidation(err) }()
+	fnName := "validate" + strings.Title(action.Name())
+	var args []interface{}
+	args, err = prepareJSONValidateArgs(action, def)
+	if err != nil {
+		return
+	}
+	pkgObj := make(map[string]interface{})
+	if pkg != nil && pkg.Chain != nil {
+		pkgObj["Chain"] = pkg.Chain
+	}
+	args = append([]interface{}{def.Name}, args...)
+	args = append(args, pkgObj, sources)
+
+	var j []byte
+	j, err = json.Marshal(args)
+	if err != nil {
+		return
+	}
+	Debugf("%s: %s", fnName, string(j))
+	var ok bool
+	ok, err = wr.callBool(fnName, j)
+	if err == nil && !ok {
+		err = ValidationFailedErr
+	}
+	return
+}
+
+// Call calls an exported function of the module.  Parameters are passed as given for
+// STRING_CALLING and as JSON text for JSON_CALLING, and the output is returned as a string.
+// A module signals an error by trapping.
+func (wr *WasmRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	switch fn.CallingType {
+	case STRING_CALLING:
+	case JSON_CALLING:
+	default:
+		err = errors.New("params type not implemented")
+		return
+	}
+	p, ok := params.(string)
+	if !ok {
+		err = fmt.Errorf("expecting string params, got: %T", params)
+		return
+	}
+	var output []byte
+	output, err = wr.callJSON(fn.Name, []byte(p))
+	if err != nil {
+		return
+	}
+	result = string(output)
+	return
+}
+
+// RunAsyncSendResponse calls the callback function with the response of an asynchronous send
+func (wr *WasmRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	var j []byte
+	j, err = json.Marshal([]interface{}{json.RawMessage(response.Body), callbackID})
+	if err != nil {
+		return
+	}
+	var output []byte
+	output, err = wr.callJSON(callback, j)
+	if err != nil {
+		return
+	}
+	result = string(output)
+	return
+}
+
+// Reset starts a new VM for the module so that no state is kept from previous calls
+func (wr *WasmRibosome) Reset() (err error) {
+	if wr.interrupted() {
+		err = ErrRibosomeAbandoned
+		return
+	}
+	err = wr.newVM()
+	if err != nil {
+		return
+	}
+	wr.result = nil
+	wr.lastResult = nil
+	return
+}
+
+// Run calls the exported function named by code, which must take no arguments
+func (wr *WasmRibosome) Run(code string) (result interface{}, err error) {
+	result, err = wr.exec(code)
+	if err != nil {
+		return
+	}
+	wr.lastResult = result
+	return
+}
+
+// hostFn wraps a host API function as a wasm import
+func (wr *WasmRibosome) hostFn(fn jsonHostFn) func(proc *exec.Process, ptr int32, l int32) int32 {
+	return func(proc *exec.Process, ptr int32, l int32) int32 {
+		var result, b []byte
+		err := wr.checkLimits()
+		if err == nil {
+			err = ErrWasmBadPointer
+			if ptr >= 0 && l >= 0 {
+				b, err = wr.read(uint32(ptr), uint32(l))
+			}
+		}
+		if err == nil {
+			var args []interface{}
+			if l > 0 {
+				err = json.Unmarshal(b, &args)
+			}
+			if err == nil {
+				var v interface{}
+				v, err = fn(args)
+				if err == nil {
+					result, err = json.Marshal(v)
+				}
+			}
+		}
+		if err != nil {
+			wr.result = []byte(err.Error())
+			return -int32(len(wr.result))
+		}
+		wr.result = result
+		return int32(len(result))
+	}
+}
+
+// hostResult copies the pending result of the last host function call into the module's memory
+func (wr *WasmRibosome) hostResult(proc *exec.Process, ptr int32) int32 {
+	if ptr < 0 {
+		return -1
+	}
+	n, err := proc.WriteAt(wr.result, int64(ptr))
+	if err != nil {
+		return -1
+	}
+	wr.result = nil
+	return int32(n)
+}
+
+// hostModule builds the module from which the host API is imported
+func (wr *WasmRibosome) hostModule(fns map[string]jsonHostFn) *wasm.Module {
+	m := wasm.NewModule()
+	m.Types = &wasm.SectionTypes{
+		Entries: []wasm.FunctionSig{
+			{Form: 0, ParamTypes: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}},
+			{Form: 0, ParamTypes: []wasm.ValueType{wasm.ValueTypeI32}, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI32}},
+		},
+	}
+	m.Export = &wasm.SectionExports{Entries: make(map[string]wasm.ExportEntry)}
+	add := func(name string, sig *wasm.FunctionSig, host interface{}) {
+		m.Export.Entries[name] = wasm.ExportEntry{FieldStr: name, Kind: wasm.ExternalFunction, Index: uint32(len(m.FunctionIndexSpace))}
+		m.FunctionIndexSpace = append(m.FunctionIndexSpace, wasm.Function{Sig: sig, Host: reflect.ValueOf(host), Body: &wasm.FunctionBody{}})
+	}
+	for name, fn := range fns {
+		add(name, &m.Types.Entries[0], wr.hostFn(wr.restrict(name, fn)))
+	}
+	add("result", &m.Types.Entries[1], wr.hostResult)
+	return m
+}
+
+// NewWasmRibosome factory function to build a WebAssembly execution environment for a zome
+func NewWasmRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	wr := WasmRibosome{
+		h:    h,
+		zome: zome,
+	}
+
+	code, err := zome.CodeBytes()
+	if err != nil {
+		err = fmt.Errorf("error decoding wasm module: %v", err)
+		return
+	}
+	host := wr.hostModule(jsonHostFns(h, zome))
+	wr.module, err = wasm.ReadModule(bytes.NewReader(code), func(name string) (*wasm.Module, error) {
+		if name != WasmHostModule {
+			return nil, fmt.Errorf("unknown wasm import module: %s", name)
+		}
+		return host, nil
+	})
+	if err != nil {
+		err = fmt.Errorf("error loading wasm module: %v", err)
+		return
+	}
+	if wr.module.Export == nil {
+		err = errors.New("wasm module has no exports")
+		return
+	}
+	if steps := execLimits(h).Steps; steps > 0 {
+		wr.setSteps, wr.getSteps, err = wasmMeter(wr.module, steps)
+		if err != nil {
+			err = fmt.Errorf("error metering wasm module: %v", err)
+			return
+		}
+		wr.metered = true
+	}
+	err = wr.newVM()
+	if err != nil {
+		return
+	}
+	n = &wr
+	return
+}
+
+// newVM creates a vm to run the module, which returns traps as errors instead of panicking
+func (wr *WasmRibosome) newVM() (err error) {
+	defer func() {
+		// the module's start function runs as the vm is created
+		if r := recover(); r != nil {
+			err = fmt.Errorf("error starting wasm module: %v", r)
+		}
+	}()
+	wr.vm, err = exec.NewVM(wr.module)
+	if err != nil {
+		return
+	}
+	wr.vm.RecoverPanic = true
+	wr.proc = exec.NewProcess(wr.vm)
+	return
+}
+
+// wasmOp returns a wasm instruction
+func wasmOp(code byte, immediates ...interface{}) disasm.Instr {
+	op, err := ops.New(code)
+	if err != nil {
+		panic(err)
+	}
+	return disasm.Instr{Op: op, Immediates: immediates}
+}
+
+// wasmMeter instruments a module to count its steps down from a global it adds, which starts
+// with the given number of steps.  Each function, and each iteration of each loop, begins by
+// trapping if no steps are left and otherwise taking one.  Functions to set the steps left and
+// to return them are added after the module's own functions, so none of its indexes change.
+func wasmMeter(m *wasm.Module, steps int) (setSteps int64, getSteps int64, err error) {
+	g := uint32(len(m.GlobalIndexSpace))
+	var init []byte
+	init, err = disasm.Assemble([]disasm.Instr{wasmOp(ops.I64Const, int64(steps)), wasmOp(ops.End)})
+	if err != nil {
+		return
+	}
+	m.GlobalIndexSpace = append(m.GlobalIndexSpace, wasm.GlobalEntry{
+		Type: wasm.GlobalVar{Type: wasm.ValueTypeI64, Mutable: true},
+		Init: init,
+	})
+
+	step := []disasm.Instr{
+		wasmOp(ops.GetGlobal, g),
+		wasmOp(ops.I64Eqz),
+		wasmOp(ops.If, wasm.BlockTypeEmpty),
+		wasmOp(ops.Unreachable),
+		wasmOp(ops.End),
+		wasmOp(ops.GetGlobal, g),
+		wasmOp(ops.I64Const, int64(1)),
+		wasmOp(ops.I64Sub),
+		wasmOp(ops.SetGlobal, g),
+	}
+	for _, fn := range m.FunctionIndexSpace {
+		if fn.IsHost() {
+			continue
+		}
+		var code []disasm.Instr
+		code, err = disasm.Disassemble(fn.Body.Code)
+		if err != nil {
+			return
+		}
+		metered := append([]disasm.Instr{}, step...)
+		for _, instr := range code {
+			metered = append(metered, instr)
+			if instr.Op.Code == ops.Loop {
+				metered = append(metered, step...)
+			}
+		}
+		fn.Body.Code, err = disasm.Assemble(metered)
+		if err != nil {
+			return
+		}
+	}
+
+	// function bodies in a module don't include their final end instruction
+	var set, get []byte
+	set, err = disasm.Assemble([]disasm.Instr{wasmOp(ops.GetLocal, uint32(0)), wasmOp(ops.SetGlobal, g)})
+	if err != nil {
+		return
+	}
+	get, err = disasm.Assemble([]disasm.Instr{wasmOp(ops.GetGlobal, g)})
+	if err != nil {
+		return
+	}
+	setSteps = int64(len(m.FunctionIndexSpace))
+	getSteps = setSteps + 1
+	m.FunctionIndexSpace = append(m.FunctionIndexSpace,
+		wasm.Function{
+			Sig:  &wasm.FunctionSig{Form: 0x60, ParamTypes: []wasm.ValueType{wasm.ValueTypeI64}},
+			Body: &wasm.FunctionBody{Module: m, Code: set},
+		},
+		wasm.Function{
+			Sig:  &wasm.FunctionSig{Form: 0x60, ReturnTypes: []wasm.ValueType{wasm.ValueTypeI64}},
+			Body: &wasm.FunctionBody{Module: m, Code: get},
+		},
+	)
+	return
+}
@@ -0,0 +1,201 @@
+package holochain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// wasmSection builds a module section, all test sections are shorter than 128 bytes
+func wasmSection(id byte, contents ...byte) []byte {
+	return append([]byte{id, byte(len(contents))}, contents...)
+}
+
+func wasmName(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+// wasmTestModule returns a small module that imports commit, exports a bump allocator
+// and some functions to exercise the ribosome, base64 encoded as it is in a zome's code
+func wasmTestModule() string {
+	m := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	m = append(m, wasmSection(1, 0x04,
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, // 0: (i32,i32)->i32
+		0x60, 0x00, 0x01, 0x7f, // 1: ()->i32
+		0x60, 0x01, 0x7f, 0x01, 0x7f, // 2: (i32)->i32
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e, // 3: (i32,i32)->i64
+	)...)
+
+	imports := []byte{0x02}
+	imports = append(append(append(imports, wasmName("env")...), wasmName("commit")...), 0x00, 0x00)
+	imports = append(append(append(imports, wasmName("env")...), wasmName("result")...), 0x00, 0x02)
+	m = append(m, wasmSection(2, imports...)...)
+
+	// alloc, genesis, validateCommit, echo, commitIt, spin
+	m = append(m, wasmSection(3, 0x06, 0x02, 0x01, 0x00, 0x03, 0x03, 0x01)...)
+	m = append(m, wasmSection(5, 0x01, 0x00, 0x01)...)
+	// the heap starts at 2048
+	m = append(m, wasmSection(6, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x10, 0x0b)...)
+
+	exports := []byte{0x07}
+	exports = append(append(exports, wasmName("memory")...), 0x02, 0x00)
+	for i, name := range []string{"alloc", "genesis", "validateCommit", "echo", "commitIt", "spin"} {
+		exports = append(append(exports, wasmName(name)...), 0x00, byte(i+2))
+	}
+	m = append(m, wasmSection(7, exports...)...)
+
+	code := []byte{0x06}
+	for _, body := range [][]byte{
+		// alloc: return the heap pointer and bump it by size
+		{0x00, 0x23, 0x00, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x0b},
+		// genesis and validateCommit: return true
+		{0x00, 0x41, 0x01, 0x0b},
+		{0x00, 0x41, 0x01, 0x0b},
+		// echo: return the input
+		{0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b},
+		// commitIt: pass the input to commit and return its result
+		{0x01, 0x02, 0x7f,
+			0x20, 0x00, 0x20, 0x01, 0x10, 0x00, 0x21, 0x02,
+			0x20, 0x02, 0x10, 0x02, 0x21, 0x03,
+			0x20, 0x03, 0x10, 0x01, 0x1a,
+			0x20, 0x03, 0xad, 0x42, 0x20, 0x86, 0x20, 0x02, 0xad, 0x84, 0x0b},
+		// spin: loop forever
+		{0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x41, 0x00, 0x0b},
+	} {
+		code = append(append(code, byte(len(body))), body...)
+	}
+	m = append(m, wasmSection(10, code...)...)
+	return base64.StdEncoding.EncodeToString(m)
+}
+
+func TestNewWasmRibosome(t *testing.T) {
+	Convey("new should create a ribosome", t, func() {
+		v, err := NewWasmRibosome(nil, &Zome{RibosomeType: WasmRibosomeType, Code: wasmTestModule()})
+		So(err, ShouldBeNil)
+		So(v.Type(), ShouldEqual, WasmRibosomeType)
+		r, err := v.Run("genesis")
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, uint32(1))
+	})
+	Convey("new should fail to create ribosome when code is bad", t, func() {
+		v, err := NewWasmRibosome(nil, &Zome{RibosomeType: WasmRibosomeType, Code: "not wasm"})
+		So(v, ShouldBeNil)
+		So(err, ShouldNotBeNil)
+	})
+	Convey("the module should survive being encoded in the DNA", t, func() {
+		z := Zome{RibosomeType: WasmRibosomeType}
+		module, _ := base64.StdEncoding.DecodeString(wasmTestModule())
+		z.SetCode(module)
+		j, err := json.Marshal(z)
+		So(err, ShouldBeNil)
+		var z2 Zome
+		So(json.Unmarshal(j, &z2), ShouldBeNil)
+		code, err := z2.CodeBytes()
+		So(err, ShouldBeNil)
+		So(code, ShouldResemble, module)
+	})
+	Convey("host functions should refuse bad pointers and lengths from the module", t, func() {
+		v, err := NewWasmRibosome(nil, &Zome{RibosomeType: WasmRibosomeType, Code: wasmTestModule()})
+		So(err, ShouldBeNil)
+		wr := v.(*WasmRibosome)
+		called := false
+		fn := wr.hostFn(func(args []interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})
+		So(fn(nil, 0, -5), ShouldBeLessThan, 0)
+		So(fn(nil, -1, 5), ShouldBeLessThan, 0)
+		So(fn(nil, 0, 1<<30), ShouldBeLessThan, 0)
+		So(called, ShouldBeFalse)
+	})
+	Convey("host functions should refuse to run once the module is interrupted", t, func() {
+		v, err := NewWasmRibosome(nil, &Zome{RibosomeType: WasmRibosomeType, Code: wasmTestModule()})
+		So(err, ShouldBeNil)
+		wr := v.(*WasmRibosome)
+		called := false
+		fn := wr.hostFn(func(args []interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})
+		wr.stop()
+		So(fn(nil, 0, 0), ShouldBeLessThan, 0)
+		So(string(wr.result), ShouldEqual, ErrRibosomeAbandoned.Error())
+		So(called, ShouldBeFalse)
+		_, err = v.Run("genesis")
+		So(err, ShouldEqual, ErrRibosomeAbandoned)
+	})
+	Convey("host functions should stop a module that has grown past its memory limit", t, func() {
+		h := &Holochain{Config: Config{ExecLimits: ExecLimits{Memory: 1024}}}
+		v, err := NewWasmRibosome(h, &Zome{RibosomeType: WasmRibosomeType, Code: wasmTestModule()})
+		So(err, ShouldBeNil)
+		wr := v.(*WasmRibosome)
+		called := false
+		fn := wr.hostFn(func(args []interface{}) (interface{}, error) {
+			called = true
+			return nil, nil
+		})
+		So(fn(nil, 0, 0), ShouldBeLessThan, 0)
+		So(called, ShouldBeFalse)
+		So(wr.exceeded, ShouldResemble, &ExecLimitErr{Limit: "memory", Value: 1024})
+		So(wr.interrupted(), ShouldBeTrue)
+	})
+	Convey("it should stop modules that take too many steps", t, func() {
+		h := &Holochain{Config: Config{ExecLimits: ExecLimits{Steps: 1000}}}
+		v, err := NewWasmRibosome(h, &Zome{RibosomeType: WasmRibosomeType, Code: wasmTestModule()})
+		So(err, ShouldBeNil)
+		_, err = v.Run("spin")
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "steps", Value: 1000})
+		r, err := v.Run("genesis")
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, uint32(1))
+	})
+	Convey("the code file name should have the wasm extension", t, func() {
+		z := Zome{Name: "myZome", RibosomeType: WasmRibosomeType}
+		So(z.CodeFileName(), ShouldEqual, "myZome.wasm")
+	})
+}
+
+func TestWasmExports(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewWasmRibosome(h, &Zome{Name: "wasmZome", RibosomeType: WasmRibosomeType, Code: wasmTestModule()})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should run genesis", t, func() {
+		So(v.ChainGenesis(), ShouldBeNil)
+	})
+
+	Convey("it should call exported functions", t, func() {
+		r, err := v.Call(&FunctionDef{Name: "echo", CallingType: STRING_CALLING}, "hello")
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, "hello")
+
+		r, err = v.Call(&FunctionDef{Name: "missing", CallingType: STRING_CALLING}, "hello")
+		So(err.Error(), ShouldEqual, "wasm module doesn't export function: missing")
+	})
+
+	Convey("it should validate actions", t, func() {
+		_, def, _ := h.GetEntryDef("oddNumbers")
+		a := NewCommitAction("oddNumbers", &GobEntry{C: "3"})
+		a.header = &Header{}
+		So(v.ValidateAction(a, def, nil, []string{h.nodeIDStr}), ShouldBeNil)
+	})
+
+	Convey("it should expose the host API as imports", t, func() {
+		r, err := v.Call(&FunctionDef{Name: "commitIt", CallingType: JSON_CALLING}, `["oddNumbers","7"]`)
+		So(err, ShouldBeNil)
+		var s string
+		So(json.Unmarshal([]byte(r.(string)), &s), ShouldBeNil)
+		hash, err := NewHash(s)
+		So(err, ShouldBeNil)
+		e, entryType, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(entryType, ShouldEqual, "oddNumbers")
+		So(e.Content(), ShouldEqual, "7")
+	})
+}
@@ -0,0 +1,338 @@
+// Copyright (C) 2013-2017, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// implements the language neutral CBOR wire encoding of messages, which is described by
+// WireSchema so that nodes not written in go can interoperate
+
+package holochain
+
+import (
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/metacurrency/holochain/hash"
+	"github.com/ugorji/go/codec"
+	"reflect"
+	"time"
+)
+
+const (
+	GobEncoding  = "gob"  // go specific encoding, kept for compatibility
+	CBOREncoding = "cbor" // language neutral encoding described by WireSchema
+)
+
+// WireEncodings lists the message encodings this node can speak, preferred first
+var WireEncodings = []string{CBOREncoding, GobEncoding}
+
+// WireSchema is the CDDL (RFC 8610) description of messages in the CBOR wire encoding.
+// Each message is sent as a 4 byte big-endian length followed by the CBOR encoded message.
+const WireSchema = `
+message = {
+  Type: int,              ; the MsgType, see below
+  Time: time,
+  From: bytes,            ; the sending node's peer ID
+  Body: value
+}
+
+; a value of a type that varies, e.g. the body of a message, tagged with the name of its type.
+; V is the CBOR encoding of the value, or null when the value itself is null (T is "")
+value = { T: typename / "", V: bytes / null }
+
+typename = "string" / "bytes" / "int" / "int64" / "uint64" / "float64" / "bool" /
+  "strings" / "map" / "list" / "Header" / "AgentEntry" / "Hash" / "PutReq" / "GetReq" /
+  "GetResp" / "ModReq" / "DelReq" / "LinkReq" / "LinkQuery" / "GossipReq" / "Gossip" /
+  "ValidateQuery" / "ValidateResponse" / "Put" / "GobEntry" / "LinkQueryResp" /
+  "TaggedHash" / "ErrorResponse" / "DelEntry" / "StatusChange" / "Package" / "AppMsg" /
+  "ListAddReq" / "FindNodeReq" / "CloserPeersResp" / "PeerInfo" / "ChunkManifest"
+
+; RFC 3339 with nanoseconds; a zero offset that isn't UTC is written +00:00 rather than Z
+time = tstr
+
+; MsgType: 0 ERROR_RESPONSE, 1 OK_RESPONSE, 2 PUT_REQUEST, 3 DEL_REQUEST, 4 MOD_REQUEST,
+; 5 GET_REQUEST, 6 LINK_REQUEST, 7 GETLINK_REQUEST, 8 DELETELINK_REQUEST, 9 GOSSIP_REQUEST,
+; 10 VALIDATE_PUT_REQUEST, 11 VALIDATE_LINK_REQUEST, 12 VALIDATE_DEL_REQUEST,
+; 13 VALIDATE_MOD_REQUEST, 14 APP_MESSAGE, 15 LISTADD_REQUEST, 16 FIND_NODE_REQUEST
+
+Hash = { H: bytes / null }   ; a multihash
+Header = { Type: tstr, Time: time, HeaderLink: Hash, EntryLink: Hash, TypeLink: Hash,
+  Sig: bytes, Change: StatusChange }
+StatusChange = { Action: tstr, Hash: Hash }
+AgentEntry = { Identity: tstr, Revocation: bytes, PublicKey: bytes }
+GobEntry = { C: value }
+DelEntry = { Hash: Hash, Message: tstr }
+PutReq = { H: Hash, S: int, D: value }
+GetReq = { H: Hash, StatusMask: int, GetMask: int }
+GetResp = { Entry: GobEntry, EntryType: tstr, Sources: [* tstr], FollowHash: tstr }
+ModReq = { H: Hash, N: Hash }
+DelReq = { H: Hash, By: Hash }
+LinkReq = { Base: Hash, Links: Hash }
+LinkQuery = { Base: Hash, T: tstr, StatusMask: int }
+LinkQueryResp = { Links: [* TaggedHash] }
+TaggedHash = { H: tstr, E: tstr, EntryType: tstr, T: tstr, Source: tstr }
+GossipReq = { MyIdx: int, YourIdx: int }
+Gossip = { Puts: [* Put] }
+Put = { M: message }
+ValidateQuery = { H: Hash }
+ValidateResponse = { Type: tstr, Header: Header, Entry: GobEntry, Package: Package }
+Package = { Chain: bytes }
+ErrorResponse = { Code: int, Message: tstr, Payload: value }
+AppMsg = { ZomeType: tstr, Body: tstr }
+ListAddReq = { ListType: tstr, Peers: [* tstr], WarrantType: int, Warrant: bytes }
+FindNodeReq = { H: Hash }
+CloserPeersResp = { CloserPeers: [* PeerInfo] }
+PeerInfo = { ID: bytes, Addrs: [* bytes] }
+ChunkManifest = { EntryType: tstr, Size: int, Hash: Hash, Chunks: [* Hash] }
+`
+
+// wireTypes maps the names used in WireSchema to the types that can be carried in values
+var wireTypes = func() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	for name, v := range map[string]interface{}{
+		"string":           "",
+		"bytes":            []byte{},
+		"int":              0,
+		"int64":            int64(0),
+		"uint64":           uint64(0),
+		"float64":          float64(0),
+		"bool":             false,
+		"strings":          []string{},
+		"map":              map[string]interface{}{},
+		"list":             []interface{}{},
+		"Header":           Header{},
+		"AgentEntry":       AgentEntry{},
+		"Hash":             Hash{},
+		"PutReq":           PutReq{},
+		"GetReq":           GetReq{},
+		"GetResp":          GetResp{},
+		"ModReq":           ModReq{},
+		"DelReq":           DelReq{},
+		"LinkReq":          LinkReq{},
+		"LinkQuery":        LinkQuery{},
+		"GossipReq":        GossipReq{},
+		"Gossip":           Gossip{},
+		"ValidateQuery":    ValidateQuery{},
+		"ValidateResponse": ValidateResponse{},
+		"Put":              Put{},
+		"GobEntry":         GobEntry{},
+		"LinkQueryResp":    LinkQueryResp{},
+		"TaggedHash":       TaggedHash{},
+		"ErrorResponse":    ErrorResponse{},
+		"DelEntry":         DelEntry{},
+		"StatusChange":     StatusChange{},
+		"Package":          Package{},
+		"AppMsg":           AppMsg{},
+		"ListAddReq":       ListAddReq{},
+		"FindNodeReq":      FindNodeReq{},
+		"CloserPeersResp":  CloserPeersResp{},
+		"PeerInfo":         PeerInfo{},
+		"ChunkManifest":    ChunkManifest{},
+	} {
+		types[name] = reflect.TypeOf(v)
+	}
+	return types
+}()
+
+var wireTypeNames = func() map[reflect.Type]string {
+	names := make(map[reflect.Type]string)
+	for name, t := range wireTypes {
+		names[t] = name
+	}
+	return names
+}()
+
+// wireValue is how a value of varying type is carried in the CBOR wire encoding
+type wireValue struct {
+	T string // the name of the value's type, empty if the value is nil
+	V []byte // the CBOR encoding of the value
+}
+
+// toWireValue tags a value with its type name and encodes it
+func toWireValue(v interface{}) (w wireValue, err error) {
+	if v == nil {
+		return
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	name, ok := wireTypeNames[rv.Type()]
+	if !ok {
+		err = fmt.Errorf("%v can't be sent in the %s wire encoding", rv.Type(), CBOREncoding)
+		return
+	}
+	w.T = name
+	// encode through a pointer so that the wire formats defined on pointer receivers get used
+	p := reflect.New(rv.Type())
+	p.Elem().Set(rv)
+	w.V, err = EncodeCBOR(p.Interface())
+	return
+}
+
+// value decodes a wireValue into a value of its tagged type
+func (w wireValue) value() (v interface{}, err error) {
+	if w.T == "" {
+		return
+	}
+	t, ok := wireTypes[w.T]
+	if !ok {
+		err = fmt.Errorf("unknown type in %s wire encoding: %s", CBOREncoding, w.T)
+		return
+	}
+	p := reflect.New(t)
+	if err = DecodeCBOR(w.V, p.Interface()); err != nil {
+		return
+	}
+	v = p.Elem().Interface()
+	return
+}
+
+// wireTime formats a time such that it parses back to the same instant and zone offset,
+// which matters for times that are part of signed data, e.g. a Header's
+func wireTime(t time.Time) string {
+	if t.Location() != time.UTC {
+		if _, offset := t.Zone(); offset == 0 {
+			return t.Format("2006-01-02T15:04:05.999999999") + "+00:00"
+		}
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseWireTime(s string) (t time.Time, err error) {
+	t, err = time.Parse(time.RFC3339Nano, s)
+	return
+}
+
+// the codec package recovers these panics and returns them from Encode and Decode
+func mustEncode(e *codec.Encoder, v interface{}) {
+	if err := e.Encode(v); err != nil {
+		panic(err)
+	}
+}
+
+func mustDecode(d *codec.Decoder, v interface{}) {
+	if err := d.Decode(v); err != nil {
+		panic(err)
+	}
+}
+
+func panicOnErr(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+type wireMessage struct {
+	Type MsgType
+	Time string
+	From []byte
+	Body wireValue
+}
+
+// CodecEncodeSelf writes a Message in the CBOR wire encoding
+func (m *Message) CodecEncodeSelf(e *codec.Encoder) {
+	body, err := toWireValue(m.Body)
+	panicOnErr(err)
+	mustEncode(e, &wireMessage{Type: m.Type, Time: wireTime(m.Time), From: []byte(m.From), Body: body})
+}
+
+// CodecDecodeSelf reads a Message from the CBOR wire encoding
+func (m *Message) CodecDecodeSelf(d *codec.Decoder) {
+	var w wireMessage
+	mustDecode(d, &w)
+	t, err := parseWireTime(w.Time)
+	panicOnErr(err)
+	body, err := w.Body.value()
+	panicOnErr(err)
+	*m = Message{Type: w.Type, Time: t, From: peer.ID(w.From), Body: body}
+}
+
+type wireHeader struct {
+	Type       string
+	Time       string
+	HeaderLink Hash
+	EntryLink  Hash
+	TypeLink   Hash
+	Sig        []byte
+	Change     StatusChange
+}
+
+// CodecEncodeSelf writes a Header in the CBOR wire encoding
+func (hd *Header) CodecEncodeSelf(e *codec.Encoder) {
+	mustEncode(e, &wireHeader{Type: hd.Type, Time: wireTime(hd.Time), HeaderLink: hd.HeaderLink, EntryLink: hd.EntryLink, TypeLink: hd.TypeLink, Sig: hd.Sig.S, Change: hd.Change})
+}
+
+// CodecDecodeSelf reads a Header from the CBOR wire encoding
+func (hd *Header) CodecDecodeSelf(d *codec.Decoder) {
+	var w wireHeader
+	mustDecode(d, &w)
+	t, err := parseWireTime(w.Time)
+	panicOnErr(err)
+	*hd = Header{Type: w.Type, Time: t, HeaderLink: w.HeaderLink, EntryLink: w.EntryLink, TypeLink: w.TypeLink, Sig: Signature{S: w.Sig}, Change: w.Change}
+}
+
+type wirePutReq struct {
+	H Hash
+	S int
+	D wireValue
+}
+
+// CodecEncodeSelf writes a PutReq in the CBOR wire encoding
+func (r *PutReq) CodecEncodeSelf(e *codec.Encoder) {
+	d, err := toWireValue(r.D)
+	panicOnErr(err)
+	mustEncode(e, &wirePutReq{H: r.H, S: r.S, D: d})
+}
+
+// CodecDecodeSelf reads a PutReq from the CBOR wire encoding
+func (r *PutReq) CodecDecodeSelf(dec *codec.Decoder) {
+	var w wirePutReq
+	mustDecode(dec, &w)
+	d, err := w.D.value()
+	panicOnErr(err)
+	*r = PutReq{H: w.H, S: w.S, D: d}
+}
+
+type wireGobEntry struct {
+	C wireValue
+}
+
+// CodecEncodeSelf writes a GobEntry in the CBOR wire encoding
+func (e *GobEntry) CodecEncodeSelf(enc *codec.Encoder) {
+	c, err := toWireValue(e.C)
+	panicOnErr(err)
+	mustEncode(enc, &wireGobEntry{C: c})
+}
+
+// CodecDecodeSelf reads a GobEntry from the CBOR wire encoding
+func (e *GobEntry) CodecDecodeSelf(d *codec.Decoder) {
+	var w wireGobEntry
+	mustDecode(d, &w)
+	c, err := w.C.value()
+	panicOnErr(err)
+	*e = GobEntry{C: c}
+}
+
+type wireErrorResponse struct {
+	Code    int
+	Message string
+	Payload wireValue
+}
+
+// CodecEncodeSelf writes an ErrorResponse in the CBOR wire encoding
+func (errResp *ErrorResponse) CodecEncodeSelf(e *codec.Encoder) {
+	payload, err := toWireValue(errResp.Payload)
+	panicOnErr(err)
+	mustEncode(e, &wireErrorResponse{Code: errResp.Code, Message: errResp.Message, Payload: payload})
+}
+
+// CodecDecodeSelf reads an ErrorResponse from the CBOR wire encoding
+func (errResp *ErrorResponse) CodecDecodeSelf(d *codec.Decoder) {
+	var w wireErrorResponse
+	mustDecode(d, &w)
+	payload, err := w.Payload.value()
+	panicOnErr(err)
+	*errResp = ErrorResponse{Code: w.Code, Message: w.Message, Payload: payload}
+}
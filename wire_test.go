@@ -0,0 +1,79 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/metacurrency/holochain/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func cborRoundTrip(m *Message) (m2 Message) {
+	data, err := m.EncodeAs(CBOREncoding)
+	So(err, ShouldBeNil)
+	err = m2.DecodeAs(CBOREncoding, data)
+	So(err, ShouldBeNil)
+	So(m2.Type, ShouldEqual, m.Type)
+	So(m2.Time.Equal(m.Time), ShouldBeTrue)
+	So(m2.From, ShouldEqual, m.From)
+	return
+}
+
+func TestWireEncoding(t *testing.T) {
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+	hash, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat6x5HEhc1TVGs11tmfNSzkqh2")
+
+	Convey("it should round trip request bodies", t, func() {
+		m2 := cborRoundTrip(node.NewMessage(PUT_REQUEST, PutReq{H: hash, S: 1}))
+		So(m2.Body, ShouldResemble, PutReq{H: hash, S: 1})
+
+		m2 = cborRoundTrip(node.NewMessage(GETLINK_REQUEST, LinkQuery{Base: hash, T: "tag", StatusMask: StatusLive}))
+		So(m2.Body, ShouldResemble, LinkQuery{Base: hash, T: "tag", StatusMask: StatusLive})
+
+		m2 = cborRoundTrip(node.NewMessage(FIND_NODE_REQUEST, FindNodeReq{H: hash}))
+		So(m2.Body, ShouldResemble, FindNodeReq{H: hash})
+
+		m2 = cborRoundTrip(node.NewMessage(APP_MESSAGE, "fish"))
+		So(m2.Body, ShouldEqual, "fish")
+
+		m2 = cborRoundTrip(node.NewMessage(GOSSIP_REQUEST, nil))
+		So(m2.Body, ShouldBeNil)
+	})
+
+	Convey("it should round trip values of varying type nested in bodies", t, func() {
+		m2 := cborRoundTrip(node.NewMessage(OK_RESPONSE, GetResp{Entry: GobEntry{C: []byte{1, 2}}, EntryType: "chunk", Sources: []string{"a"}}))
+		So(m2.Body, ShouldResemble, GetResp{Entry: GobEntry{C: []byte{1, 2}}, EntryType: "chunk", Sources: []string{"a"}})
+
+		put := node.NewMessage(PUT_REQUEST, PutReq{H: hash})
+		m2 = cborRoundTrip(node.NewMessage(OK_RESPONSE, Gossip{Puts: []Put{Put{M: *put}}}))
+		So(fmt.Sprintf("%v", m2.Body.(Gossip).Puts[0].M), ShouldEqual, fmt.Sprintf("%v", *put))
+
+		errResp := NewErrorResponse(ErrHashNotFound)
+		errResp.Payload = AppMsg{ZomeType: "zome", Body: "body"}
+		m2 = cborRoundTrip(node.NewMessage(ERROR_RESPONSE, errResp))
+		So(m2.Body, ShouldResemble, errResp)
+	})
+
+	Convey("it should keep headers exactly so their hashes still match", t, func() {
+		for _, tm := range []time.Time{time.Unix(1, 1).UTC(), time.Unix(1, 1).In(time.FixedZone("", 0)), time.Unix(1, 1).In(time.FixedZone("", -5*3600))} {
+			hd := mkTestHeader("evenNumbers")
+			hd.Time = tm
+			hd.Sig = Signature{S: []byte("sig")}
+			m2 := cborRoundTrip(node.NewMessage(OK_RESPONSE, ValidateResponse{Type: "evenNumbers", Header: hd, Entry: GobEntry{C: "2"}}))
+			resp := m2.Body.(ValidateResponse)
+			b1, _ := hd.Marshal()
+			b2, _ := resp.Header.Marshal()
+			So(b2, ShouldResemble, b1)
+			So(resp.Entry.C, ShouldEqual, "2")
+		}
+	})
+
+	Convey("it should refuse values of types it doesn't know", t, func() {
+		_, err := node.NewMessage(APP_MESSAGE, struct{ X int }{1}).EncodeAs(CBOREncoding)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -5,6 +5,7 @@
 package holochain
 
 import (
+	"encoding/base64"
 	"errors"
 	. "github.com/metacurrency/holochain/hash"
 )
@@ -17,11 +18,33 @@ type Zome struct {
 	Entries      []EntryDef
 	RibosomeType string
 	Functions    []FunctionDef
-	BridgeFuncs  []string // functions in zome that can be bridged to by fromApp
-	BridgeTo     Hash     // dna Hash of toApp that this zome is a client of
+	Scheduled    []ScheduledFunction // functions the app calls periodically
+	BridgeFuncs  []string            // functions in zome that can be bridged to by fromApp
+	BridgeTo     Hash                // dna Hash of toApp that this zome is a client of
 }
 
 // GetEntryDef returns the entry def structure
+// SetCode sets the zome's code from the contents of its code file.  Binary wasm code is
+// kept base64 encoded, so that it survives the DNA's text encodings and the DNA hash
+// covers the actual module.
+func (z *Zome) SetCode(code []byte) {
+	if z.RibosomeType == WasmRibosomeType {
+		z.Code = base64.StdEncoding.EncodeToString(code)
+	} else {
+		z.Code = string(code)
+	}
+}
+
+// CodeBytes returns the contents of the zome's code file, the inverse of SetCode
+func (z *Zome) CodeBytes() (code []byte, err error) {
+	if z.RibosomeType == WasmRibosomeType {
+		code, err = base64.StdEncoding.DecodeString(z.Code)
+	} else {
+		code = []byte(z.Code)
+	}
+	return
+}
+
 func (z *Zome) GetEntryDef(entryName string) (e *EntryDef, err error) {
 	for _, def := range z.Entries {
 		if def.Name == entryName {
@@ -69,6 +92,12 @@ func (zome *Zome) CodeFileName() string {
 		return zome.Name + ".zy"
 	} else if zome.RibosomeType == JSRibosomeType {
 		return zome.Name + ".js"
+	} else if zome.RibosomeType == WasmRibosomeType {
+		return zome.Name + ".wasm"
+	} else if zome.RibosomeType == GoRibosomeType {
+		return zome.Name + ".gozome"
+	} else if zome.RibosomeType == ESRibosomeType {
+		return zome.Name + ".es"
 	}
 	panic("unknown ribosome type:" + zome.RibosomeType)
 }
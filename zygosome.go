@@ -23,40 +23,146 @@ const (
 	ZygoRibosomeType = "zygo"
 )
 
-// ZygoRibosome holds data needed for the Zygo VM
+// ZygoRibosome holds data needed for the Zygo VM.  A zygo environment can't be copied or
+// returned to the state it was in after loading the zome code, so it isn't resettable and
+// every call gets a newly built environment rather than one from the ribosome pool.
 type ZygoRibosome struct {
+	validationContext
+	interrupter
 	h          *Holochain
 	zome       *Zome
 	env        *zygo.Glisp
 	lastResult zygo.Sexp
 	library    string
+	modules    map[string]bool // the modules that have been required
+	depth      int             // how many limited calls are running, nested calls share the outermost one's steps
+	steps      int             // steps left in the current call
+	stepLimit  int
 }
 
 // Type returns the string value under which this ribosome is registered
 func (z *ZygoRibosome) Type() string { return ZygoRibosomeType }
 
+// limited runs fn within the ribosome's execution limits.  The zygo interpreter has no
+// interrupt of its own, so when it runs out of time or steps the environment is interrupted,
+// which stops it at its next function call, and can't be used again.
+func (z *ZygoRibosome) limited(fn func() (zygo.Sexp, error)) (result zygo.Sexp, err error) {
+	if z.interrupted() {
+		err = ErrRibosomeAbandoned
+		return
+	}
+	limits := execLimits(z.h)
+	if z.depth == 0 {
+		z.steps, z.stepLimit = limits.Steps, limits.Steps
+	}
+	z.depth++
+	defer func() { z.depth-- }()
+	var r interface{}
+	r, err = runWithTimeout(limits.Timeout, z.interrupt, func() (interface{}, error) {
+		return z.stoppable(fn)
+	})
+	if _, ok := err.(*ExecLimitErr); ok {
+		return
+	}
+	if r != nil {
+		result = r.(zygo.Sexp)
+	}
+	return
+}
+
+// stoppable runs fn, returning ErrRibosomeAbandoned if the environment was interrupted, or
+// the ExecLimitErr if it ran out of steps
+func (z *ZygoRibosome) stoppable(fn func() (zygo.Sexp, error)) (result zygo.Sexp, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch e := r.(type) {
+			case *ExecLimitErr:
+				result, err = nil, e
+			default:
+				if r != ErrRibosomeAbandoned {
+					panic(r)
+				}
+				result, err = nil, ErrRibosomeAbandoned
+			}
+		}
+	}()
+	result, err = fn()
+	return
+}
+
+// step is run before every function call, builtin or host API, to count it against the
+// call's steps.  It unwinds the interpreter back to stoppable once the environment has
+// run out of steps or been interrupted.
+func (z *ZygoRibosome) step(env *zygo.Glisp, name string, args []zygo.Sexp) {
+	if z.stepLimit > 0 {
+		if z.steps <= 0 {
+			z.interrupt()
+			panic(&ExecLimitErr{Limit: "steps", Value: z.stepLimit})
+		}
+		z.steps--
+	}
+	if z.interrupted() {
+		panic(ErrRibosomeAbandoned)
+	}
+}
+
+// run runs the loaded code
+func (z *ZygoRibosome) run() (zygo.Sexp, error) {
+	return z.limited(z.env.Run)
+}
+
+// apply calls the named zygo function with arguments constructed in Go
+func (z *ZygoRibosome) apply(fnName string, args ...zygo.Sexp) (result zygo.Sexp, err error) {
+	obj, found := z.env.FindObject(fnName)
+	if !found {
+		err = fmt.Errorf("undefined function: %s", fnName)
+		return
+	}
+	fn, ok := obj.(*zygo.SexpFunction)
+	if !ok {
+		err = fmt.Errorf("%s is not a function", fnName)
+		return
+	}
+	result, err = z.limited(func() (zygo.Sexp, error) {
+		return z.env.Apply(fn, args)
+	})
+	return
+}
+
+// unjson converts JSON text into a zygo value
+func (z *ZygoRibosome) unjson(j string) (zygo.Sexp, error) {
+	return z.apply("unjson", &zygo.SexpRaw{Val: []byte(j)})
+}
+
+// toZy converts a Go value into a zygo value by way of JSON
+func (z *ZygoRibosome) toZy(v interface{}) (sexp zygo.Sexp, err error) {
+	var j []byte
+	j, err = json.Marshal(v)
+	if err != nil {
+		return
+	}
+	sexp, err = z.unjson(string(j))
+	return
+}
+
 // ChainGenesis runs the application genesis function
 // this function gets called after the genesis entries are added to the chain
 func (z *ZygoRibosome) ChainGenesis() (err error) {
-	err = z.boolFn("genesis", "")
+	err = z.boolFn("genesis")
 	return
 }
 
 // BridgeGenesis runs the bridging genesis function
 // this function gets called on both sides of the bridging
 func (z *ZygoRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
-	err = z.boolFn("bridgeGenesis", fmt.Sprintf(`%d "%s" "%s"`, side, dnaHash.String(), sanitizeZyString(data)))
+	err = z.boolFn("bridgeGenesis", &zygo.SexpInt{Val: int64(side)}, &zygo.SexpStr{S: dnaHash.String()}, &zygo.SexpStr{S: data})
 	return
 }
 
-func (z *ZygoRibosome) boolFn(fnName string, args string) (err error) {
-	err = z.env.LoadString("(" + fnName + " " + args + ")")
+func (z *ZygoRibosome) boolFn(fnName string, args ...zygo.Sexp) (err error) {
+	result, err := z.apply(fnName, args...)
 	if err != nil {
-		return
-	}
-	result, err := z.env.Run()
-	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execErr(fnName, err)
 		return
 	}
 	switch result.(type) {
@@ -87,7 +193,7 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 		return
 	}
 	var result interface{}
-	result, err = z.env.Run()
+	result, err = z.run()
 	if err == nil {
 		switch t := result.(type) {
 		case *zygo.SexpStr:
@@ -105,6 +211,13 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 
 // ValidatePackagingRequest calls the app for a validation packaging request for an action
 func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	z.startValidation(action)
+	defer func() {
+		err = z.endValidation(err)
+		if err != nil {
+			req = nil
+		}
+	}()
 	var code string
 	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
 	code = fmt.Sprintf(`(%s "%s")`, fnName, def.Name)
@@ -113,9 +226,9 @@ func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run()
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execErr(fnName, err)
 		return
 	}
 	switch v := result.(type) {
@@ -138,12 +251,20 @@ func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 }
 
 func prepareZyEntryArgs(def *EntryDef, entry Entry, header *Header) (args string, err error) {
-	entryStr := entry.Content().(string)
+	var entryStr string
+	entryStr, err = def.ContentString(entry)
+	if err != nil {
+		return
+	}
 	switch def.DataFormat {
 	case DataFormatRawZygo:
 		args = entryStr
+	case DataFormatBytes:
+		fallthrough
 	case DataFormatString:
 		args = "\"" + sanitizeZyString(entryStr) + "\""
+	case DataFormatCBOR:
+		fallthrough
 	case DataFormatLinks:
 		fallthrough
 	case DataFormatJSON:
@@ -223,6 +344,8 @@ func buildZyValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 
 // ValidateAction builds the correct validation function based on the action an calls it
 func (z *ZygoRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	z.startValidation(action)
+	defer func() { err = z.endValidation(err) }()
 	var code string
 	code, err = buildZyValidateAction(action, def, pkg, sources)
 	if err != nil {
@@ -244,23 +367,32 @@ func mkZySources(sources []string) (srcs string) {
 	return
 }
 
-func (z *ZygoRibosome) prepareValidateArgs(def *EntryDef, entry Entry, sources []string) (e string, srcs string, err error) {
-	c := entry.Content().(string)
-	// @todo handle JSON if schema type is different
+// entryValue converts an entry's content into the zygo value passed to app functions
+func (z *ZygoRibosome) entryValue(def *EntryDef, entry Entry) (v zygo.Sexp, err error) {
+	var c string
+	c, err = def.ContentString(entry)
+	if err != nil {
+		return
+	}
 	switch def.DataFormat {
 	case DataFormatRawZygo:
-		e = c
+		err = z.env.LoadString(c)
+		if err == nil {
+			v, err = z.run()
+		}
+	case DataFormatBytes:
+		fallthrough
 	case DataFormatString:
-		e = "\"" + sanitizeZyString(c) + "\""
+		v = &zygo.SexpStr{S: c}
+	case DataFormatCBOR:
+		fallthrough
 	case DataFormatLinks:
 		fallthrough
 	case DataFormatJSON:
-		e = fmt.Sprintf(`(unjson (raw "%s"))`, sanitizeZyString(c))
+		v, err = z.unjson(c)
 	default:
 		err = errors.New("data format not implemented: " + def.DataFormat)
-		return
 	}
-	srcs = mkZySources(sources)
 	return
 }
 
@@ -269,48 +401,52 @@ func (z *ZygoRibosome) runValidate(fnName string, code string) (err error) {
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run()
+	err = validateZyResult(fnName, result, err)
+	return
+}
+
+// validateZyResult converts the value returned by a validation function into a validation error
+func validateZyResult(fnName string, result zygo.Sexp, err error) error {
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
-		return
+		return execErr(fnName, err)
 	}
 	switch v := result.(type) {
 	case *zygo.SexpBool:
-		r := v.Val
-		if !r {
-			err = ValidationFailedErr
+		if !v.Val {
+			return ValidationFailedErr
 		}
 	case *zygo.SexpSentinel:
-		err = fmt.Errorf("%s should return boolean, got nil", fnName)
-
+		return fmt.Errorf("%s should return boolean, got nil", fnName)
 	default:
-		err = fmt.Errorf("%s should return boolean, got: %v", fnName, result)
+		return fmt.Errorf("%s should return boolean, got: %v", fnName, result)
 	}
-	return
+	return nil
 }
 
 func (z *ZygoRibosome) validateEntry(fnName string, def *EntryDef, entry Entry, header *Header, sources []string) (err error) {
-	e, srcs, err := z.prepareValidateArgs(def, entry, sources)
+	e, err := z.entryValue(def, entry)
 	if err != nil {
 		return
 	}
-
-	var hdr string
+	var hdr zygo.Sexp = &zygo.SexpStr{S: ""}
 	if header != nil {
-		hdr = fmt.Sprintf(
-			`(hash EntryLink:"%s" Type:"%s" Time:"%s")`,
-			header.EntryLink.String(),
-			header.Type,
-			header.Time.UTC().Format(time.RFC3339),
-		)
-	} else {
-		hdr = `""`
+		hdr, err = z.toZy(map[string]string{
+			"EntryLink": header.EntryLink.String(),
+			"Type":      header.Type,
+			"Time":      header.Time.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return
+		}
 	}
-
-	code := fmt.Sprintf(`(%s "%s" %s %s %s)`, fnName, def.Name, e, hdr, srcs)
-	Debugf("%s: %s", fnName, code)
-
-	err = z.runValidate(fnName, code)
+	srcs, err := z.toZy(sources)
+	if err != nil {
+		return
+	}
+	Debugf("%s: %s", fnName, def.Name)
+	result, err := z.apply(fnName, &zygo.SexpStr{S: def.Name}, e, hdr, srcs)
+	err = validateZyResult(fnName, result, err)
 	return
 }
 
@@ -322,49 +458,55 @@ func sanitizeZyString(s string) string {
 
 // Call calls the zygo function that was registered with expose
 func (z *ZygoRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
-	var code string
+	p, ok := params.(string)
+	if !ok {
+		err = fmt.Errorf("expecting string params, got: %T", params)
+		return
+	}
+	Debugf("Zygo Call: (%s %s)", fn.Name, p)
+	var sexp zygo.Sexp
 	switch fn.CallingType {
 	case STRING_CALLING:
-		code = fmt.Sprintf(`(%s "%s")`, fn.Name, sanitizeZyString(params.(string)))
+		sexp, err = z.apply(fn.Name, &zygo.SexpStr{S: p})
 	case JSON_CALLING:
-		if params.(string) == "" {
-			code = fmt.Sprintf(`(json (%s (raw "%s")))`, fn.Name, sanitizeZyString(params.(string)))
-		} else {
-			code = fmt.Sprintf(`(json (%s (unjson (raw "%s"))))`, fn.Name, sanitizeZyString(params.(string)))
+		var arg zygo.Sexp = &zygo.SexpRaw{Val: []byte(p)}
+		if p != "" {
+			arg, err = z.unjson(p)
+			if err != nil {
+				return
+			}
+		}
+		sexp, err = z.apply(fn.Name, arg)
+		if err == nil {
+			sexp, err = z.apply("json", sexp)
 		}
 	default:
 		err = errors.New("params type not implemented")
 		return
 	}
-	Debugf("Zygo Call: %s", code)
-	err = z.env.LoadString(code)
 	if err != nil {
 		return
 	}
-	result, err = z.env.Run()
-	if err == nil {
-		switch fn.CallingType {
-		case STRING_CALLING:
-			switch t := result.(type) {
-			case *zygo.SexpStr:
-				result = t.S
-			case *zygo.SexpInt:
-				result = fmt.Sprintf("%d", t.Val)
-			case *zygo.SexpRaw:
-				result = string(t.Val)
-			default:
-				result = fmt.Sprintf("%v", result)
-			}
-		case JSON_CALLING:
-			// type should always be SexpRaw
-			switch t := result.(type) {
-			case *zygo.SexpRaw:
-				result = cleanZygoJson(string(t.Val))
-			default:
-				err = errors.New("expected SexpRaw return type")
-			}
+	switch fn.CallingType {
+	case STRING_CALLING:
+		switch t := sexp.(type) {
+		case *zygo.SexpStr:
+			result = t.S
+		case *zygo.SexpInt:
+			result = fmt.Sprintf("%d", t.Val)
+		case *zygo.SexpRaw:
+			result = string(t.Val)
+		default:
+			result = fmt.Sprintf("%v", sexp)
+		}
+	case JSON_CALLING:
+		// type should always be SexpRaw
+		switch t := sexp.(type) {
+		case *zygo.SexpRaw:
+			result = cleanZygoJson(string(t.Val))
+		default:
+			err = errors.New("expected SexpRaw return type")
 		}
-
 	}
 	return
 }
@@ -493,6 +635,8 @@ func zyProcessArgs(z *ZygoRibosome, args []Arg, zyArgs []zygo.Sexp) (err error)
 				fallthrough
 			case DataFormatRawJS:
 				fallthrough
+			case DataFormatBytes:
+				fallthrough
 			case DataFormatString:
 				switch t := a.(type) {
 				case *zygo.SexpStr:
@@ -500,6 +644,8 @@ func zyProcessArgs(z *ZygoRibosome, args []Arg, zyArgs []zygo.Sexp) (err error)
 				default:
 					return argErr("string", i+1, args[i])
 				}
+			case DataFormatCBOR:
+				fallthrough
 			case DataFormatLinks:
 				switch t := a.(type) {
 				case *zygo.SexpHash:
@@ -518,7 +664,10 @@ func zyProcessArgs(z *ZygoRibosome, args []Arg, zyArgs []zygo.Sexp) (err error)
 				err = errors.New("data format not implemented: " + def.DataFormat)
 				return err
 			}
-			args[i].value = entry
+			args[i].value, err = def.ContentFromString(entry)
+			if err != nil {
+				return err
+			}
 
 		case MapArg:
 			switch t := a.(type) {
@@ -561,19 +710,57 @@ func zyProcessArgs(z *ZygoRibosome, args []Arg, zyArgs []zygo.Sexp) (err error)
 	return
 }
 
+// addHostFn adds a host API function to the environment, failing calls to it during
+// validation if it is nondeterministic
+func (z *ZygoRibosome) addHostFn(name string, fn func(*zygo.Glisp, string, []zygo.Sexp) (zygo.Sexp, error)) {
+	z.env.AddFunction(name, func(env *zygo.Glisp, n string, args []zygo.Sexp) (zygo.Sexp, error) {
+		if err := z.checkCall(name); err != nil {
+			return zygo.SexpNull, err
+		}
+		return fn(env, n, args)
+	})
+}
+
 // NewZygoRibosome factory function to build a zygo execution environment for a zome
 func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	z := ZygoRibosome{
-		h:    h,
-		zome: zome,
-		env:  zygo.NewGlispSandbox(),
+		h:       h,
+		zome:    zome,
+		env:     zygo.NewGlispSandbox(),
+		modules: make(map[string]bool),
 	}
 
+	z.env.AddPreHook(z.step)
+
 	z.env.AddFunction("version",
 		func(env *zygo.Glisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
 			return &zygo.SexpStr{S: VersionStr}, nil
 		})
 
+	// zygo has no module scopes, so require loads a module's code into the environment
+	// the first time it is required and returns the module's name
+	z.env.AddFunction("require",
+		func(env *zygo.Glisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
+			if len(args) != 1 {
+				return zygo.SexpNull, zygo.WrongNargs
+			}
+			s, ok := args[0].(*zygo.SexpStr)
+			if !ok {
+				return zygo.SexpNull, errors.New("require: module name should be a string")
+			}
+			lib, err := zomeModule(h, s.S, ZygoRibosomeType)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			if !z.modules[lib.Name] {
+				z.modules[lib.Name] = true
+				if err = env.SourceStream(strings.NewReader(lib.Code)); err != nil {
+					return zygo.SexpNull, err
+				}
+			}
+			return &zygo.SexpStr{S: s.S}, nil
+		})
+
 	addExtras(&z)
 
 	var appKeyHash, appAgentStr, appAgentHash, appAgentTopHash zygo.SexpStr
@@ -586,7 +773,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 
 	// use a closure so that the registered zygo function can call Expose on the correct ZygoRibosome obj
 
-	z.env.AddFunction("property",
+	z.addHostFn("property",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionProperty{}
 			args := a.Args()
@@ -607,7 +794,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, err
 		})
 
-	z.env.AddFunction("debug",
+	z.addHostFn("debug",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionDebug{}
 			args := a.Args()
@@ -620,7 +807,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return zygo.SexpNull, err
 		})
 
-	z.env.AddFunction("makeHash",
+	z.addHostFn("makeHash",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionMakeHash{}
 			args := a.Args()
@@ -629,7 +816,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return zygo.SexpNull, err
 			}
 			a.entryType = args[0].value.(string)
-			a.entry = &GobEntry{C: args[1].value.(string)}
+			a.entry = &GobEntry{C: args[1].value}
 			var r interface{}
 			r, err = a.Do(h)
 			if err != nil {
@@ -643,7 +830,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, nil
 		})
 
-	z.env.AddFunction("getBridges",
+	z.addHostFn("getBridges",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionGetBridges{}
 			args := a.Args()
@@ -689,7 +876,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return zbridges, err
 		})
 
-	z.env.AddFunction("send",
+	z.addHostFn("send",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionSend{}
 			args := a.Args()
@@ -753,7 +940,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return makeResult(env, resp, err)
 		})
 
-	z.env.AddFunction("call",
+	z.addHostFn("call",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionCall{}
 			args := a.Args()
@@ -792,7 +979,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &zygo.SexpStr{S: r.(string)}, err
 		})
 
-	z.env.AddFunction("bridge",
+	z.addHostFn("bridge",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionBridge{}
 			args := a.Args()
@@ -819,7 +1006,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &zygo.SexpStr{S: r.(string)}, err
 		})
 
-	z.env.AddFunction("commit",
+	z.addHostFn("commit",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionCommit{}
 			args := a.Args()
@@ -828,9 +1015,8 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return zygo.SexpNull, err
 			}
 			entryType := args[0].value.(string)
-			entry := args[1].value.(string)
 			var r interface{}
-			e := GobEntry{C: entry}
+			e := GobEntry{C: args[1].value}
 			r, err = NewCommitAction(entryType, &e).Do(h)
 			if err != nil {
 				return zygo.SexpNull, err
@@ -843,7 +1029,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, nil
 		})
 
-	z.env.AddFunction("query",
+	z.addHostFn("query",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionQuery{}
 			args := a.Args()
@@ -941,6 +1127,13 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 						fallthrough
 					case DataFormatJSON:
 						content = result.Entry.Content().(string)
+					case DataFormatBytes:
+						fallthrough
+					case DataFormatCBOR:
+						content, err = def.ContentString(result.Entry)
+						if err != nil {
+							return zygo.SexpNull, err
+						}
 					case DataFormatSysAgent:
 						j, err := json.Marshal(r.(AgentEntry))
 						if err != nil {
@@ -977,7 +1170,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return env.NewSexpArray(results), nil
 		})
 
-	z.env.AddFunction("get",
+	z.addHostFn("get",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionGet{}
 			args := a.Args()
@@ -1027,7 +1220,11 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				var entryStr string
 				var singleValueReturn bool
 				if mask&GetMaskEntry != 0 {
-					j, err := json.Marshal(getResp.Entry.Content())
+					content, err := getRespContent(h, getResp)
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+					j, err := json.Marshal(content)
 					if err == nil {
 						if GetMaskEntry == mask {
 							singleValueReturn = true
@@ -1076,7 +1273,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return makeResult(env, resultValue, err)
 		})
 
-	z.env.AddFunction("update",
+	z.addHostFn("update",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionMod{}
 			args := a.Args()
@@ -1085,10 +1282,9 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return zygo.SexpNull, err
 			}
 			entryType := args[0].value.(string)
-			entryStr := args[1].value.(string)
 			replaces := args[2].value.(Hash)
 
-			entry := GobEntry{C: entryStr}
+			entry := GobEntry{C: args[1].value}
 			resp, err := NewModAction(entryType, &entry, replaces).Do(h)
 			if err != nil {
 				return zygo.SexpNull, err
@@ -1101,7 +1297,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, nil
 		})
 
-	z.env.AddFunction("updateAgent",
+	z.addHostFn("updateAgent",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &ActionModAgent{}
 			//		var a Action = &ActionModAgent{}
@@ -1145,7 +1341,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, nil
 		})
 
-	z.env.AddFunction("remove",
+	z.addHostFn("remove",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionDel{}
 			args := a.Args()
@@ -1172,7 +1368,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return zygo.SexpNull, err
 		})
 
-	z.env.AddFunction("getLinks",
+	z.addHostFn("getLinks",
 		func(env *zygo.Glisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			var a Action = &ActionGetLinks{}
 			args := a.Args()
@@ -1232,7 +1428,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 	}
 	z.library = l
 
-	_, err = z.Run(l + zome.Code)
+	_, err = z.Run(zomeLibraryCode(h, ZygoRibosomeType) + zome.Code)
 	if err != nil {
 		return
 	}
@@ -1249,9 +1445,11 @@ func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
 		return
 	}
 	var sexp zygo.Sexp
-	sexp, err = z.env.Run()
+	sexp, err = z.run()
 	if err != nil {
-		err = errors.New("Zygomys exec error: " + err.Error())
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("Zygomys exec error: " + err.Error())
+		}
 		return
 	}
 	z.lastResult = sexp
@@ -1319,9 +1517,23 @@ func addExtras(z *ZygoRibosome) {
 		})
 }
 
+// RunAsyncSendResponse calls the callback function with the response of an asynchronous send
 func (z *ZygoRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
-	code := fmt.Sprintf(`(%s (unjson (raw "%s")) "%s")`, callback, sanitizeZyString(response.Body), sanitizeZyString(callbackID))
-	Debugf("Calling %s\n", code)
-	result, err = z.Run(code)
+	Debugf("Calling (%s %s %s)\n", callback, response.Body, callbackID)
+	var body zygo.Sexp
+	body, err = z.unjson(response.Body)
+	if err != nil {
+		return
+	}
+	var sexp zygo.Sexp
+	sexp, err = z.apply(callback, body, &zygo.SexpStr{S: callbackID})
+	if err != nil {
+		if _, ok := err.(*ExecLimitErr); !ok {
+			err = errors.New("Zygomys exec error: " + err.Error())
+		}
+		return
+	}
+	z.lastResult = sexp
+	result = sexp
 	return
 }
@@ -8,7 +8,9 @@ import (
 	. "github.com/metacurrency/holochain/hash"
 	. "github.com/smartystreets/goconvey/convey"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestNewZygoRibosome(t *testing.T) {
@@ -1006,3 +1008,154 @@ func TestZyProcessArgs(t *testing.T) {
 		So(args[0].value.(string), ShouldEqual, `{"H":"fakehashvalue","I":314}`)
 	})
 }
+
+func TestZygoBinaryEntries(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	zome := &h.nucleus.dna.Zomes[0]
+	zome.Entries = append(zome.Entries,
+		EntryDef{Name: "blob", DataFormat: DataFormatBytes, Sharing: Public},
+		EntryDef{Name: "record", DataFormat: DataFormatCBOR, Sharing: Public},
+	)
+	zome.Code += "\n(defn validate [entryType entry header sources] true)"
+
+	Convey("it should commit and get bytes entries as base64 strings", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(commit "blob" "aGVsbG8=")`})
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		hash, err := NewHash(z.lastResult.(*zygo.SexpStr).S)
+		So(err, ShouldBeNil)
+
+		e, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		So(e.Content(), ShouldResemble, []byte("hello"))
+
+		if err := h.dht.simHandleChangeReqs(); err != nil {
+			panic(err)
+		}
+		v, err = NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: fmt.Sprintf(`(get "%s")`, hash.String())})
+		So(err, ShouldBeNil)
+		z = v.(*ZygoRibosome)
+		r, err := z.lastResult.(*zygo.SexpHash).HashGet(z.env, z.env.MakeSymbol("result"))
+		So(err, ShouldBeNil)
+		So(r.(*zygo.SexpStr).S, ShouldEqual, `"aGVsbG8="`)
+	})
+
+	Convey("it should commit and get cbor entries as JSON", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(commit "record" (hash name:"Eric"))`})
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		hash, err := NewHash(z.lastResult.(*zygo.SexpStr).S)
+		So(err, ShouldBeNil)
+
+		e, _, err := h.chain.GetEntry(hash)
+		So(err, ShouldBeNil)
+		b, _ := JSONToCBOR(`{"name":"Eric"}`)
+		So(e.Content(), ShouldResemble, b)
+	})
+}
+
+func TestZygoExecLimits(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	h.Config.ExecLimits = ExecLimits{Timeout: 100}
+
+	Convey("it should stop and abandon code that runs too long", t, func() {
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn spin [x] (for [(def i 0) true (set i (+ i 1))] i))`})
+		So(err, ShouldBeNil)
+		z := v.(*ZygoRibosome)
+		var calls int32
+		z.env.AddPreHook(func(env *zygo.Glisp, name string, args []zygo.Sexp) {
+			atomic.AddInt32(&calls, 1)
+		})
+		_, err = v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "time", Value: 100})
+		So(z.interrupted(), ShouldBeTrue)
+
+		time.Sleep(time.Millisecond * 10)
+		stopped := atomic.LoadInt32(&calls)
+		time.Sleep(time.Millisecond * 50)
+		So(atomic.LoadInt32(&calls), ShouldEqual, stopped)
+
+		_, err = v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldEqual, ErrRibosomeAbandoned)
+	})
+
+	Convey("it should stop and abandon code that takes too many steps", t, func() {
+		h.Config.ExecLimits = ExecLimits{Steps: 10000}
+		defer func() { h.Config.ExecLimits = ExecLimits{Timeout: 100} }()
+		v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn spin [x] (for [(def i 0) true (set i (+ i 1))] i))`})
+		So(err, ShouldBeNil)
+		_, err = v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldResemble, &ExecLimitErr{Limit: "steps", Value: 10000})
+		_, err = v.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(err, ShouldEqual, ErrRibosomeAbandoned)
+	})
+}
+
+func TestZygoDeterministicValidation(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(defn validateCommit [name entry header pkg sources] (cond (== entry "get") (begin (get "QmNiCwBNA8MWDADTFVq1BonUEJbS2SvjAoNkZZrhEwcuU2") true) true))`})
+	if err != nil {
+		panic(err)
+	}
+	def := &EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+	hdr := mkTestHeader("evenNumbers")
+
+	Convey("host functions that reach the network should fail validation", t, func() {
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "get"})
+		a.header = &hdr
+		So(v.ValidateAction(a, def, nil, nil), ShouldResemble, &NondeterministicCallErr{Fn: "get"})
+		a = NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		a.header = &hdr
+		So(v.ValidateAction(a, def, nil, nil), ShouldBeNil)
+	})
+}
+
+func TestZygoArgumentMarshalling(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	v, err := NewZygoRibosome(h, &Zome{RibosomeType: ZygoRibosomeType, Code: `(def saved "")
+(defn echo [x] x)
+(defn bridgeGenesis [side dna data] (set saved data) true)
+(defn validateThing [name entry header sources] (set saved entry) true)
+(defn asyncResponse [response id] (set saved id) true)`})
+	if err != nil {
+		panic(err)
+	}
+	z := v.(*ZygoRibosome)
+	saved := func() string {
+		_, err := z.Run("saved")
+		So(err, ShouldBeNil)
+		return z.lastResult.(*zygo.SexpStr).S
+	}
+
+	Convey("string calling should round-trip tricky payloads", t, func() {
+		r, err := v.Call(&FunctionDef{Name: "echo", CallingType: STRING_CALLING}, trickyPayload)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, trickyPayload)
+	})
+
+	Convey("bridge genesis should receive tricky data", t, func() {
+		err := v.BridgeGenesis(BridgeTo, h.dnaHash, trickyPayload)
+		So(err, ShouldBeNil)
+		So(saved(), ShouldEqual, trickyPayload)
+	})
+
+	Convey("validate entry should receive tricky entries", t, func() {
+		def := &EntryDef{Name: "thing", DataFormat: DataFormatString}
+		err := z.validateEntry("validateThing", def, &GobEntry{C: trickyPayload + "!"}, &Header{Type: "thing"}, []string{"src"})
+		So(err, ShouldBeNil)
+		So(saved(), ShouldEqual, trickyPayload+"!")
+	})
+
+	Convey("async send responses should receive tricky callback ids", t, func() {
+		_, err := v.RunAsyncSendResponse(AppMsg{Body: `{"a":1}`}, "asyncResponse", trickyPayload+"?")
+		So(err, ShouldBeNil)
+		So(saved(), ShouldEqual, trickyPayload+"?")
+	})
+}